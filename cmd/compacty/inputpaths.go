@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/prints"
+)
+
+type InputPath struct {
+	Path            string
+	RelativePath    string // Relative to the walked directory, or the working directory for files given directly
+	IsFromDirectory bool   // Found while walking a directory, unsupported formats are skipped quietly
+}
+
+type WalkOptions struct {
+	Include []string // Glob patterns, files must match at least one if any is given
+	Exclude []string // Glob patterns, matching files and directories are skipped
+
+	MaxDepth  int       // Directory levels to descend below the given directories. Negative = unlimited
+	NewerThan time.Time // Files modified before this are skipped. Zero = no filter
+}
+
+// Expands directories in `paths` into the files inside them, recursively. Every path (including files given directly)
+// is filtered with `options`. Paths that are given more than once are only returned once.
+func ExpandPaths(paths []string, options WalkOptions) (inputs []InputPath) {
+	inputs = make([]InputPath, 0, len(paths))
+	seen := make(map[string]struct{})
+
+	add := func(filePath, relativePath string, isFromDirectory bool) {
+		cleaned := filepath.Clean(filePath)
+		if _, ok := seen[cleaned]; ok {
+			return
+		}
+
+		seen[cleaned] = struct{}{}
+		inputs = append(inputs, InputPath{Path: filePath, RelativePath: relativePath, IsFromDirectory: isFromDirectory})
+	}
+
+	for _, inputPath := range paths {
+		info, err := os.Stat(inputPath)
+		if err != nil || !info.IsDir() {
+			// Errors are reported once the file is read
+			if err != nil || options.matchesFile(inputPath, info) {
+				add(inputPath, relativeToWorkingDir(inputPath), false)
+			}
+
+			continue
+		}
+
+		err = filepath.WalkDir(inputPath, func(walkedPath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				prints.Warnf("Cannot read %s: %v. Skipping...\n", walkedPath, err)
+				if d != nil && d.IsDir() {
+					return fs.SkipDir
+				}
+
+				return nil
+			}
+
+			if walkedPath == inputPath {
+				return nil
+			}
+
+			relativePath, err := filepath.Rel(inputPath, walkedPath)
+			if err != nil {
+				return err
+			}
+
+			relativePath = filepath.ToSlash(relativePath)
+
+			if d.IsDir() {
+				depth := strings.Count(relativePath, "/") + 1
+				if (options.MaxDepth >= 0 && depth > options.MaxDepth) || matchesAnyGlob(options.Exclude, relativePath) {
+					return fs.SkipDir
+				}
+
+				return nil
+			}
+
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				prints.Warnf("Cannot read %s: %v. Skipping...\n", walkedPath, err)
+				return nil
+			}
+
+			if options.matchesFile(relativePath, info) {
+				add(walkedPath, filepath.FromSlash(relativePath), true)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			prints.Warnf("Cannot walk directory %s: %v\n", inputPath, err)
+		}
+	}
+
+	return inputs
+}
+
+// Returns the path relative to the working directory. Returns the file name if the path is outside of it.
+func relativeToWorkingDir(filePath string) string {
+	absolutePath, err := filepath.Abs(filePath)
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return filepath.Base(filePath)
+	}
+
+	relativePath, err := filepath.Rel(workingDir, absolutePath)
+	if err != nil || !filepath.IsLocal(relativePath) {
+		return filepath.Base(filePath)
+	}
+
+	return relativePath
+}
+
+// Parses the value of --newer-than, either a duration before `now` (`24h`), a date (`2006-01-02`) or a date and time
+// (RFC 3339, `2006-01-02T15:04:05Z07:00`). Dates without a time zone are in local time.
+func ParseNewerThan(value string, now time.Time) (newerThan time.Time, err error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+
+	if newerThan, err := time.Parse(time.RFC3339, value); err == nil {
+		return newerThan, nil
+	}
+
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly} {
+		if newerThan, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return newerThan, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%q is not a duration, a date or a date and time", value)
+}
+
+func (options WalkOptions) matchesFile(relativePath string, info fs.FileInfo) bool {
+	relativePath = filepath.ToSlash(relativePath)
+
+	if len(options.Include) > 0 && !matchesAnyGlob(options.Include, relativePath) {
+		return false
+	}
+
+	if matchesAnyGlob(options.Exclude, relativePath) {
+		return false
+	}
+
+	return options.NewerThan.IsZero() || !info.ModTime().Before(options.NewerThan)
+}
+
+// Patterns without a "/" are matched against the file name. Other patterns are matched against the whole path
+// relative to the walked directory, where "**" matches any amount of directories.
+func matchesAnyGlob(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+
+		var isMatch bool
+		if !strings.Contains(pattern, "/") {
+			isMatch, _ = path.Match(pattern, path.Base(relativePath))
+		} else {
+			isMatch = matchSegments(strings.Split(pattern, "/"), strings.Split(relativePath, "/"))
+		}
+
+		if isMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchSegments(patternSegments, pathSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(pathSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for skipped := 0; skipped <= len(pathSegments); skipped++ {
+			if matchSegments(patternSegments[1:], pathSegments[skipped:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(pathSegments) == 0 {
+		return false
+	}
+
+	isMatch, err := path.Match(patternSegments[0], pathSegments[0])
+	if err != nil || !isMatch {
+		return false
+	}
+
+	return matchSegments(patternSegments[1:], pathSegments[1:])
+}
+
+// Returns an error if any of the patterns is malformed.
+func ValidateGlobs(patterns []string) (err error) {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(filepath.ToSlash(pattern), "/") {
+			if _, err := path.Match(segment, ""); errors.Is(err, path.ErrBadPattern) {
+				return fmt.Errorf("malformed pattern %q", pattern)
+			}
+		}
+	}
+
+	return nil
+}
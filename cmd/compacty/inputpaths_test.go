@@ -0,0 +1,208 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMatchesAnyGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// Without a "/", only the file name is matched
+		{pattern: "*.png", path: "icon.png", want: true},
+		{pattern: "*.png", path: "img/icons/icon.png", want: true},
+		{pattern: "*.png", path: "img/icon.jpg"},
+		{pattern: "icon?.png", path: "img/icon1.png", want: true},
+		{pattern: "img", path: "img/icon.png"},
+
+		// With a "/", the whole path is matched and anchored to the walked directory
+		{pattern: "img/*.png", path: "img/icon.png", want: true},
+		{pattern: "img/*.png", path: "img/icons/icon.png"},
+		{pattern: "img/*.png", path: "assets/img/icon.png"},
+		{pattern: "img/*", path: "img"},
+
+		// "**" matches any amount of directories, none included
+		{pattern: "**/*.png", path: "icon.png", want: true},
+		{pattern: "**/*.png", path: "a/b/c/icon.png", want: true},
+		{pattern: "img/**/*.png", path: "img/icon.png", want: true},
+		{pattern: "img/**/*.png", path: "img/a/b/icon.png", want: true},
+		{pattern: "img/**/*.png", path: "assets/img/icon.png"},
+		{pattern: "**/thumbs/**", path: "a/thumbs/b/icon.png", want: true},
+		{pattern: "**/thumbs/**", path: "a/thumbnails/icon.png"},
+		{pattern: "img/**", path: "img/a/icon.png", want: true},
+
+		// Separators of the pattern are normalized
+		{pattern: filepath.Join("img", "*.png"), path: "img/icon.png", want: true},
+	}
+
+	for _, test := range tests {
+		if got := matchesAnyGlob([]string{test.pattern}, test.path); got != test.want {
+			t.Errorf("matchesAnyGlob(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+
+	if matchesAnyGlob(nil, "icon.png") {
+		t.Errorf("matchesAnyGlob() without patterns = true, want false")
+	}
+}
+
+func TestValidateGlobs(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantErr  bool
+	}{
+		{patterns: []string{"*.png", "img/**/*.jpg", "icon[0-9].png"}},
+		{patterns: []string{"*.png", "icon[.png"}, wantErr: true},
+		{patterns: []string{"img/[/*.png"}, wantErr: true},
+	}
+
+	for _, test := range tests {
+		if err := ValidateGlobs(test.patterns); (err != nil) != test.wantErr {
+			t.Errorf("ValidateGlobs(%q) error = %v, want error = %v", test.patterns, err, test.wantErr)
+		}
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	files := map[string]time.Time{
+		"icon.png":            now,
+		"photo.jpg":           now,
+		"old.png":             old,
+		"img/logo.png":        now,
+		"img/thumbs/logo.png": now,
+		"img/deep/a/b/x.png":  now,
+		"node_modules/x.png":  now,
+	}
+
+	for name, modTime := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string // Relative to `dir`, the directory itself if empty
+		options WalkOptions
+		want    []string // Relative paths of the inputs, sorted
+	}{
+		{
+			name:    "everything",
+			options: WalkOptions{MaxDepth: -1},
+			want: []string{
+				"icon.png", "img/deep/a/b/x.png", "img/logo.png", "img/thumbs/logo.png", "node_modules/x.png", "old.png",
+				"photo.jpg",
+			},
+		},
+		{
+			name:    "include by name",
+			options: WalkOptions{MaxDepth: -1, Include: []string{"*.jpg", "logo.png"}},
+			want:    []string{"img/logo.png", "img/thumbs/logo.png", "photo.jpg"},
+		},
+		{
+			name:    "include anchored",
+			options: WalkOptions{MaxDepth: -1, Include: []string{"img/*.png"}},
+			want:    []string{"img/logo.png"},
+		},
+		{
+			name:    "exclude wins over include",
+			options: WalkOptions{MaxDepth: -1, Include: []string{"**/*.png"}, Exclude: []string{"thumbs", "old.png"}},
+			want:    []string{"icon.png", "img/deep/a/b/x.png", "img/logo.png", "node_modules/x.png"},
+		},
+		{
+			name:    "exclude directories anywhere",
+			options: WalkOptions{MaxDepth: -1, Exclude: []string{"**/node_modules", "img/deep"}},
+			want:    []string{"icon.png", "img/logo.png", "img/thumbs/logo.png", "old.png", "photo.jpg"},
+		},
+		{
+			name:    "max depth",
+			options: WalkOptions{MaxDepth: 1},
+			want:    []string{"icon.png", "img/logo.png", "node_modules/x.png", "old.png", "photo.jpg"},
+		},
+		{
+			name:    "newer than",
+			options: WalkOptions{MaxDepth: 0, NewerThan: now.Add(-time.Hour)},
+			want:    []string{"icon.png", "photo.jpg"},
+		},
+		{
+			name:    "files given directly are filtered too",
+			paths:   []string{"old.png", "icon.png", "photo.jpg", "icon.png"},
+			options: WalkOptions{MaxDepth: -1, Include: []string{"*.png"}, NewerThan: now.Add(-time.Hour)},
+			want:    []string{"icon.png"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			paths := []string{dir}
+			if len(test.paths) > 0 {
+				paths = nil
+				for _, path := range test.paths {
+					paths = append(paths, filepath.Join(dir, path))
+				}
+			}
+
+			var got []string
+			for _, input := range ExpandPaths(paths, test.options) {
+				relativePath, err := filepath.Rel(dir, input.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got = append(got, filepath.ToSlash(relativePath))
+			}
+
+			slices.Sort(got)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("ExpandPaths() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseNewerThan(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "24h", want: now.Add(-24 * time.Hour)},
+		{value: "90m", want: now.Add(-90 * time.Minute)},
+		{value: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local)},
+		{value: "2024-05-01T08:30:00", want: time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)},
+		{value: "2024-05-01 08:30:00", want: time.Date(2024, 5, 1, 8, 30, 0, 0, time.Local)},
+		{value: "2024-05-01T08:30:00Z", want: time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+		{value: "2024-05-01T08:30:00+02:00", want: time.Date(2024, 5, 1, 6, 30, 0, 0, time.UTC)},
+		{value: "yesterday", wantErr: true},
+		{value: "2024-13-01", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseNewerThan(test.value, now)
+		if (err != nil) != test.wantErr || !got.Equal(test.want) {
+			t.Errorf("ParseNewerThan(%q) = %v, %v, want %v, error = %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -14,13 +14,18 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ArrayNone/compacty/internal/cache"
 	"github.com/ArrayNone/compacty/internal/compressor"
 	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/journal"
 	"github.com/ArrayNone/compacty/internal/maputils"
 	"github.com/ArrayNone/compacty/internal/prints"
+	"github.com/ArrayNone/compacty/internal/progress"
+	"github.com/ArrayNone/compacty/internal/report"
 	"github.com/ArrayNone/compacty/internal/textutils"
 
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/pflag"
 )
 
@@ -28,12 +33,35 @@ type ListArgsMode int
 type CLIArguments struct {
 	Preset        string
 	ConfigPath    string
+	OutputDir     string
+	Metadata      string
+	Select        string
+	MinSaving     string
+	Preserve      string
+	TempDir       string
+	BackupSuffix  string
+	UndoRun       string
 	SelectedTools []string
+	Include       []string
+	Exclude       []string
+	MaxDepth      int
+	NewerThan     string
 	DecodeMeasure time.Duration
-
-	All       bool
-	Quiet     bool
-	ToolPrint bool
+	DecodeWarmup  int
+	CacheMaxAge   time.Duration
+	Timeout       time.Duration
+	Nice          int
+	IOPriority    string
+	MemoryLimit   string
+	CPUAffinity   string
+	MinQuality    float64
+	Jobs          int
+	OutputFormat  string
+
+	All        bool
+	Quiet      bool
+	ToolPrint  bool
+	NoProgress bool
 
 	Overwrite bool
 	KeepAll   bool
@@ -46,6 +74,8 @@ type CLIArguments struct {
 	ActionListArgsRaw   bool
 	ActionResetConfig   bool
 	ActionGetConfigPath bool
+	ActionPruneCache    bool
+	ActionUndo          bool
 
 	PerFile        bool
 	Report         bool
@@ -53,10 +83,18 @@ type CLIArguments struct {
 	NoRename       bool
 	SkipValidation bool
 	DecodeTime     bool
+	DecodePin      bool
+	NoCache        bool
+	Verify         bool
+	Quality        bool
 	NoColour       bool
 }
 
 const defaultDecodeMeasure = time.Millisecond * 500
+const defaultDecodeWarmup = 5
+const defaultCacheMaxAge = time.Hour * 24 * 30
+const maxJournalRuns = 50  // Older runs are removed from the journal, along with their backups
+const undoLastRun = "last" // Value of --undo without a run ID
 const (
 	Raw ListArgsMode = iota
 	Processed
@@ -104,6 +142,35 @@ func run(cliArguments *CLIArguments) (err error) {
 		prints.IsQuiet = true
 	}
 
+	outputFormat, err := report.ParseOutputFormat(cliArguments.OutputFormat)
+	if err != nil {
+		return &ExitCodeError{
+			Err:  fmt.Errorf("invalid --output-format: %w", err),
+			Code: BadUsage,
+		}
+	}
+
+	isStreaming := slices.Contains(pflag.Args(), StdinPath)
+	if isStreaming && outputFormat.IsMachineReadable() {
+		return &ExitCodeError{
+			Err:  errors.New("stdin (-) cannot be used with --output-format=json or jsonl, the result is written to stdout"),
+			Code: BadUsage,
+		}
+	}
+
+	if isStreaming || outputFormat.IsMachineReadable() {
+		// Stdout is reserved for the compressed file or the records
+		prints.Output = os.Stderr
+	}
+
+	if cliArguments.ActionPruneCache {
+		return pruneCache(cliArguments.CacheMaxAge)
+	}
+
+	if cliArguments.ActionUndo {
+		return undoRun(cliArguments.UndoRun)
+	}
+
 	if cliArguments.ConfigPath == "" {
 		defaultConfigPath, isCreated, err := config.GetOrCreateUserConfigFile()
 		if err != nil {
@@ -165,17 +232,26 @@ func run(cliArguments *CLIArguments) (err error) {
 	}
 
 	if cliArguments.ActionList {
+		if outputFormat.IsMachineReadable() {
+			return report.WriteRecord(os.Stdout, outputFormat, report.NewListRecord(loadedConfig, cliArguments.ConfigPath))
+		}
+
 		list(loadedConfig, cliArguments.ConfigPath)
 		return nil
 	}
 
-	if cliArguments.ActionListArgs {
-		listArgs(loadedConfig, cliArguments.ConfigPath, Processed)
-		return nil
-	}
+	if cliArguments.ActionListArgs || cliArguments.ActionListArgsRaw {
+		isRaw := !cliArguments.ActionListArgs
+		if outputFormat.IsMachineReadable() {
+			return report.WriteRecord(os.Stdout, outputFormat, report.NewListArgsRecord(loadedConfig, cliArguments.ConfigPath, isRaw))
+		}
+
+		if isRaw {
+			listArgs(loadedConfig, cliArguments.ConfigPath, Raw)
+		} else {
+			listArgs(loadedConfig, cliArguments.ConfigPath, Processed)
+		}
 
-	if cliArguments.ActionListArgsRaw {
-		listArgs(loadedConfig, cliArguments.ConfigPath, Raw)
 		return nil
 	}
 
@@ -222,28 +298,250 @@ func run(cliArguments *CLIArguments) (err error) {
 
 	if cliArguments.All {
 		cliArguments.SelectedTools = slices.Collect(maps.Keys(loadedConfig.Tools))
+		cliArguments.SelectedTools = slices.AppendSeq(cliArguments.SelectedTools, maps.Keys(loadedConfig.Chains))
+	}
+
+	walkOptions, err := cliArguments.WalkOptions()
+	if err != nil {
+		return &ExitCodeError{Err: err, Code: BadUsage}
 	}
 
 	paths := pflag.Args()
+	writeMode := cliArguments.WriteMode()
+	if cliArguments.OutputDir != "" && (cliArguments.Overwrite || isStreaming) {
+		return &ExitCodeError{
+			Err:  errors.New("--output-dir cannot be used with --overwrite or stdin (-)"),
+			Code: BadUsage,
+		}
+	}
+
+	tempDir := loadedConfig.TempDir
+	if cliArguments.TempDir != "" {
+		tempDir = cliArguments.TempDir
+	}
+
+	removedCount, err := compressor.SweepStaleWorkspaces(tempDir)
+	if err != nil {
+		prints.Warnf("Cannot remove temp files left by previous runs: %v\n", err)
+	} else if removedCount > 0 {
+		prints.Printf("Removed temp files left by %d previous %s.\n", removedCount, textutils.PluralNoun(removedCount, "runs", "run"))
+	}
+
+	workspace, err := compressor.NewWorkspace(tempDir)
+	if err != nil {
+		return fmt.Errorf("cannot create temp directory: %w", err)
+	}
+	defer workspace.Remove()
+
+	var stream *StdinStream
+	if isStreaming {
+		if len(paths) > 1 {
+			return &ExitCodeError{
+				Err:  errors.New("stdin (-) cannot be compressed along with other files"),
+				Code: BadUsage,
+			}
+		}
+
+		if cliArguments.Overwrite || cliArguments.KeepAll {
+			return &ExitCodeError{
+				Err:  errors.New("stdin (-) cannot be used with --overwrite or --keep-all, the result is written to stdout"),
+				Code: BadUsage,
+			}
+		}
+
+		stdinPath, err := BufferStdin(loadedConfig, os.Stdin, workspace.Dir)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("cannot read stdin: %w", err),
+				Code: BadInput,
+			}
+		}
+
+		// Without a kept result (--dry, interrupted or failed), the pipeline still receives the original input
+		stream = &StdinStream{Path: stdinPath, Writer: os.Stdout}
+		defer func() {
+			if writeErr := stream.WriteOriginal(); writeErr != nil {
+				prints.Warnf("Cannot write stdin to stdout: %v\n", writeErr)
+			}
+		}()
+
+		paths = []string{stdinPath}
+		if !cliArguments.Dry {
+			writeMode = compressor.Stream
+		}
+	}
+
+	limits, err := cliArguments.Limits()
+	if err != nil {
+		return &ExitCodeError{Err: err, Code: BadUsage}
+	}
+
+	inputs := ExpandPaths(paths, walkOptions)
 
 	renameMode := cliArguments.RenameMode()
-	operatedFiles := PathsToOperatedFiles(loadedConfig, paths, renameMode)
+	operatedFiles := PathsToOperatedFiles(loadedConfig, inputs, renameMode)
+	if cliArguments.OutputDir != "" {
+		err := CheckOutputDirPaths(operatedFiles)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("cannot use --output-dir: %w", err),
+				Code: BadUsage,
+			}
+		}
+	}
+
 	for _, operation := range operatedFiles {
 		if !pflag.Lookup("tools").Changed && !cliArguments.All {
 			operation.SetDefaultTools(loadedConfig, usedPreset, operation.Mime)
 		} else {
-			operation.SetTools(loadedConfig, usedPreset, cliArguments.SelectedTools)
+			operation.SetTools(loadedConfig, usedPreset, cliArguments.SelectedTools, !cliArguments.All)
+		}
+
+		if pflag.Lookup("timeout").Changed {
+			operation.SetTimeout(cliArguments.Timeout)
 		}
 
+		operation.OverrideLimits(limits)
+
 		if cliArguments.PerFile {
 			operation.ForcePerFileMode()
 		}
 	}
 
 	toolOutput := cliArguments.ToolOutput()
-	writeMode := cliArguments.WriteMode()
 	wrappers := loadedConfig.Wrappers[runtime.GOOS]
 
+	jobs := loadedConfig.Jobs
+	if pflag.Lookup("jobs").Changed {
+		jobs = cliArguments.Jobs
+	}
+
+	if jobs < 0 {
+		return &ExitCodeError{
+			Err:  fmt.Errorf("--jobs cannot be negative: %d", jobs),
+			Code: BadUsage,
+		}
+	}
+
+	scheduler := compressor.NewScheduler(jobs)
+
+	var resultCache *cache.Cache
+	if !cliArguments.NoCache {
+		resultCache = openCache()
+	}
+
+	verifyPixels := loadedConfig.Presets[usedPreset].Lossless
+	if pflag.Lookup("verify").Changed {
+		verifyPixels = cliArguments.Verify
+	}
+
+	minQuality := loadedConfig.Presets[usedPreset].MinQuality
+	if pflag.Lookup("min-quality").Changed {
+		minQuality = cliArguments.MinQuality
+	}
+
+	if minQuality < 0 || minQuality > 1 {
+		return &ExitCodeError{
+			Err:  fmt.Errorf("--min-quality must be between 0 and 1: %v", minQuality),
+			Code: BadUsage,
+		}
+	}
+
+	selection := loadedConfig.Presets[usedPreset].Selection
+	if pflag.Lookup("select").Changed {
+		selection, err = config.ParseSelection(cliArguments.Select)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("invalid --select: %w", err),
+				Code: BadUsage,
+			}
+		}
+	}
+
+	minSaving := loadedConfig.Presets[usedPreset].MinSaving
+	if pflag.Lookup("min-saving").Changed {
+		minSaving, err = config.ParseMinSaving(cliArguments.MinSaving)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("invalid --min-saving: %w", err),
+				Code: BadUsage,
+			}
+		}
+	}
+
+	// Results can't be scored without the variables the selection uses
+	benchmarkDecodeTime := cliArguments.DecodeTime || selection.Uses("decode") || selection.Uses("decode_ms")
+	if benchmarkDecodeTime && !cliArguments.DecodeTime {
+		prints.Warnln("Decode time benchmarking is EXPERIMENTAL and MAY NOT reflect real-world performance!")
+	}
+
+	computeQuality := cliArguments.Quality || minQuality > 0 || selection.Uses("quality") || selection.Uses("quality_loss")
+
+	// Overwritten files keep their attributes unless told otherwise, new files are created as usual
+	preserve := compressor.PreserveNone
+	if writeMode == compressor.Overwrite {
+		preserve = compressor.PreserveAll
+	}
+
+	if pflag.Lookup("preserve").Changed {
+		preserve, err = compressor.ParsePreserveFlags(cliArguments.Preserve)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("invalid --preserve: %w", err),
+				Code: BadUsage,
+			}
+		}
+	}
+
+	if cliArguments.BackupSuffix != "" && writeMode != compressor.Overwrite {
+		return &ExitCodeError{
+			Err:  errors.New("--backup-suffix can only be used with --overwrite"),
+			Code: BadUsage,
+		}
+	}
+
+	var journalRun *journal.Run
+	if writeMode == compressor.Overwrite {
+		journalRun, err = openJournalRun(cliArguments.CacheMaxAge)
+		if err != nil && cliArguments.BackupSuffix != "" {
+			return fmt.Errorf("cannot open journal to record backups: %w", err)
+		} else if err != nil {
+			prints.Warnf("Cannot open journal, overwritten files cannot be undone: %v\n", err)
+		}
+	}
+
+	metadataPolicy := loadedConfig.Presets[usedPreset].Metadata
+	if pflag.Lookup("metadata").Changed {
+		metadataPolicy, err = config.ParseMetadataPolicy(cliArguments.Metadata)
+		if err != nil {
+			return &ExitCodeError{
+				Err:  fmt.Errorf("invalid --metadata: %w", err),
+				Code: BadUsage,
+			}
+		}
+	}
+
+	if cliArguments.DecodeWarmup < 0 {
+		return &ExitCodeError{
+			Err:  fmt.Errorf("--dt-warmup cannot be negative: %d", cliArguments.DecodeWarmup),
+			Code: BadUsage,
+		}
+	}
+
+	decodeBench := compressor.DecodeBenchOptions{
+		MinTime:   cliArguments.DecodeMeasure,
+		Warmup:    cliArguments.DecodeWarmup,
+		PinThread: cliArguments.DecodePin,
+	}
+
+	var decoders []compressor.ExternalDecoder
+	if benchmarkDecodeTime {
+		decoders = availableDecoders(loadedConfig)
+	}
+
+	// All outputs are needed to keep all of them or to benchmark them, so these can't be skipped by the cache
+	allowCacheHits := writeMode != compressor.KeepAll && !benchmarkDecodeTime
+
 	var hasTools, isRan, hasErrors bool
 
 	markErrorIfNotOk := func(ok bool) {
@@ -252,11 +550,57 @@ func run(cliArguments *CLIArguments) (err error) {
 		}
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// The live view replaces the command listings and tool messages, it is only drawn on terminals
+	var display *progress.Display
+	if terminal := cliArguments.ProgressTerminal(isStreaming, outputFormat); terminal != nil {
+		totalFiles, totalBytes := countOperatedFiles(operatedFiles)
+		display = progress.NewDisplay(terminal, totalFiles, totalBytes)
+		defer display.Stop()
+
+		prints.Output = display.Writer(terminal)
+		if isatty.IsTerminal(os.Stderr.Fd()) {
+			prints.ErrOutput = display.Writer(os.Stderr)
+		}
+	}
+
+	// Written last, so that the summary has the error the run ends with
+	var jsonWriter *report.JSONWriter
+	if outputFormat.IsMachineReadable() {
+		jsonWriter = report.NewJSONWriter(os.Stdout, outputFormat)
+		defer func() {
+			if closeErr := jsonWriter.Close(err); closeErr != nil {
+				prints.Warnf("Cannot write the summary as JSON: %v\n", closeErr)
+			}
+		}()
+	}
+
+	ctx, stop := interruptContext(func() {
+		if display != nil {
+			display.Stop()
+		}
+
+		// Deferred calls are skipped when aborting
+		if stream != nil {
+			if writeErr := stream.WriteOriginal(); writeErr != nil {
+				prints.Warnf("Cannot write stdin to stdout: %v\n", writeErr)
+			}
+		}
+
+		_ = workspace.Remove()
+		if jsonWriter != nil {
+			if closeErr := jsonWriter.Close(errors.New("aborted")); closeErr != nil {
+				prints.Warnf("Cannot write the summary as JSON: %v\n", closeErr)
+			}
+		}
+	})
 	defer stop()
 
 	for _, operation := range operatedFiles {
-		if len(operation.BatchableTools) == 0 && len(operation.PerFileTools) == 0 {
+		if ctx.Err() != nil {
+			break // Interrupted, the remaining file formats are not started
+		}
+
+		if len(operation.BatchableTools) == 0 && len(operation.PerFileTools) == 0 && len(operation.Chains) == 0 {
 			prints.Warnf("No valid or available tools found for file format %s (%s). Check your config file or install tools for this format.\n", operation.Extension, operation.Mime)
 			continue
 		}
@@ -264,9 +608,37 @@ func run(cliArguments *CLIArguments) (err error) {
 		hasTools = true
 
 		process, allOk := compressor.NewCompressionProcess(operation.Paths, wrappers, toolOutput)
+		process.Scheduler = scheduler
+		process.ResultWriter = os.Stdout
+		if stream != nil {
+			process.ResultWriter = stream
+		}
+		if display != nil {
+			process.Progress = display
+		}
+		if cliArguments.OutputDir != "" {
+			process.SetOutputDir(cliArguments.OutputDir, operation.RelativePaths)
+		}
+		process.VerifyPixels = verifyPixels
+		process.ComputeQuality = computeQuality
+		process.MinQuality = minQuality
+		process.Metadata = metadataPolicy
+		process.Selection = selection
+		process.ToolPriority = loadedConfig.ToolPriority
+		process.MinSaving = minSaving
+		process.Decoders = decoders
+		process.Preserve = preserve
+		process.SetAccessTimes(operation.AccessTimes)
+		process.Journal = journalRun
+		process.BackupSuffix = cliArguments.BackupSuffix
 		defer process.CleanUp()
 		markErrorIfNotOk(allOk)
 
+		err = process.UseWorkspace(workspace)
+		if err != nil {
+			return fmt.Errorf("cannot create temp directories in %s: %w", workspace.Dir, err)
+		}
+
 		validCount := len(process.OriginalPaths)
 		if validCount == 0 {
 			prints.Warnf("Cannot find valid %s paths.\n", operation.Extension)
@@ -275,53 +647,74 @@ func run(cliArguments *CLIArguments) (err error) {
 
 		isRan = true
 
-		if len(operation.BatchableTools) > 0 {
+		if resultCache != nil {
+			allTools := maps.Clone(operation.PerFileTools)
+			maps.Copy(allTools, operation.BatchableTools)
+
+			process.LoadCache(resultCache, allTools, operation.Chains, allowCacheHits)
+			validCount = len(process.UncachedIndices())
+		}
+
+		if len(operation.BatchableTools) > 0 && validCount > 0 {
+			uncachedPaths := make([]string, 0, validCount)
+			for _, i := range process.UncachedIndices() {
+				uncachedPaths = append(uncachedPaths, process.OriginalPaths[i])
+			}
+
 			fileText := textutils.PluralNoun(validCount, "files", "file")
 			prints.Println(
 				color.BlueString("Compressing %d %s %s:", validCount, operation.Extension, fileText),
-				strings.Join(process.OriginalPaths, " "),
+				strings.Join(uncachedPaths, " "),
 			)
-
-			select {
-			case <-process.CompressAll(ctx, operation.BatchableTools):
-			case <-ctx.Done():
-				return &ExitCodeError{Err: errors.New("interrupted"), Code: Interrupted}
-			}
-
-			prints.Println()
 		}
 
-		if len(operation.PerFileTools) > 0 {
+		if (len(operation.PerFileTools) > 0 || len(operation.Chains) > 0) && validCount > 0 {
 			if !cliArguments.PerFile || len(operation.PerFileTools) == 1 {
 				prints.Println("Running per-file tools.")
 			}
+		}
 
-			for i, path := range process.OriginalPaths {
-				prints.Println(
-					color.BlueString("Compressing %s file #%d:", operation.Extension, i+1),
-					color.CyanString(path),
-				)
+		finished := process.CompressFiles(
+			ctx,
+			operation.BatchableTools,
+			operation.PerFileTools,
+			operation.Chains,
+			scheduler.Limit(),
+		)
+
+		if benchmarkDecodeTime {
+			// Benchmark once every tool finishes, running tools would interfere with the measurements
+			for range finished {
+			}
 
-				select {
-				case <-process.CompressSingle(i, ctx, operation.PerFileTools):
-				case <-ctx.Done():
-					return &ExitCodeError{Err: errors.New("interrupted"), Code: Interrupted}
-				}
+			if ctx.Err() == nil {
+				<-process.BenchmarkDecodeTime(ctx, decodeBench)
+			}
 
-				prints.Println()
+			// Files interrupted before all of their tools finished are skipped
+			markErrorIfNotOk(process.SaveResultsAndReport(writeMode))
+			for fileIdx := range process.OriginalFileInfo {
+				if jsonWriter != nil && process.IsFileComplete(fileIdx) {
+					markErrorIfNotOk(operation.WriteJSONFile(jsonWriter, process, fileIdx) == nil)
+				}
 			}
-		}
+		} else {
+			// Save each file as soon as all of its tools finish
+			for fileIdx := range finished {
+				if !process.IsFileComplete(fileIdx) {
+					continue // Interrupted, wait for the remaining tools to stop
+				}
 
-		if cliArguments.DecodeTime {
-			select {
-			case <-process.BenchmarkDecodeTime(cliArguments.DecodeMeasure):
-			case <-ctx.Done():
-				return &ExitCodeError{Err: errors.New("interrupted"), Code: Interrupted}
+				markErrorIfNotOk(process.SaveFileResultAndReport(fileIdx, writeMode))
+				if jsonWriter != nil {
+					markErrorIfNotOk(operation.WriteJSONFile(jsonWriter, process, fileIdx) == nil)
+				}
 			}
 		}
 
-		markErrorIfNotOk(process.SaveResultsAndReport(writeMode))
-		markErrorIfNotOk(process.IsErrorFree())
+		if ctx.Err() == nil {
+			markErrorIfNotOk(process.IsErrorFree())
+		}
 
 		if cliArguments.Report {
 			ok := operation.WriteReport(process) == nil
@@ -329,6 +722,18 @@ func run(cliArguments *CLIArguments) (err error) {
 		}
 	}
 
+	if display != nil {
+		display.Stop()
+	}
+
+	if journalRun != nil && len(journalRun.Entries) > 0 {
+		prints.Printf("Overwritten files can be restored with %s.\n", color.CyanString("--undo="+journalRun.ID))
+	}
+
+	if ctx.Err() != nil {
+		return &ExitCodeError{Err: errors.New("interrupted"), Code: Interrupted}
+	}
+
 	if !hasTools {
 		if !loadedConfig.HasAvailableTools() {
 			list(loadedConfig, cliArguments.ConfigPath)
@@ -363,10 +768,25 @@ func parseArgs() (args *CLIArguments) {
 	pflag.StringVarP(&args.ConfigPath, "config", "c", "", "Use a config file from this path instead from your config directory")
 	pflag.StringSliceVarP(&args.SelectedTools, "tools", "t", []string{}, "Select available tools. Separated by commas (example: --tool=ect,pingo)")
 	pflag.DurationVar(&args.DecodeMeasure, "dt-measure", defaultDecodeMeasure, "Measure decode time for at least the specified duration per file and their compression results in combination with --decode-time")
-
+	pflag.IntVar(&args.DecodeWarmup, "dt-warmup", defaultDecodeWarmup, "Decode each file this many times before measuring in combination with --decode-time")
+	pflag.BoolVar(&args.DecodePin, "dt-pin", false, "Measure decode time on a single OS thread in combination with --decode-time")
+
+	pflag.StringSliceVar(&args.Include, "include", []string{}, "Only compress files matching any of these glob patterns. Separated by commas")
+	pflag.StringSliceVar(&args.Exclude, "exclude", []string{}, "Skip files and directories matching any of these glob patterns. Separated by commas")
+	pflag.IntVar(&args.MaxDepth, "max-depth", -1, "Descend at most this many directory levels into directories. 0 = files directly inside only. Negative = unlimited")
+	pflag.StringVar(&args.NewerThan, "newer-than", "", "Only compress files modified within this duration (24h) or after this date (2006-01-02)")
+	pflag.StringVar(&args.NewerThan, "since", "", "Alias of --newer-than")
+	pflag.IntVarP(&args.Jobs, "jobs", "j", 0, "Maximum amount of tool processes running at once across all tools and files. 0 = amount of logical CPUs. Overrides the config's jobs")
+	pflag.DurationVar(&args.Timeout, "timeout", 0, "Stop each tool process after this duration. 0 = no timeout. Overrides the timeouts in the config")
+	pflag.IntVar(&args.Nice, "nice", 0, "Run tools with this niceness, from -20 to 19 (Linux only). Overrides the limits in the config")
+	pflag.StringVar(&args.IOPriority, "io-priority", "", "Run tools with this IO priority: idle, best-effort[:<level>] or realtime[:<level>] (Linux only). Overrides the limits in the config")
+	pflag.StringVar(&args.MemoryLimit, "memory-limit", "", "Limit the address space of each tool process (512MiB, 2GB) (Linux only). Overrides the limits in the config")
+	pflag.StringVar(&args.CPUAffinity, "cpu-affinity", "", "Run tools only on these CPUs (0-3,6) (Linux only). Overrides the limits in the config")
 	pflag.BoolVarP(&args.All, "all", "a", false, "Use all available tools. Flag is ignored when --tools are provided")
 	pflag.BoolVarP(&args.Quiet, "quiet", "q", false, "Suppress outputs")
 	pflag.BoolVar(&args.ToolPrint, "tool-print", false, "Print tool outputs, ignores --quiet")
+	pflag.StringVar(&args.OutputFormat, "output-format", string(report.FormatText), "Output format: text, json (a single document once done) or jsonl (a record per file as soon as it is done). Messages are written to stderr with json and jsonl")
+	pflag.BoolVar(&args.NoProgress, "no-progress", false, "Print tool messages line by line instead of showing live progress on terminals")
 	pflag.BoolVar(&args.NoColour, "no-color", false, "Disable coloured output")
 	pflag.BoolVar(&args.NoColour, "no-colour", false, "Disable coloured output (alt)")
 
@@ -377,21 +797,38 @@ func parseArgs() (args *CLIArguments) {
 	pflag.BoolVar(&args.ActionListArgsRaw, "list-args-raw", false, "Print tools and presets from the loaded config file and exit. Preset includes are not resolved and are kept as is")
 	pflag.BoolVar(&args.ActionResetConfig, "reset-config", false, " Resets the config file at the user's config directory to default. If --config is provided, creates/resets the file at path instead")
 	pflag.BoolVar(&args.ActionGetConfigPath, "get-config-path", false, "Print the config path and exit")
+	pflag.BoolVar(&args.ActionPruneCache, "prune-cache", false, "Remove cached results that were not used within --cache-max-age, journal runs older than it, and exit")
+	pflag.StringVar(&args.UndoRun, "undo", "", "Restore the files overwritten by the last run, or the run with this ID, and exit")
+	pflag.Lookup("undo").NoOptDefVal = undoLastRun
 
 	pflag.BoolVarP(&args.Overwrite, "overwrite", "O", false, "Overwrite input files")
+	pflag.StringVar(&args.OutputDir, "output-dir", "", "Write results into this directory, mirroring the input paths and keeping their file names")
 	pflag.BoolVar(&args.KeepAll, "keep-all", false, "Keep all compressed files, including losing ones")
+	pflag.StringVar(&args.BackupSuffix, "backup-suffix", "", "With --overwrite, keep the originals next to the files with this suffix appended (example: .orig)")
+	pflag.StringVar(&args.Preserve, "preserve", "", "Attributes of the original to keep on written files: mode, owner, times, xattr, all or none. Defaults to all with --overwrite, none otherwise")
 	pflag.BoolVar(&args.Dry, "dry", false, "Compress and show results only; keep files intact")
 
 	pflag.BoolVar(&args.Report, "report", false, "Save compression results in .tsv files")
 	pflag.BoolVar(&args.PerFile, "per-file", false, "Force files to be compressed one by one, intended for per-file benchmarking")
 	pflag.BoolVar(&args.ForceRename, "force-rename", false, "Automatically rename files with mislabeled extensions when prompted")
 	pflag.BoolVar(&args.NoRename, "no-rename", false, "Skip renaming files with mislabeled extensions automatically when prompted")
-	pflag.BoolVar(&args.DecodeTime, "decode-time", false, "[EXPERIMENTAL] Measure decode time using Go's native libraries (PNG and JPEG only)")
+	pflag.BoolVar(&args.Verify, "verify", false, "Decode results and disqualify the ones with pixels different from the original. Enabled by default for lossless presets, use --verify=false to disable")
+	pflag.BoolVar(&args.Quality, "quality", false, "Score the perceptual quality (MS-SSIM) of results. Enabled if the preset has min-quality")
+	pflag.Float64Var(&args.MinQuality, "min-quality", 0, "Disqualify results with perceptual quality (MS-SSIM, 0 to 1) below this. Overrides the preset's min-quality")
+	pflag.StringVar(&args.Metadata, "metadata", "", "Metadata policy of results: strip-all, keep-color, keep-all, unchanged, or a comma separated list of PNG chunks/JPEG segments to keep. Overrides the preset's metadata")
+	pflag.StringVar(&args.Select, "select", "", "How the best result is picked: size, decode-time, weighted:<variable>=<weight>,... or expression:<expression>. Overrides the preset's selection")
+	pflag.StringVar(&args.MinSaving, "min-saving", "", "Keep the original unless the best result saves at least this much: bytes (4KiB), a percentage (0.5%) or both (4KiB,0.5%). Overrides the preset's min-saving")
+	pflag.StringVar(&args.TempDir, "temp-dir", "", "Create temp files inside this directory instead of the system's temp directory. Overrides the config's temp-dir")
+	pflag.BoolVar(&args.NoCache, "no-cache", false, "Do not use or store cached results")
+	pflag.DurationVar(&args.CacheMaxAge, "cache-max-age", defaultCacheMaxAge, "Remove cached results that were not used within this duration with --prune-cache, and journal runs older than this")
+	pflag.BoolVar(&args.DecodeTime, "decode-time", false, "[EXPERIMENTAL] Measure decode time using Go's native libraries (PNG, JPEG and GIF) and the decoders in the config")
 	pflag.BoolVar(&args.SkipValidation, "skip-validation", false, "[UNSUPPORTED] Skip config validation. May cause runtime errors and/or crash. USE AT YOUR OWN RISK!")
 
 	pflag.Usage = printHelp
 	pflag.Parse()
 
+	args.ActionUndo = pflag.Lookup("undo").Changed
+
 	return args
 }
 
@@ -417,9 +854,139 @@ func (cli *CLIArguments) RenameMode() RenameMode {
 	}
 }
 
+func (cli *CLIArguments) WalkOptions() (options WalkOptions, err error) {
+	options = WalkOptions{
+		Include:  cli.Include,
+		Exclude:  cli.Exclude,
+		MaxDepth: cli.MaxDepth,
+	}
+
+	err = ValidateGlobs(slices.Concat(cli.Include, cli.Exclude))
+	if err != nil {
+		return options, fmt.Errorf("--include/--exclude: %w", err)
+	}
+
+	if cli.NewerThan != "" {
+		options.NewerThan, err = ParseNewerThan(cli.NewerThan, time.Now())
+		if err != nil {
+			return options, fmt.Errorf("--newer-than: %w", err)
+		}
+	}
+
+	return options, nil
+}
+
+// Returns a context cancelled on the first interrupt (Ctrl+C or SIGTERM), which stops running tools and launching new
+// ones while the files that are done are still saved. A second interrupt kills every tool, calls `beforeAbort` and
+// exits right away.
+func interruptContext(beforeAbort func()) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-signals:
+		case <-ctx.Done():
+			return
+		}
+
+		prints.Warnln("Interrupted. Stopping tools and saving the files that are done, interrupt again to abort...")
+		cancel()
+
+		<-signals
+		compressor.KillRunningTools()
+		beforeAbort()
+
+		fmt.Fprintln(os.Stderr, color.RedString("Error:"), "aborted")
+		os.Exit(Interrupted)
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// Returns the limits set by --nice, --io-priority, --memory-limit and --cpu-affinity. Unset flags are left unset.
+func (cli *CLIArguments) Limits() (limits config.Limits, err error) {
+	if pflag.Lookup("nice").Changed {
+		limits.Nice = &cli.Nice
+	}
+
+	if pflag.Lookup("io-priority").Changed {
+		limits.IOPriority, err = config.ParseIOPriority(cli.IOPriority)
+		if err != nil {
+			return config.Limits{}, fmt.Errorf("invalid --io-priority: %w", err)
+		}
+	}
+
+	if pflag.Lookup("memory-limit").Changed {
+		limits.MemoryLimit, err = config.ParseByteSize(cli.MemoryLimit)
+		if err != nil {
+			return config.Limits{}, fmt.Errorf("invalid --memory-limit: %w", err)
+		}
+	}
+
+	if pflag.Lookup("cpu-affinity").Changed {
+		limits.CPUAffinity, err = config.ParseCPUList(cli.CPUAffinity)
+		if err != nil {
+			return config.Limits{}, fmt.Errorf("invalid --cpu-affinity: %w", err)
+		}
+	}
+
+	err = limits.Validate()
+	if err != nil {
+		return config.Limits{}, fmt.Errorf("invalid limits: %w", err)
+	}
+
+	return limits, nil
+}
+
+// Returns the terminal to draw the live progress view on: stdout, or stderr if stdout has the records of
+// `outputFormat`. Returns nil if the view should not be drawn.
+func (cli *CLIArguments) ProgressTerminal(isStreaming bool, outputFormat report.OutputFormat) *os.File {
+	if cli.NoProgress || cli.Quiet || cli.ToolPrint || isStreaming {
+		return nil
+	}
+
+	terminal := os.Stdout
+	if outputFormat.IsMachineReadable() {
+		terminal = os.Stderr
+	}
+
+	if !isatty.IsTerminal(terminal.Fd()) {
+		return nil
+	}
+
+	return terminal
+}
+
+// Returns the amount and total size of the files that have tools to be compressed with.
+func countOperatedFiles(operatedFiles []*OperatedFiles) (count int, size int64) {
+	for _, operation := range operatedFiles {
+		if len(operation.BatchableTools) == 0 && len(operation.PerFileTools) == 0 && len(operation.Chains) == 0 {
+			continue
+		}
+
+		for _, path := range operation.Paths {
+			info, err := os.Stat(path)
+			if err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			count++
+			size += info.Size()
+		}
+	}
+
+	return count, size
+}
+
 func (cli *CLIArguments) ToolOutput() io.Writer {
 	if cli.ToolPrint {
-		return os.Stdout
+		return prints.Output
 	} else {
 		return io.Discard
 	}
@@ -429,28 +996,76 @@ func printHelp() {
 	blue := color.New(color.FgBlue).SprintFunc()
 
 	fmt.Fprintf(os.Stderr, `Compress files by using multiple compression tools and pick the best result.
-%s compacty [OPTIONS] <files>...
+%s compacty [OPTIONS] <files or directories>...
+       compacty [OPTIONS] - < input > output
 
 %s
   -p, --preset=NAME     Select preset (run tool with --list to see all available presets)
   -c, --config=PATH     Use a config file from a given path instead from your config directory
-  -t, --tools=TOOL,...  Select available tools. Separated by commas (example: --tools=ect,pingo)
-  -a, --all             Use all available tools. Flag is ignored when using --tools
+  -t, --tools=TOOL,...  Select available tools or chains. Separated by commas (example: --tools=ect,pingo)
+  -a, --all             Use all available tools and chains. Flag is ignored when using --tools
+
+  Use - to compress stdin and write the best result (or the original if nothing is smaller) to stdout.
+  Messages are written to stderr instead
+
+  Directories are walked recursively. Files with unsupported formats inside them are skipped quietly
+      --include=GLOB,...
+                        Only compress files matching any of the patterns (example: --include='*.png,icons/**')
+      --exclude=GLOB,...
+                        Skip files and directories matching any of the patterns (example: --exclude='**/thumbnails')
+                        Patterns without "/" match file names, others match the path inside the given directory.
+                        "**" matches any amount of directories
+      --max-depth=N     Descend at most N directory levels into directories. 0 = files directly inside only (default: unlimited)
+      --newer-than=TIME, --since=TIME
+                        Only compress files modified within a duration (example: 24h) or after a date
+                        (examples: 2006-01-02, 2006-01-02T15:04:05)
+
+  -j, --jobs=N          Run at most N tool processes at once across all tools and files, larger files first.
+                        0 = amount of logical CPUs. Overrides jobs in the config file. Use 1 for uncontended timings
+      --timeout=DURATION
+                        Stop each tool process that runs longer than DURATION (example: --timeout=30s). 0 = no timeout.
+                        Overrides the timeouts in the config file
+      --nice=N          Run tools with niceness N, from -20 (highest priority) to 19 (lowest)
+      --io-priority=CLASS[:LEVEL]
+                        Run tools with an IO scheduling class (idle, best-effort or realtime) and level, from 0 (highest)
+                        to 7 (lowest) (example: --io-priority=best-effort:7)
+      --memory-limit=N  Limit the address space of each tool process to N bytes (examples: 512MiB, 2GB). Tools failing
+                        to allocate under the limit are reported as exceeding it
+      --cpu-affinity=CPUS
+                        Run tools only on the given CPUs (example: --cpu-affinity=0-3,6)
+                        Limits only apply on Linux and override the limits in the config file
   -q, --quiet           Suppress outputs
       --tool-print      Print tool outputs, ignores --quiet
+      --no-progress     Print tool messages line by line instead of showing live progress on terminals
+      --output-format=FORMAT
+                        Write results and --list/--list-args as text (default), json (a single document once done)
+                        or jsonl (a record per file as soon as it is done, then a summary) to stdout. Messages are
+                        written to stderr instead. See the README for the schema
       --no-colo[u]r     Disable coloured output
 
   -v, --version         Print version and exit
   -h, --help            Print usage help and exit
-  -l, --list            Print tools and presets from the loaded config file and exit
+  -l, --list            Print tools, chains and presets from the loaded config file and exit
       --list-args       Print tool arguments from the loaded config file and exit
       --list-args-raw   Print tool arguments from the loaded config file and exit. Shows hidden presets and preset includes are kept as is
       --reset-config    Resets the config file at your config directory to default. If using --config, creates/resets the file at --config instead
       --get-config-path Print the config path and exit
+      --prune-cache     Remove cached results that were not used within --cache-max-age, journal runs older than it, and exit
+      --undo[=RUN]      Restore the files overwritten by the last run (or the run with the given ID) and exit.
+                        Files that were modified after the run are not restored
 
 %s
-  -O, --overwrite       Overwrite input files
+  -O, --overwrite       Overwrite input files. The originals are backed up in a journal, see --undo
+      --backup-suffix=SUFFIX
+                        With --overwrite, keep the originals next to the files with SUFFIX appended (example: .orig)
       --keep-all        Keep all compressed files, including losing ones
+      --output-dir=DIR  Write results into DIR instead of next to the input files, keeping their file names. Paths inside
+                        given directories are mirrored, other files are placed relative to the working directory.
+                        Files that can't be compressed further are copied as is. With --keep-all, all results are written.
+                        Fails if two files would be written to the same path, such as files with the same name outside
+                        of the working directory
+      --preserve=LIST   Keep these attributes of the original on written files, comma separated: mode, owner (when permitted),
+                        times, xattr, all or none (example: --preserve=mode,times). Defaults to all with --overwrite, none otherwise
       --dry             Compress and show results only; keep files intact
 
 %s
@@ -458,15 +1073,207 @@ func printHelp() {
       --per-file        Force tools that batch files to compress one file at a time, intended for per-file benchmarking
       --force-rename    Automatically rename files with mislabeled extensions when prompted
       --no-rename       Skip renaming files with mislabeled extensions automatically when prompted
-
-      --decode-time     [EXPERIMENTAL] Measure decode time using Go's native libraries (PNG, JPEG, and GIF only)
+      --verify[=false]  Decode results and disqualify the ones with pixels different from the original (PNG, JPEG and GIF only).
+                        Enabled by default for presets marked as lossless, use --verify=false to disable
+      --quality         Score the perceptual quality of results with MS-SSIM (1 = no visible difference, PNG, JPEG and GIF only).
+                        Enabled if the preset has min-quality
+      --min-quality=N   Disqualify results with quality below N (0 to 1, example: --min-quality=0.97), along with results that
+                        cannot be scored (formats other than PNG, JPEG and GIF). Overrides the preset's min-quality
+      --metadata=POLICY Strip metadata from PNG and JPEG results according to POLICY, and disqualify results missing metadata it keeps.
+                        POLICY is strip-all, keep-color (colour profiles only), keep-all, unchanged, or a comma separated list
+                        of PNG chunks/JPEG segments to keep (example: --metadata=iCCP,eXIf,APP1). Overrides the preset's metadata
+      --select=STRATEGY Pick the result with the lowest score instead of the smallest one. STRATEGY is size, decode-time,
+                        weighted:<variable>=<weight>,... or expression:<expression>. Variables are size and decode (relative to
+                        the original), bytes, decode_ms, time (seconds taken by the tool), quality and quality_loss (MS-SSIM).
+                        Ties are won by the original, then by tool-priority in the config file. With decode-time, results
+                        not significantly slower than the fastest one are ties won by the smallest. Decode time and quality are
+                        measured if used (example: --select='expression:size * (1 - 0.005 * (decode <= 0.33))').
+                        Overrides the preset's selection
+      --min-saving=N    Keep the original unless the best result saves at least N, reporting it as not worth it otherwise.
+                        N is bytes (example: 4096, 4KB or 4KiB), a percentage (example: 0.5%%) or both, which must both be met
+                        (example: --min-saving=4KiB,0.5%%). Overrides the preset's min-saving
+      --temp-dir=DIR    Create temp files inside DIR instead of the system's temp directory (example: a tmpfs like /dev/shm).
+                        Each run uses its own directory inside DIR. Overrides temp-dir in the config file
+      --no-cache        Do not use or store cached results. Results are cached by input, tool, arguments and tool binary
+      --cache-max-age=TIME
+                        If using --prune-cache, remove cached results that were not used within this duration (default: 720h).
+                        Journal runs older than this are removed, along with all but the last 50 runs
+
+      --decode-time     [EXPERIMENTAL] Measure decode time using Go's native libraries (PNG, JPEG, and GIF only) and the
+                        decoders defined in the config file (any format, example: djpeg or dwebp), labelled by decoder
       --dt-measure=TIME If using --decode-time, measure decode time for at least the specified duration per file and their compression results
+      --dt-warmup=N     If using --decode-time, decode each file N times before measuring (default: 5)
+      --dt-pin          If using --decode-time, run every measurement on the same OS thread to reduce scheduling noise.
+                        Garbage is collected between measurements, and differences that are not statistically significant
+                        (Welch's t-test, p < 0.05) are marked and never highlighted as the fastest
 
       --skip-validation [UNSUPPORTED] Skip config validation. May cause runtime errors and/or crash. USE AT YOUR OWN RISK!
 
 `, blue("Usage:"), blue("Options:"), blue("Save modes:"), blue("Advanced options:"))
 }
 
+// Returns the decoders of the config that can run on this system, warning about the ones that can't.
+func availableDecoders(cfg *config.Config) (decoders []compressor.ExternalDecoder) {
+	for _, name := range maputils.SortedKeys(cfg.Decoders) {
+		decoder := cfg.Decoders[name]
+
+		command, ok := config.FindExecutablePath(decoder.Command, []string{runtime.GOOS})
+		if !ok {
+			prints.Warnf("Decoder %s is not available, cannot find %s. Skipping...\n", name, decoder.Command)
+			continue
+		}
+
+		decoders = append(decoders, compressor.ExternalDecoder{
+			Name:             name,
+			Command:          command,
+			Arguments:        decoder.Arguments,
+			SupportedFormats: decoder.SupportedFormats,
+		})
+	}
+
+	return decoders
+}
+
+func openCache() *cache.Cache {
+	cacheDir, err := cache.DefaultDir()
+	if err != nil {
+		prints.Warnf("Cannot retrieve cache directory, results are not cached: %v\n", err)
+		return nil
+	}
+
+	resultCache, err := cache.Open(cacheDir)
+	if err != nil {
+		prints.Warnf("Cannot open cache at %s, results are not cached: %v\n", cacheDir, err)
+		return nil
+	}
+
+	return resultCache
+}
+
+func pruneCache(maxAge time.Duration) (err error) {
+	cacheDir, err := cache.DefaultDir()
+	if err != nil {
+		return fmt.Errorf("cannot retrieve cache directory: %w", err)
+	}
+
+	resultCache, err := cache.Open(cacheDir)
+	if err != nil {
+		return fmt.Errorf("cannot open cache at %s: %w", cacheDir, err)
+	}
+
+	removedEntries, removedOutputs, freedBytes, err := resultCache.Prune(maxAge)
+	if err != nil {
+		return fmt.Errorf("cannot prune cache at %s: %w", cacheDir, err)
+	}
+
+	prints.Printf(
+		"Removed %d cached %s and %d cached %s (%d B) from %s.\n",
+		removedEntries, textutils.PluralNoun(removedEntries, "results", "result"),
+		removedOutputs, textutils.PluralNoun(removedOutputs, "outputs", "output"),
+		freedBytes, cacheDir,
+	)
+
+	journalDir, err := journal.DefaultDir()
+	if err != nil {
+		return fmt.Errorf("cannot retrieve journal directory: %w", err)
+	}
+
+	runJournal, err := journal.Open(journalDir)
+	if err != nil {
+		return fmt.Errorf("cannot open journal at %s: %w", journalDir, err)
+	}
+
+	removedRuns, freedBytes, err := runJournal.Prune(maxAge, maxJournalRuns)
+	if err != nil {
+		return fmt.Errorf("cannot prune journal at %s: %w", journalDir, err)
+	}
+
+	prints.Printf(
+		"Removed %d journal %s (%d B) from %s.\n",
+		removedRuns, textutils.PluralNoun(removedRuns, "runs", "run"),
+		freedBytes, journalDir,
+	)
+
+	return nil
+}
+
+// Opens the journal and starts a run. Runs older than `maxAge` or beyond the newest `maxJournalRuns` are removed.
+func openJournalRun(maxAge time.Duration) (run *journal.Run, err error) {
+	journalDir, err := journal.DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+
+	runJournal, err := journal.Open(journalDir)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, err = runJournal.Prune(maxAge, maxJournalRuns)
+	if err != nil {
+		prints.Warnf("Cannot remove old runs from the journal at %s: %v\n", journalDir, err)
+	}
+
+	return runJournal.NewRun(), nil
+}
+
+func undoRun(id string) (err error) {
+	journalDir, err := journal.DefaultDir()
+	if err != nil {
+		return fmt.Errorf("cannot retrieve journal directory: %w", err)
+	}
+
+	runJournal, err := journal.Open(journalDir)
+	if err != nil {
+		return fmt.Errorf("cannot open journal at %s: %w", journalDir, err)
+	}
+
+	if id == undoLastRun {
+		id = ""
+	}
+
+	run, err := runJournal.Run(id)
+	if errors.Is(err, journal.ErrUnknownRun) {
+		writeRuns(runJournal)
+		return &ExitCodeError{Err: fmt.Errorf("unknown run: %s", id), Code: BadUsage}
+	} else if errors.Is(err, journal.ErrNoRuns) {
+		prints.Println("No runs to undo.")
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("cannot read journal at %s: %w", journalDir, err)
+	}
+
+	prints.Println(color.BlueString("Undoing run:"), run.ID)
+
+	restored, errs := run.Undo()
+	for _, err := range errs {
+		prints.Warnf("Cannot restore %v\n", err)
+	}
+
+	prints.Printf("Restored %d %s.\n", restored, textutils.PluralNoun(restored, "files", "file"))
+	if len(errs) > 0 {
+		return fmt.Errorf("%d %s not restored, run %s is kept", len(errs), textutils.PluralNoun(len(errs), "files are", "file is"), run.ID)
+	}
+
+	return nil
+}
+
+func writeRuns(runJournal *journal.Journal) {
+	runs, err := runJournal.Runs()
+	if err != nil || len(runs) == 0 {
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString("Recorded runs:\n")
+	for _, run := range runs {
+		fileText := textutils.PluralNoun(len(run.Entries), "files", "file")
+		fmt.Fprintf(&builder, "| %s: %d %s overwritten\n", run.ID, len(run.Entries), fileText)
+	}
+
+	fmt.Fprint(os.Stderr, builder.String())
+}
+
 func listArgs(cfg *config.Config, configPath string, mode ListArgsMode) {
 	var builder strings.Builder
 
@@ -529,9 +1336,10 @@ func list(cfg *config.Config, configPath string) {
 	builder.WriteString("\n\n")
 
 	writeTools(&builder, cfg)
+	writeChains(&builder, cfg)
 	writePresets(&builder, cfg)
 
-	fmt.Print(builder.String())
+	fmt.Fprint(prints.Output, builder.String())
 }
 
 func writeTools(builder *strings.Builder, cfg *config.Config) {
@@ -566,6 +1374,39 @@ func writeTools(builder *strings.Builder, cfg *config.Config) {
 	}
 }
 
+func writeChains(builder *strings.Builder, cfg *config.Config) {
+	if len(cfg.Chains) == 0 {
+		return
+	}
+
+	builder.WriteString(color.BlueString("Chains:\n"))
+
+	sortedChainNames := maputils.SortedKeys(cfg.Chains)
+	for _, chainName := range sortedChainNames {
+		chain := cfg.Chains[chainName]
+
+		builder.WriteString(chainName)
+		if cfg.IsToolAvailable(chainName) {
+			builder.WriteByte(' ')
+			builder.WriteString(color.CyanString("(available)"))
+		}
+
+		builder.WriteByte('\n')
+
+		builder.WriteString("| Description:\n|   ")
+		builder.WriteString(chain.Description)
+		builder.WriteByte('\n')
+
+		builder.WriteString("| Tools:\n|   ")
+		builder.WriteString(strings.Join(chain.Tools, " -> "))
+		builder.WriteByte('\n')
+
+		builder.WriteString("| Supported file formats:\n|   ")
+		builder.WriteString(strings.Join(cfg.GetChainSupportedFormats(chainName), ", "))
+		builder.WriteString("\n\n")
+	}
+}
+
 func writePresets(builder *strings.Builder, cfg *config.Config) {
 	builder.WriteString(color.BlueString("Presets:\n"))
 
@@ -8,11 +8,13 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/ArrayNone/compacty/internal/compressor"
 	"github.com/ArrayNone/compacty/internal/config"
 	"github.com/ArrayNone/compacty/internal/prints"
 	"github.com/ArrayNone/compacty/internal/report"
+	"github.com/ArrayNone/compacty/internal/textutils"
 
 	"github.com/gabriel-vasile/mimetype"
 )
@@ -24,8 +26,12 @@ type OperatedFiles struct {
 	Extension string
 	Mime      string
 
+	RelativePaths map[string]string    // Where the results of each path are written inside the output directory
+	AccessTimes   map[string]time.Time // Access times of each path before they're read, to preserve on results
+
 	PerFileTools   map[string]compressor.ExecutedTool
 	BatchableTools map[string]compressor.ExecutedTool
+	Chains         map[string]compressor.ExecutedChain
 }
 
 const (
@@ -34,13 +40,21 @@ const (
 	ForceDecline
 )
 
-func PathsToOperatedFiles(cfg *config.Config, paths []string, renameMode RenameMode) (operations []*OperatedFiles) {
+func PathsToOperatedFiles(cfg *config.Config, inputs []InputPath, renameMode RenameMode) (operations []*OperatedFiles) {
 	pathCollection := make(map[string][]string)
+	relativePaths := make(map[string]string, len(inputs))
+	accessTimes := make(map[string]time.Time, len(inputs))
 
 	fileFormats := cfg.GetSupportedFileFormats()
 	fileExtensions := cfg.GetSupportedFileExtensions()
 
-	for _, path := range paths {
+	unsupportedCount := 0
+	for _, input := range inputs {
+		path := input.Path
+
+		// Detecting the MIME type reads the file
+		accessTime := compressor.FileAccessTime(path)
+
 		mime, err := mimetype.DetectFile(path)
 		if err != nil {
 			prints.Warnf("Cannot detect MIME type of %s: %v. Skipping...\n", path, err)
@@ -50,6 +64,12 @@ func PathsToOperatedFiles(cfg *config.Config, paths []string, renameMode RenameM
 		mimeString := mime.String()
 		fileExtension := filepath.Ext(path)
 		if !slices.Contains(fileFormats, mimeString) {
+			// Directories usually contain other files, don't warn about every one of them
+			if input.IsFromDirectory {
+				unsupportedCount++
+				continue
+			}
+
 			prints.Warnf(
 				"File format of %s (%s) is unsupported. Skipping...\n",
 				path, mimeString,
@@ -71,6 +91,14 @@ func PathsToOperatedFiles(cfg *config.Config, paths []string, renameMode RenameM
 			usedPath = path
 		}
 
+		relativePath := input.RelativePath
+		if usedPath != path {
+			relativePath = strings.TrimSuffix(relativePath, fileExtension) + filepath.Ext(usedPath)
+		}
+
+		relativePaths[usedPath] = relativePath
+		accessTimes[usedPath] = accessTime
+
 		collection, ok := pathCollection[mimeString]
 		if !ok {
 			collection = make([]string, 0)
@@ -80,12 +108,20 @@ func PathsToOperatedFiles(cfg *config.Config, paths []string, renameMode RenameM
 		pathCollection[mimeString] = collection
 	}
 
+	if unsupportedCount > 0 {
+		fileText := textutils.PluralNoun(unsupportedCount, "files", "file")
+		prints.Printf("Skipped %d %s with unsupported formats found in directories.\n", unsupportedCount, fileText)
+	}
+
 	operations = make([]*OperatedFiles, 0, len(pathCollection))
 	for mimeString, mimePaths := range pathCollection {
 		operations = append(operations, &OperatedFiles{
 			Paths:     mimePaths,
 			Extension: fileExtensions[mimeString][0],
 			Mime:      mimeString,
+
+			RelativePaths: relativePaths,
+			AccessTimes:   accessTimes,
 		},
 		)
 	}
@@ -93,6 +129,26 @@ func PathsToOperatedFiles(cfg *config.Config, paths []string, renameMode RenameM
 	return operations
 }
 
+// Returns an error if the results of two different files would be written to the same path inside the output
+// directory, such as files with the same name given from outside of the working directory.
+func CheckOutputDirPaths(operations []*OperatedFiles) error {
+	writtenBy := make(map[string]string)
+	for _, operation := range operations {
+		for _, path := range operation.Paths {
+			relativePath := filepath.Clean(operation.RelativePaths[path])
+
+			other, ok := writtenBy[relativePath]
+			if ok && other != path {
+				return fmt.Errorf("results of %s and %s would both be written to %s", other, path, relativePath)
+			}
+
+			writtenBy[relativePath] = path
+		}
+	}
+
+	return nil
+}
+
 func (of *OperatedFiles) WriteReport(process *compressor.CompressionProcess) (err error) {
 	reportDir, _ := filepath.Split(of.Paths[0])
 	compressReport, err := report.NewCompressReport(reportDir, of.Extension)
@@ -117,14 +173,56 @@ func (of *OperatedFiles) WriteReport(process *compressor.CompressionProcess) (er
 	return nil
 }
 
-func (of *OperatedFiles) SetTools(cfg *config.Config, preset string, toolNames []string) {
+func (of *OperatedFiles) WriteJSONFile(jsonWriter *report.JSONWriter, process *compressor.CompressionProcess, fileIdx int) (err error) {
+	err = jsonWriter.WriteFile(process, fileIdx, of.Mime, of.Chains)
+	if err != nil {
+		prints.Warnf("Cannot write the results of %s as JSON: %v\n", process.OriginalFileInfo[fileIdx].Path, err)
+	}
+
+	return err
+}
+
+// Sets the tools and chains from `toolNames` that can compress this file format. Chains that cannot run are skipped
+// with a warning if `isRequested`, as in selected by the user rather than by a preset.
+func (of *OperatedFiles) SetTools(cfg *config.Config, preset string, toolNames []string, isRequested bool) {
 	perFileTools := make(map[string]compressor.ExecutedTool)
 	batchableTools := make(map[string]compressor.ExecutedTool)
+	chains := make(map[string]compressor.ExecutedChain)
 
 	for _, toolName := range toolNames {
+		if cfg.IsChain(toolName) {
+			if !cfg.IsToolAvailable(toolName) {
+				if isRequested {
+					prints.Warnf("Chain %s is unavailable, not all of its tools can run on this system. Skipping...\n", toolName)
+				}
+
+				continue
+			}
+
+			if !slices.Contains(cfg.GetChainSupportedFormats(toolName), of.Mime) {
+				if isRequested {
+					prints.Warnf("Chain %s does not support file format %s (%s). Skipping...\n", toolName, of.Extension, of.Mime)
+				}
+
+				continue
+			}
+
+			executedChain, ok := compressor.ChainConfigToExecutedChain(cfg, toolName, preset)
+			if !ok {
+				if isRequested {
+					prints.Warnf("Cannot run chain %s with preset %s, check its tools and their arguments. Skipping...\n", toolName, preset)
+				}
+
+				continue
+			}
+
+			chains[toolName] = executedChain
+			continue
+		}
+
 		tool, ok := cfg.Tools[toolName]
 		if !ok {
-			prints.Warnf("Attempting to run unknown tool %s. Skipping...", toolName)
+			prints.Warnf("Attempting to run unknown tool %s. Skipping...\n", toolName)
 			continue
 		}
 
@@ -141,6 +239,9 @@ func (of *OperatedFiles) SetTools(cfg *config.Config, preset string, toolNames [
 			continue
 		}
 
+		executedTool.TimeLimit = cfg.GetToolTimeout(preset, toolName)
+		executedTool.Limits = cfg.GetToolLimits(toolName)
+
 		if tool.CanBatchCompress() {
 			batchableTools[toolName] = executedTool
 		} else {
@@ -150,10 +251,43 @@ func (of *OperatedFiles) SetTools(cfg *config.Config, preset string, toolNames [
 
 	of.BatchableTools = batchableTools
 	of.PerFileTools = perFileTools
+	of.Chains = chains
 }
 
 func (of *OperatedFiles) SetDefaultTools(cfg *config.Config, preset, mime string) {
-	of.SetTools(cfg, preset, cfg.Presets[preset].DefaultTools[mime])
+	of.SetTools(cfg, preset, cfg.Presets[preset].DefaultTools[mime], false)
+}
+
+// Replaces the timeout of every tool, including the tools in chains. 0 disables timeouts.
+func (of *OperatedFiles) SetTimeout(timeout time.Duration) {
+	for _, tools := range []map[string]compressor.ExecutedTool{of.PerFileTools, of.BatchableTools} {
+		for name, tool := range tools {
+			tool.TimeLimit = timeout
+			tools[name] = tool
+		}
+	}
+
+	for _, chain := range of.Chains {
+		for i := range chain.Stages {
+			chain.Stages[i].TimeLimit = timeout
+		}
+	}
+}
+
+// Overrides the limits of every tool, including the tools in chains, with the limits set in `limits`.
+func (of *OperatedFiles) OverrideLimits(limits config.Limits) {
+	for _, tools := range []map[string]compressor.ExecutedTool{of.PerFileTools, of.BatchableTools} {
+		for name, tool := range tools {
+			tool.Limits = tool.Limits.Override(limits)
+			tools[name] = tool
+		}
+	}
+
+	for _, chain := range of.Chains {
+		for i := range chain.Stages {
+			chain.Stages[i].Limits = chain.Stages[i].Limits.Override(limits)
+		}
+	}
 }
 
 func (of *OperatedFiles) ForcePerFileMode() {
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/prints"
+)
+
+func TestCheckOutputDirPaths(t *testing.T) {
+	tests := []struct {
+		name          string
+		relativePaths map[string]string
+		wantErr       string
+	}{
+		{
+			name: "distinct paths",
+			relativePaths: map[string]string{
+				"assets/icon.png":     "icon.png",
+				"assets/img/icon.png": "img/icon.png",
+				"logo.png":            "logo.png",
+			},
+		},
+		{
+			name: "same name outside of the working directory",
+			relativePaths: map[string]string{
+				"../a/icon.png": "icon.png",
+				"../b/icon.png": "icon.png",
+			},
+			wantErr: "would both be written to icon.png",
+		},
+		{
+			name: "same path inside two directories",
+			relativePaths: map[string]string{
+				"first/img/x.png":  "img/x.png",
+				"second/img/x.png": "img//x.png",
+			},
+			wantErr: "would both be written to img/x.png",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			operation := &OperatedFiles{RelativePaths: test.relativePaths}
+			for path := range test.relativePaths {
+				operation.Paths = append(operation.Paths, path)
+			}
+
+			err := CheckOutputDirPaths([]*OperatedFiles{operation})
+			if test.wantErr == "" && err != nil {
+				t.Errorf("CheckOutputDirPaths() error = %v, want nil", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("CheckOutputDirPaths() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestOperatedFiles_SetToolsWarnsAboutChains(t *testing.T) {
+	tool := func(command string, formats ...string) *config.ToolConfig {
+		return &config.ToolConfig{
+			Arguments: map[string][]string{"default": {}},
+			CompressionTool: config.CompressionTool{
+				Command:          command,
+				Platform:         []string{runtime.GOOS},
+				SupportedFormats: formats,
+				OutputMode:       config.Stdout,
+			},
+		}
+	}
+
+	cfg := &config.Config{
+		Tools: map[string]*config.ToolConfig{
+			"cat":     tool("cat", "image/png"),
+			"missing": tool("compacty-missing-tool", "image/png"),
+		},
+		Chains: map[string]*config.Chain{
+			"cat-twice":   {Tools: []string{"cat", "cat"}},
+			"with-broken": {Tools: []string{"cat", "cat@broken"}},
+			"unavailable": {Tools: []string{"cat", "missing"}},
+		},
+	}
+	cfg.Cache()
+
+	tests := []struct {
+		name        string
+		mime        string
+		chain       string
+		wantWarning string // Empty if the chain is used
+	}{
+		{name: "usable", mime: "image/png", chain: "cat-twice"},
+		{name: "unavailable", mime: "image/png", chain: "unavailable", wantWarning: "Chain unavailable is unavailable"},
+		{name: "unsupported format", mime: "image/jpeg", chain: "cat-twice", wantWarning: "does not support file format"},
+		{name: "cannot be built", mime: "image/png", chain: "with-broken", wantWarning: "Cannot run chain with-broken"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var warnings bytes.Buffer
+			prints.ErrOutput = &warnings
+			t.Cleanup(func() { prints.ErrOutput = os.Stderr })
+
+			for _, isRequested := range []bool{false, true} {
+				warnings.Reset()
+				operation := &OperatedFiles{Mime: test.mime}
+				operation.SetTools(cfg, "default", []string{test.chain}, isRequested)
+
+				_, isUsed := operation.Chains[test.chain]
+				if isUsed != (test.wantWarning == "") {
+					t.Errorf("SetTools() used %s = %v, want %v", test.chain, isUsed, test.wantWarning == "")
+				}
+
+				switch {
+				case !isRequested && warnings.Len() > 0:
+					t.Errorf("SetTools() of a preset's chain warned: %s", warnings.String())
+				case isRequested && !strings.Contains(warnings.String(), test.wantWarning):
+					t.Errorf("SetTools() warned %q, want %q", warnings.String(), test.wantWarning)
+				case isRequested && test.wantWarning == "" && warnings.Len() > 0:
+					t.Errorf("SetTools() of a usable chain warned: %s", warnings.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/ArrayNone/compacty/internal/config"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+const StdinPath = "-"
+
+const (
+	maxStdinSize    = 4 << 30 // Guards the temp directory against endless input
+	stdinHeaderSize = 3072    // Bytes needed to detect the file format, see `mimetype.SetLimit()`
+)
+
+var errStreamClosed = errors.New("stream is already closed")
+
+// Copies `stdin` into a temp file named with the extension of its detected file format, so that tools can compress it
+// like any other file. The input is spooled to disk rather than memory and must not exceed `maxStdinSize`. The temp
+// file is created inside `dir`. Returns the temp file's path.
+func BufferStdin(cfg *config.Config, stdin io.Reader, dir string) (path string, err error) {
+	header := make([]byte, stdinHeaderSize)
+	headerSize, err := io.ReadFull(stdin, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+
+	header = header[:headerSize]
+	if len(header) == 0 {
+		return "", errors.New("no input given")
+	}
+
+	mimeString := mimetype.Detect(header).String()
+	extensions, ok := cfg.GetSupportedFileExtensions()[mimeString]
+	if !ok || len(extensions) == 0 {
+		return "", fmt.Errorf("file format %s is unsupported", mimeString)
+	}
+
+	file, err := os.CreateTemp(dir, "stdin-*"+extensions[0])
+	if err != nil {
+		return "", err
+	}
+
+	_, err = file.Write(header)
+	if err == nil {
+		var size int64
+		size, err = io.Copy(file, io.LimitReader(stdin, maxStdinSize-int64(len(header))+1))
+		if err == nil && size+int64(len(header)) > maxStdinSize {
+			err = fmt.Errorf("input is larger than %s", config.ByteSize(maxStdinSize))
+		}
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// Receives the result of a file read from stdin. Pipelines always get a file: if no result is written, the original
+// input is written as is with `WriteOriginal()`.
+type StdinStream struct {
+	Path   string // The buffered input, see `BufferStdin()`
+	Writer io.Writer
+
+	mutex     sync.Mutex
+	isWritten bool
+	isClosed  bool
+}
+
+func (s *StdinStream) Write(data []byte) (n int, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isClosed {
+		return 0, errStreamClosed
+	}
+
+	s.isWritten = true
+	return s.Writer.Write(data)
+}
+
+// Writes the original input unless a result has been written, then closes the stream. Safe to call more than once and
+// while a result is being written, e.g. when aborting.
+func (s *StdinStream) WriteOriginal() (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isClosed {
+		return nil
+	}
+
+	s.isClosed = true
+	if s.isWritten {
+		return nil
+	}
+
+	file, err := os.Open(s.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(s.Writer, file)
+	return err
+}
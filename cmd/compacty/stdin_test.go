@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func TestBufferStdin(t *testing.T) {
+	cfg := &config.Config{
+		Tools: map[string]*config.ToolConfig{
+			"png-tool": {
+				CompressionTool: config.CompressionTool{
+					Command:          "png-tool",
+					Platform:         []string{runtime.GOOS},
+					SupportedFormats: []string{"image/png"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		wantErr string
+	}{
+		{name: "small png", input: append(pngSignature, "data"...)},
+		{name: "png larger than the header", input: append(pngSignature, bytes.Repeat([]byte("data"), stdinHeaderSize)...)},
+		{name: "empty", wantErr: "no input given"},
+		{name: "unsupported format", input: []byte("plain text"), wantErr: "is unsupported"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path, err := BufferStdin(cfg, bytes.NewReader(test.input), dir)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("BufferStdin() error = %v, want %q", err, test.wantErr)
+				}
+
+				if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+					t.Errorf("BufferStdin() left %d files behind", len(entries))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("BufferStdin() error = %v", err)
+			}
+
+			if filepath.Dir(path) != dir || filepath.Ext(path) != ".png" {
+				t.Errorf("BufferStdin() path = %s, want a .png file inside %s", path, dir)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(data, test.input) {
+				t.Errorf("buffered %d bytes, %v, want the %d bytes of the input", len(data), err, len(test.input))
+			}
+		})
+	}
+}
+
+func TestStdinStream(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdin.png")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("without a result", func(t *testing.T) {
+		var output bytes.Buffer
+		stream := &StdinStream{Path: path, Writer: &output}
+		if err := stream.WriteOriginal(); err != nil {
+			t.Fatalf("WriteOriginal() error = %v", err)
+		}
+
+		if err := stream.WriteOriginal(); err != nil || output.String() != "original" {
+			t.Errorf("output = %q, %v, want the original input once", output.String(), err)
+		}
+
+		if _, err := stream.Write([]byte("late result")); !errors.Is(err, errStreamClosed) {
+			t.Errorf("Write() after WriteOriginal() error = %v, want %v", err, errStreamClosed)
+		}
+	})
+
+	t.Run("with a result", func(t *testing.T) {
+		var output bytes.Buffer
+		stream := &StdinStream{Path: path, Writer: &output}
+		if _, err := stream.Write([]byte("result")); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+
+		if err := stream.WriteOriginal(); err != nil || output.String() != "result" {
+			t.Errorf("output = %q, %v, want the result only", output.String(), err)
+		}
+	})
+}
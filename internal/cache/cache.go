@@ -0,0 +1,346 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stores compression results on disk, keyed by the input file's content and everything that can change a tool's
+// output (tool name, resolved arguments and the tool's binary). Entries hold the result's size, and the output
+// itself if the result won.
+type Cache struct {
+	Dir string
+}
+
+type Entry struct {
+	FinalSize  int64         `json:"final-size"`
+	TimeTaken  time.Duration `json:"time-taken"`
+	OutputHash string        `json:"output-hash,omitempty"` // Only set for winning results
+	PixelCheck string        `json:"pixel-check,omitempty"` // Outcome of the lossless verification, empty if not verified
+	Quality    *float64      `json:"quality,omitempty"`     // Perceptual quality, nil if not computed
+
+	UserTime   time.Duration `json:"user-time,omitempty"`
+	SystemTime time.Duration `json:"system-time,omitempty"`
+	PeakMemory int64         `json:"peak-memory,omitempty"` // Peak resident set size in bytes
+
+	MetadataChecked bool     `json:"metadata-checked,omitempty"`
+	MetadataRemoved []string `json:"metadata-removed,omitempty"` // Stripped to follow the metadata policy
+	MetadataMissing []string `json:"metadata-missing,omitempty"` // Kept by the metadata policy, but lacking in the result
+}
+
+type KeyPart struct {
+	Name      string
+	Arguments []string
+	Binary    string // Identifies the executable, see `BinaryIdentity()`
+}
+
+const keyVersion = "v1"
+
+const (
+	entriesDir = "entries"
+	blobsDir   = "blobs"
+)
+
+const rwxr_xr_x = 0755
+
+var ErrNoOutput = errors.New("cached output does not exist")
+
+var binaryHashes sync.Map // Path, size and modification time -> hash, see `fileIdentity()`
+
+// Returns the default cache directory located at `os.UserCacheDir()`.
+func DefaultDir() (dir string, err error) {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userCache, "compacty", "results"), nil
+}
+
+// Opens the cache at `dir`, creating it if it does not exist. Can return an error.
+func Open(dir string) (c *Cache, err error) {
+	for _, subDir := range []string{entriesDir, blobsDir} {
+		err = os.MkdirAll(filepath.Join(dir, subDir), rwxr_xr_x)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Cache{Dir: dir}, nil
+}
+
+// Returns the SHA-256 hash of the file at `path` as a hex string.
+func HashFile(path string) (hash string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Identifies an executable by the hash of its contents, so that updating a tool invalidates its cached results. If
+// the executable is run through `wrapper` (such as wine), the wrapper's binary is resolved and identified the same
+// way, so that updating the wrapper invalidates them too.
+func BinaryIdentity(executablePath, wrapper string) string {
+	identity := fileIdentity(executablePath)
+	if wrapper == "" {
+		return identity
+	}
+
+	wrapperPath, err := exec.LookPath(wrapper)
+	if err != nil {
+		wrapperPath = wrapper
+	}
+
+	return fileIdentity(wrapperPath) + " " + identity
+}
+
+// Returns the hash of the file at `path`, or `path` itself if it can't be read. Hashes are remembered by size and
+// modification time, as chains run the same tools.
+func fileIdentity(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return path
+	}
+
+	statKey := fmt.Sprintf("%s:%d:%d", path, info.Size(), info.ModTime().UnixNano())
+	if hash, ok := binaryHashes.Load(statKey); ok {
+		return hash.(string)
+	}
+
+	hash, err := HashFile(path)
+	if err != nil {
+		return statKey
+	}
+
+	binaryHashes.Store(statKey, hash)
+	return hash
+}
+
+// Builds the key of a result produced by the tool (or chain) named `name` from the input with `inputHash`.
+// Chains pass one part for each of their tools.
+func Key(inputHash, name string, parts ...KeyPart) string {
+	hasher := sha256.New()
+
+	write := func(field string) {
+		hasher.Write([]byte(field))
+		hasher.Write([]byte{0})
+	}
+
+	write(keyVersion)
+	write(inputHash)
+	write(name)
+
+	for _, part := range parts {
+		write(part.Name)
+		write(part.Binary)
+		write(strings.Join(part.Arguments, "\x00"))
+		write("") // Separate parts
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// Retrieves the entry with `key`. Returns the entry and `true` if it exists, `false` otherwise.
+func (c *Cache) Lookup(key string) (entry Entry, ok bool) {
+	path := c.entryPath(key)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return Entry{}, false
+	}
+
+	// Mark as recently used for pruning
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+
+	return entry, true
+}
+
+// Returns `true` if the output with `hash` is stored in the cache. Returns `false` otherwise.
+func (c *Cache) HasOutput(hash string) bool {
+	_, err := os.Stat(c.blobPath(hash))
+	return err == nil
+}
+
+// Stores `entry` with `key`, replacing the existing entry if any. Can return an error.
+func (c *Cache) Store(key string, entry Entry) (err error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := c.entryPath(key)
+	err = os.MkdirAll(filepath.Dir(path), rwxr_xr_x)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// Copies the file at `path` into the cache. Returns the hash the output is stored with.
+func (c *Cache) StoreOutput(path string) (hash string, err error) {
+	hash, err = HashFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if c.HasOutput(hash) {
+		return hash, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	blobPath := c.blobPath(hash)
+	err = os.MkdirAll(filepath.Dir(blobPath), rwxr_xr_x)
+	if err != nil {
+		return "", err
+	}
+
+	return hash, writeFileAtomic(blobPath, data)
+}
+
+// Copies the cached output with `hash` to `destination`. Returns `ErrNoOutput` if the output is not stored.
+func (c *Cache) RestoreOutput(hash, destination string) (err error) {
+	source, err := os.Open(c.blobPath(hash))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNoOutput
+	} else if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	file, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, source)
+	return err
+}
+
+// Removes entries that were not used within `maxAge`, then removes outputs that are no longer referenced by any
+// entry. Returns the amount of removed entries and outputs, and the size of the removed outputs in bytes.
+func (c *Cache) Prune(maxAge time.Duration) (removedEntries, removedOutputs int, freedBytes int64, err error) {
+	cutoff := time.Now().Add(-maxAge)
+	referenced := make(map[string]struct{})
+
+	err = filepath.WalkDir(filepath.Join(c.Dir, entriesDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().Before(cutoff) {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+
+			removedEntries++
+			return nil
+		}
+
+		var entry Entry
+		data, err := os.ReadFile(path)
+		if err == nil && json.Unmarshal(data, &entry) == nil && entry.OutputHash != "" {
+			referenced[entry.OutputHash] = struct{}{}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return removedEntries, removedOutputs, freedBytes, err
+	}
+
+	err = filepath.WalkDir(filepath.Join(c.Dir, blobsDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		if _, ok := referenced[d.Name()]; ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// Might be written by another run at the moment
+		if strings.HasPrefix(d.Name(), ".tmp-") && info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		removedOutputs++
+		freedBytes += info.Size()
+		return nil
+	})
+
+	return removedEntries, removedOutputs, freedBytes, err
+}
+
+func (c *Cache) entryPath(key string) string {
+	return filepath.Join(c.Dir, entriesDir, key[:2], key+".json")
+}
+
+func (c *Cache) blobPath(hash string) string {
+	return filepath.Join(c.Dir, blobsDir, hash[:2], hash)
+}
+
+// Writes to a temporary file first, so that concurrent runs never read a partially written file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	file, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
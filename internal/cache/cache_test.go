@@ -0,0 +1,270 @@
+package cache_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/cache"
+)
+
+const inputHash = "0123456789abcdef"
+
+func writeFile(t *testing.T, path, data string, modTime time.Time) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	part := cache.KeyPart{Name: "oxipng", Arguments: []string{"-o", "max"}, Binary: "binary"}
+	base := cache.Key(inputHash, "oxipng", part)
+
+	if again := cache.Key(inputHash, "oxipng", part); again != base {
+		t.Fatalf("Key() is not stable: %q, then %q", base, again)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		equal bool
+	}{
+		{
+			name: "input",
+			key:  cache.Key("fedcba9876543210", "oxipng", part),
+		},
+		{
+			name: "name",
+			key:  cache.Key(inputHash, "oxipng-max", part),
+		},
+		{
+			name: "arguments",
+			key:  cache.Key(inputHash, "oxipng", cache.KeyPart{Name: "oxipng", Arguments: []string{"-o", "4"}, Binary: "binary"}),
+		},
+		{
+			name: "arguments split differently",
+			key:  cache.Key(inputHash, "oxipng", cache.KeyPart{Name: "oxipng", Arguments: []string{"-o max"}, Binary: "binary"}),
+		},
+		{
+			name: "binary",
+			key:  cache.Key(inputHash, "oxipng", cache.KeyPart{Name: "oxipng", Arguments: []string{"-o", "max"}, Binary: "updated"}),
+		},
+		{
+			name: "extra part",
+			key:  cache.Key(inputHash, "oxipng", part, cache.KeyPart{Name: "metadata-policy", Arguments: []string{"strip"}}),
+		},
+		{
+			name:  "copied arguments",
+			key:   cache.Key(inputHash, "oxipng", cache.KeyPart{Name: "oxipng", Arguments: append([]string{}, part.Arguments...), Binary: "binary"}),
+			equal: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if (test.key == base) != test.equal {
+				t.Errorf("Key() = %q, base key %q, want equal = %v", test.key, base, test.equal)
+			}
+		})
+	}
+
+	// Chains of the same tools in another order produce different results
+	first := cache.KeyPart{Name: "a"}
+	second := cache.KeyPart{Name: "b"}
+	if cache.Key(inputHash, "chain", first, second) == cache.Key(inputHash, "chain", second, first) {
+		t.Errorf("Key() ignores the order of parts")
+	}
+}
+
+func TestBinaryIdentity(t *testing.T) {
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "tool")
+	wrapper := filepath.Join(dir, "wrapper")
+
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	writeFile(t, tool, "tool v1", old)
+	writeFile(t, wrapper, "wrapper v1", old)
+
+	direct := cache.BinaryIdentity(tool, "")
+	wrapped := cache.BinaryIdentity(tool, wrapper)
+
+	if cache.BinaryIdentity(tool, "") != direct || cache.BinaryIdentity(tool, wrapper) != wrapped {
+		t.Fatalf("BinaryIdentity() is not stable")
+	}
+
+	if direct == wrapped {
+		t.Errorf("BinaryIdentity() ignores the wrapper")
+	}
+
+	// Updating the wrapper invalidates results of the tools run through it
+	writeFile(t, wrapper, "wrapper v2", old.Add(time.Hour))
+	if cache.BinaryIdentity(tool, wrapper) == wrapped {
+		t.Errorf("BinaryIdentity() is unchanged after the wrapper is updated")
+	}
+
+	if cache.BinaryIdentity(tool, "") != direct {
+		t.Errorf("BinaryIdentity() of the unwrapped tool changed after the wrapper is updated")
+	}
+
+	wrapped = cache.BinaryIdentity(tool, wrapper)
+
+	writeFile(t, tool, "tool v2", old.Add(2*time.Hour))
+	if cache.BinaryIdentity(tool, "") == direct || cache.BinaryIdentity(tool, wrapper) == wrapped {
+		t.Errorf("BinaryIdentity() is unchanged after the tool is updated")
+	}
+
+	// Only the contents matter, touching a binary keeps its results
+	direct = cache.BinaryIdentity(tool, "")
+	touched := old.Add(3 * time.Hour)
+	if err := os.Chtimes(tool, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+
+	if cache.BinaryIdentity(tool, "") != direct {
+		t.Errorf("BinaryIdentity() changed after the tool is touched")
+	}
+}
+
+func TestCache_StoreLookup(t *testing.T) {
+	c, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := cache.Key(inputHash, "tool")
+	if _, ok := c.Lookup(key); ok {
+		t.Fatalf("Lookup() of an empty cache = true, want false")
+	}
+
+	quality := 0.99
+	entry := cache.Entry{
+		FinalSize:       1234,
+		TimeTaken:       time.Second,
+		PixelCheck:      "OK",
+		Quality:         &quality,
+		MetadataChecked: true,
+		MetadataRemoved: []string{"tEXt"},
+	}
+
+	if err := c.Store(key, entry); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	got, ok := c.Lookup(key)
+	if !ok {
+		t.Fatalf("Lookup() = false after Store()")
+	}
+
+	if got.FinalSize != entry.FinalSize || got.TimeTaken != entry.TimeTaken || got.PixelCheck != entry.PixelCheck ||
+		got.Quality == nil || *got.Quality != quality || !got.MetadataChecked || len(got.MetadataRemoved) != 1 {
+		t.Errorf("Lookup() = %+v, want %+v", got, entry)
+	}
+
+	// Replaced by later stores
+	entry.FinalSize = 1000
+	if err := c.Store(key, entry); err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+
+	if got, _ := c.Lookup(key); got.FinalSize != 1000 {
+		t.Errorf("Lookup().FinalSize = %d after replacing, want 1000", got.FinalSize)
+	}
+}
+
+func TestCache_Output(t *testing.T) {
+	dir := t.TempDir()
+	c, err := cache.Open(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := filepath.Join(dir, "result.png")
+	writeFile(t, source, "compressed", time.Now())
+
+	hash, err := c.StoreOutput(source)
+	if err != nil {
+		t.Fatalf("StoreOutput() error = %v", err)
+	}
+
+	if !c.HasOutput(hash) {
+		t.Errorf("HasOutput() = false after StoreOutput()")
+	}
+
+	destination := filepath.Join(dir, "restored.png")
+	if err := c.RestoreOutput(hash, destination); err != nil {
+		t.Fatalf("RestoreOutput() error = %v", err)
+	}
+
+	if data, err := os.ReadFile(destination); err != nil || string(data) != "compressed" {
+		t.Errorf("restored output = %q, %v, want %q", data, err, "compressed")
+	}
+
+	missing := "ff" + hash[2:]
+	if err := c.RestoreOutput(missing, destination); !errors.Is(err, cache.ErrNoOutput) {
+		t.Errorf("RestoreOutput() of a missing output error = %v, want %v", err, cache.ErrNoOutput)
+	}
+}
+
+func TestCache_Prune(t *testing.T) {
+	dir := t.TempDir()
+	c, err := cache.Open(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storeWithOutput := func(name, output string) (key, hash string) {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, output, time.Now())
+
+		hash, err := c.StoreOutput(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key = cache.Key(inputHash, name)
+		if err := c.Store(key, cache.Entry{FinalSize: int64(len(output)), OutputHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+
+		return key, hash
+	}
+
+	staleKey, staleHash := storeWithOutput("stale", "stale output")
+	freshKey, freshHash := storeWithOutput("fresh", "fresh output")
+
+	// Entries are the only JSON files in the cache
+	stalePaths, err := filepath.Glob(filepath.Join(c.Dir, "*", "*", staleKey+".json"))
+	if err != nil || len(stalePaths) != 1 {
+		t.Fatalf("cannot find the stale entry: %v, %v", stalePaths, err)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(stalePaths[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	removedEntries, removedOutputs, freedBytes, err := c.Prune(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	if removedEntries != 1 || removedOutputs != 1 || freedBytes != int64(len("stale output")) {
+		t.Errorf("Prune() = %d, %d, %d, want 1, 1, %d", removedEntries, removedOutputs, freedBytes, len("stale output"))
+	}
+
+	if _, ok := c.Lookup(staleKey); ok || c.HasOutput(staleHash) {
+		t.Errorf("stale entry or its output is kept")
+	}
+
+	if _, ok := c.Lookup(freshKey); !ok || !c.HasOutput(freshHash) {
+		t.Errorf("fresh entry or its output is removed")
+	}
+}
@@ -0,0 +1,258 @@
+package compressor
+
+import (
+	"runtime"
+
+	"github.com/ArrayNone/compacty/internal/cache"
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/prints"
+
+	"github.com/fatih/color"
+)
+
+// Computes the cache keys of every file for `tools` and `chains`. If `allowHits` is `true`, files that have
+// cached results for all of the tools and chains are marked as cached and their results are loaded. Their
+// winning output is restored into a temp file, the other results only carry their size.
+//
+// Cached files are skipped by `CompressAll()` and should not be passed to `CompressSingle()`. Results of the other
+// files are stored to the cache on `SaveResultsAndReport()`. `VerifyPixels`, `ComputeQuality` and `Metadata` must be
+// set beforehand, results that were not verified or scored are not used while verifying or scoring.
+func (c *CompressionProcess) LoadCache(
+	resultCache *cache.Cache,
+	tools map[string]ExecutedTool,
+	chains map[string]ExecutedChain,
+	allowHits bool,
+) {
+
+	c.cache = resultCache
+	c.cacheKeys = make(map[string][]string, len(tools)+len(chains))
+	c.cachedFiles = make([]bool, len(c.OriginalFileInfo))
+
+	keyParts := make(map[string][]cache.KeyPart, len(tools)+len(chains))
+	for name, tool := range tools {
+		keyParts[name] = []cache.KeyPart{c.cacheKeyPart(name, tool)}
+	}
+
+	for name, chain := range chains {
+		parts := make([]cache.KeyPart, 0, len(chain.Stages))
+		for _, stage := range chain.Stages {
+			parts = append(parts, c.cacheKeyPart(stage.Name, stage.ExecutedTool))
+		}
+
+		keyParts[name] = parts
+	}
+
+	// Results are stripped according to the policy, so each policy has its own results
+	if c.Metadata.IsEnforced() {
+		for name, parts := range keyParts {
+			keyParts[name] = append(parts, cache.KeyPart{Name: "metadata-policy", Arguments: []string{c.Metadata.String()}})
+		}
+	}
+
+	for name := range keyParts {
+		c.cacheKeys[name] = make([]string, len(c.OriginalFileInfo))
+	}
+
+	for i, fileInfo := range c.OriginalFileInfo {
+		hash, err := cache.HashFile(fileInfo.Path)
+		if err != nil {
+			prints.Warnf("Cannot hash %s, results are not cached: %v\n", fileInfo.Path, err)
+			continue
+		}
+
+		for name, parts := range keyParts {
+			c.cacheKeys[name][i] = cache.Key(hash, name, parts...)
+		}
+
+		if allowHits && c.loadCachedFile(i) {
+			c.cachedFiles[i] = true
+			prints.Println("Using cached results for", color.CyanString(fileInfo.Path))
+		}
+	}
+}
+
+// Returns `true` if the results of the file at `fileIdx` are loaded from the cache. Returns `false` otherwise.
+func (c *CompressionProcess) IsCached(fileIdx int) bool {
+	return c.cachedFiles != nil && c.cachedFiles[fileIdx]
+}
+
+// Returns the indices of files that have to be compressed.
+func (c *CompressionProcess) UncachedIndices() (indices []int) {
+	indices = make([]int, 0, len(c.OriginalFileInfo))
+	for i := range c.OriginalFileInfo {
+		if !c.IsCached(i) {
+			indices = append(indices, i)
+		}
+	}
+
+	return indices
+}
+
+func (c *CompressionProcess) cacheKeyPart(name string, tool ExecutedTool) cache.KeyPart {
+	wrapper := config.QueryWrapper(c.Wrappers, tool.Platform, runtime.GOOS)
+	executablePath, _ := config.FindExecutablePath(tool.Command, tool.Platform)
+
+	return cache.KeyPart{
+		Name:      name,
+		Arguments: tool.Arguments,
+		Binary:    cache.BinaryIdentity(executablePath, wrapper),
+	}
+}
+
+func (c *CompressionProcess) loadCachedFile(fileIdx int) (ok bool) {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	// Only files that can be decoded have their quality stored
+	needsQuality := c.ComputeQuality && canDecodeImage(fileInfo.Path)
+
+	entries := make(map[string]cache.Entry, len(c.cacheKeys))
+	for name, keys := range c.cacheKeys {
+		entry, ok := c.cache.Lookup(keys[fileIdx])
+		if !ok {
+			return false
+		}
+
+		// Verify or score again if the previous run did not
+		if c.VerifyPixels && parsePixelCheck(entry.PixelCheck) == PixelsUnchecked {
+			return false
+		}
+
+		if needsQuality && entry.Quality == nil {
+			return false
+		}
+
+		entries[name] = entry
+	}
+
+	results := make(map[string]*CompressionResult, len(entries))
+	for name, entry := range entries {
+		result := &CompressionResult{
+			OriginalSize: fileInfo.Size,
+			FinalSize:    entry.FinalSize,
+			TimeTaken:    entry.TimeTaken,
+			Resources: ResourceUsage{
+				UserTime:   entry.UserTime,
+				SystemTime: entry.SystemTime,
+				PeakMemory: entry.PeakMemory,
+
+				IsMeasured: entry.UserTime > 0 || entry.SystemTime > 0 || entry.PeakMemory > 0,
+			},
+
+			IsCached: true,
+		}
+
+		if c.VerifyPixels {
+			result.Pixels = parsePixelCheck(entry.PixelCheck)
+		}
+
+		if c.ComputeQuality && entry.Quality != nil {
+			result.Quality = QualityScore{
+				Score:      *entry.Quality,
+				IsComputed: true,
+
+				IsBelowMinimum: c.isBelowMinQuality(entry.Quality),
+			}
+		}
+
+		if c.Metadata.IsEnforced() {
+			result.Metadata = MetadataCheck{
+				IsChecked: entry.MetadataChecked,
+				Removed:   entry.MetadataRemoved,
+				Missing:   entry.MetadataMissing,
+			}
+		}
+
+		results[name] = result
+	}
+
+	// Picked the same way as saveFileResult() so that the winner is the result with the stored output
+	selection, _ := c.fileSelection(fileIdx)
+	bestTool := c.scoreResults(fileIdx, selection, results)
+
+	var bestTempFile TempFile
+	if bestTool != "" {
+		bestEntry := entries[bestTool]
+		if bestEntry.OutputHash == "" || !c.cache.HasOutput(bestEntry.OutputHash) {
+			return false
+		}
+
+		bestTempFile.Path = compressedFilePath(fileInfo.TempDir, fileInfo.BaseName, bestTool, fileInfo.Extension)
+		err := c.cache.RestoreOutput(bestEntry.OutputHash, bestTempFile.Path)
+		if err != nil {
+			prints.Warnf("Cannot restore cached result of %s for %s: %v\n", bestTool, fileInfo.Path, err)
+			return false
+		}
+	}
+
+	for name, result := range results {
+		c.allocateResults(name)
+		c.Results[name][fileIdx] = result
+
+		if name == bestTool {
+			c.TempFiles[name][fileIdx] = bestTempFile
+		}
+	}
+
+	return true
+}
+
+func (c *CompressionProcess) isBelowMinQuality(quality *float64) bool {
+	return c.MinQuality > 0 && quality != nil && *quality < c.MinQuality
+}
+
+func (c *CompressionProcess) storeCachedResults(fileIdx int, bestTool string) {
+	if c.cache == nil || c.IsCached(fileIdx) {
+		return
+	}
+
+	for name, keys := range c.cacheKeys {
+		key := keys[fileIdx]
+		if key == "" {
+			continue
+		}
+
+		results, ok := c.Results[name]
+		if !ok {
+			continue
+		}
+
+		result := results[fileIdx]
+		// Metadata that could not be checked is checked again next time
+		if result == nil || result.HasError() || result.Metadata.Err != nil {
+			continue
+		}
+
+		entry := cache.Entry{
+			FinalSize:  result.FinalSize,
+			TimeTaken:  result.TimeTaken,
+			PixelCheck: result.Pixels.String(),
+
+			UserTime:   result.Resources.UserTime,
+			SystemTime: result.Resources.SystemTime,
+			PeakMemory: result.Resources.PeakMemory,
+
+			MetadataChecked: result.Metadata.IsChecked,
+			MetadataRemoved: result.Metadata.Removed,
+			MetadataMissing: result.Metadata.Missing,
+		}
+
+		if result.Quality.IsComputed {
+			entry.Quality = &result.Quality.Score
+		}
+
+		if name == bestTool {
+			hash, err := c.cache.StoreOutput(c.TempFiles[name][fileIdx].Path)
+			if err != nil {
+				prints.Warnf("Cannot cache the result of %s for %s: %v\n", name, c.OriginalFileInfo[fileIdx].Path, err)
+				continue
+			}
+
+			entry.OutputHash = hash
+		}
+
+		err := c.cache.Store(key, entry)
+		if err != nil {
+			prints.Warnf("Cannot cache the result of %s for %s: %v\n", name, c.OriginalFileInfo[fileIdx].Path, err)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package compressor
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -14,12 +16,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ArrayNone/compacty/internal/cache"
 	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/journal"
 	"github.com/ArrayNone/compacty/internal/maputils"
 	"github.com/ArrayNone/compacty/internal/prints"
 	"github.com/ArrayNone/compacty/internal/textutils"
 
 	"github.com/fatih/color"
+	"github.com/gabriel-vasile/mimetype"
 )
 
 type WriteMode int
@@ -29,6 +34,12 @@ const (
 	KeepAll                    // Copy all compressed files onto the same directory as the input file
 	Overwrite                  // Overwrites the input file with the best compressed file
 	None                       // Do not produce a new file even if the file is successfully compressed
+	Stream                     // Writes the best compressed file, or the original if none is better, to `ResultWriter`
+)
+
+const (
+	rwxr_xr_x = 0755
+	rw_r__r__ = 0644
 )
 
 type TempFile struct {
@@ -39,6 +50,17 @@ type TempFile struct {
 type ExecutedTool struct {
 	*config.CompressionTool
 	Arguments []string
+	TimeLimit time.Duration // Timeout resolved for the running preset. 0 = no timeout
+	Limits    config.Limits // Global limits overridden by the tool's own
+}
+
+type ChainStage struct {
+	ExecutedTool
+	Name string
+}
+
+type ExecutedChain struct {
+	Stages []ChainStage
 }
 
 type FileInfo struct {
@@ -49,9 +71,21 @@ type FileInfo struct {
 	BaseName  string
 	Extension string
 
-	Size int64
+	Size       int64
+	AccessTime time.Time // Preserved on results instead of the current access time if set, see `SetAccessTimes()`
+
+	RelativePath string // Where the results are written inside `CompressionProcess.OutputDir`
+	TempDir      string // Where the temp files of this file are created, see `UseWorkspace()`
+
+	Decodes []DecodeTimeBench // One for each of `CompressionProcess.DecoderNames`
+
+	Selection config.Selection // Selection the result is picked with, see `CompressionProcess.Selection`
+	Score     SelectionScore   // Score of the original with `Selection`
+	BestTool  string           // Tool of the picked result. Empty if no result beats the original
+
+	WrittenPath string // Where the picked result (or the original) is written. Empty if nothing is written
 
-	Decode DecodeTimeBench
+	isMetadataEnforced bool // Results are stripped by `enforceMetadata()`, which must only happen once
 }
 
 type CompressionResult struct {
@@ -60,6 +94,8 @@ type CompressionResult struct {
 	IsWrapped bool
 
 	TimeTaken time.Duration
+	Resources ResourceUsage // CPU time and peak memory of the tool process
+	Attempts  int           // Times the tool ran, including retries. For chains, the most of any stage. 0 if it didn't run
 
 	OriginalSize int64
 	FinalSize    int64
@@ -68,7 +104,22 @@ type CompressionResult struct {
 	CommandError       error
 	ReadFinalSizeError error
 
-	Decode DecodeTimeBench
+	Decodes []DecodeTimeBench // One for each of `CompressionProcess.DecoderNames`
+
+	Pixels      PixelCheck // Set if pixels are verified, see `CompressionProcess.VerifyPixels`
+	PixelsError error      // Why the pixels differ
+
+	Quality QualityScore // Set if quality is computed, see `CompressionProcess.ComputeQuality`
+
+	Metadata MetadataCheck // Set if the metadata policy is enforced, see `CompressionProcess.Metadata`
+
+	Score SelectionScore // Set once the result of the file is picked, see `CompressionProcess.Selection`
+
+	Stages []*CompressionResult // Results of each executed tool if the result comes from a chain
+
+	IsCached bool // Result is loaded from the cache, the tool did not run
+
+	WrittenPath string // Where the result is written. Empty if it is not written
 }
 
 type CompressionProcess struct {
@@ -79,10 +130,41 @@ type CompressionProcess struct {
 	Results  map[string][]*CompressionResult
 	Wrappers map[string]string
 
-	MinDecodeTime         time.Duration
+	DecodeBench           DecodeBenchOptions
+	Decoders              []ExternalDecoder // Benchmarked alongside Go's built-in decoders
+	DecoderNames          []string          // Decoders that measured at least one file, set by `BenchmarkDecodeTime()`
 	AreDecodeTimeComputed bool
 
-	toolOutput io.Writer
+	VerifyPixels   bool    // Decode and compare results with the original, disqualifying results that are not lossless
+	ComputeQuality bool    // Score the perceptual quality of results compared to the original
+	MinQuality     float64 // Results with quality below this are disqualified if `ComputeQuality` is set. 0 = no minimum
+
+	toolOutput   io.Writer
+	ResultWriter io.Writer     // Receives the result with the `Stream` write mode
+	OutputDir    string        // Results are written here instead of next to the input files if set
+	Preserve     PreserveFlags // Attributes of the original copied to written results
+
+	Journal      *journal.Run // Backs up and records overwritten files so that they can be restored. Not recorded if nil
+	BackupSuffix string       // Backups are kept next to overwritten files with this suffix instead of in `Journal`
+
+	Metadata config.MetadataPolicy // Metadata results must keep, enforced before picking the best result
+
+	Selection    config.Selection // How the best result is picked. Picks the smallest result if zero
+	ToolPriority []string         // Breaks ties between results with the same score, first listed wins
+
+	MinSaving config.MinSaving // The original is kept unless the best result saves at least this much
+
+	Scheduler *Scheduler // Limits running tool processes, shared across processes. Unlimited if nil
+
+	Progress ProgressListener // Notified as tools run and files are done. Replaces the command listings and tool messages if set
+
+	cache       *cache.Cache
+	cacheKeys   map[string][]string // Tool name -> cache key of each file
+	cachedFiles []bool
+
+	intermediateFiles []string
+	workspaceDirs     []string
+	intermediateMutex sync.Mutex
 }
 
 type compressionCommand struct {
@@ -91,11 +173,33 @@ type compressionCommand struct {
 	stdoutFile *os.File
 
 	toolName   string
+	tempName   string
 	arguments  []string
 	inputPaths []string
 	wrapper    string
 
-	timeTaken time.Duration
+	commandPath  string
+	commandArgs  []string
+	output       io.Writer         // Where the tool's output is written to, set by `setStdoutAndErr()`
+	copiedInputs map[string]string // Temp path -> original path of the inputs copied for tools that overwrite them
+
+	ctx           context.Context
+	commandCtx    context.Context
+	cancelCommand context.CancelCauseFunc
+
+	scheduler *Scheduler
+	priority  int64 // Size of the inputs, larger inputs are started first
+
+	cancelledAt time.Time // When the running attempt was asked to stop, see `newCommand()`
+
+	timeTaken time.Duration // Of the last attempt
+	resources ResourceUsage // Of the last attempt
+	attempts  int
+
+	progress  ProgressListener
+	filePaths []string // Original paths of the files compressed by the command
+
+	stderrTail *tailBuffer // Only kept for tools with a memory limit or retry patterns
 
 	commandError error
 	isAvailable  bool
@@ -107,9 +211,39 @@ func ToolConfigToExecutedTool(tool *config.ToolConfig, argPreset, toolName strin
 	return ExecutedTool{
 		CompressionTool: &tool.CompressionTool,
 		Arguments:       args,
+		TimeLimit:       tool.Timeout,
 	}, len(errs) == 0
 }
 
+func ChainConfigToExecutedChain(cfg *config.Config, chainName, preset string) (result ExecutedChain, ok bool) {
+	chain, ok := cfg.Chains[chainName]
+	if !ok {
+		return ExecutedChain{}, false
+	}
+
+	stages := chain.Stages()
+	result.Stages = make([]ChainStage, 0, len(stages))
+
+	for _, stage := range stages {
+		tool, ok := cfg.Tools[stage.Tool]
+		if !ok {
+			return ExecutedChain{}, false
+		}
+
+		executedTool, ok := ToolConfigToExecutedTool(tool, stage.ArgumentPreset(preset), stage.Tool)
+		if !ok {
+			return ExecutedChain{}, false
+		}
+
+		executedTool.TimeLimit = cfg.GetToolTimeout(preset, stage.Tool)
+		executedTool.Limits = cfg.GetToolLimits(stage.Tool)
+
+		result.Stages = append(result.Stages, ChainStage{ExecutedTool: executedTool, Name: stage.Tool})
+	}
+
+	return result, true
+}
+
 func NewCompressionProcess(
 	paths []string,
 	wrappers map[string]string,
@@ -147,22 +281,37 @@ func NewCompressionProcess(
 	}, allOk
 }
 
-func (c *CompressionProcess) CompressSingle(fileIdx int, ctx context.Context, tools map[string]ExecutedTool) (done chan struct{}) {
+func (c *CompressionProcess) CompressSingle(
+	fileIdx int,
+	ctx context.Context,
+	tools map[string]ExecutedTool,
+	chains map[string]ExecutedChain,
+) (done chan struct{}) {
+
 	commands := make(map[string]*compressionCommand)
 	commandListBuilder := &strings.Builder{}
 
-	for name, tool := range tools {
-		if _, ok := c.Results[name]; !ok {
-			c.Results[name] = make([]*CompressionResult, len(c.OriginalFileInfo))
-		}
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	commandListBuilder.WriteString(color.BlueString("Compressing file #%d: ", fileIdx+1))
+	commandListBuilder.WriteString(color.CyanString(fileInfo.Path))
+	commandListBuilder.WriteByte('\n')
 
-		if _, ok := c.TempFiles[name]; !ok {
-			c.TempFiles[name] = make([]TempFile, len(c.OriginalFileInfo))
-		}
+	for name := range tools {
+		c.allocateResults(name)
+	}
 
+	for name := range chains {
+		c.allocateResults(name)
+	}
+
+	for name, tool := range tools {
 		wrapper := config.QueryWrapper(c.Wrappers, tool.Platform, runtime.GOOS)
 
 		command := newCompressionCommand(name, tool, wrapper)
+		command.scheduler = c.Scheduler
+		command.priority = c.OriginalFileInfo[fileIdx].Size
+		command.progress = c.Progress
+		command.filePaths = []string{fileInfo.Path}
 		commands[name] = command
 
 		c.TempFiles[name][fileIdx] = command.prepareSingleTempFile(c.OriginalFileInfo[fileIdx])
@@ -171,7 +320,13 @@ func (c *CompressionProcess) CompressSingle(fileIdx int, ctx context.Context, to
 		command.writeCommandLine(commandListBuilder)
 	}
 
-	prints.Print(commandListBuilder.String())
+	for name, chain := range chains {
+		writeChainLine(commandListBuilder, name, chain)
+	}
+
+	if c.Progress == nil {
+		prints.Print(commandListBuilder.String())
+	}
 
 	done = make(chan struct{})
 
@@ -201,6 +356,20 @@ func (c *CompressionProcess) CompressSingle(fileIdx int, ctx context.Context, to
 			}(c, command, &waitGroup, &mutex, fileIdx)
 		}
 
+		for name, chain := range chains {
+			waitGroup.Add(1)
+
+			go func(c *CompressionProcess, name string, chain ExecutedChain, wg *sync.WaitGroup, mut *sync.Mutex, i int) {
+				defer wg.Done()
+				result, tempFile := c.runChain(ctx, i, name, chain)
+
+				mut.Lock()
+				c.Results[name][i] = result
+				c.TempFiles[name][i] = tempFile
+				mut.Unlock()
+			}(c, name, chain, &waitGroup, &mutex, fileIdx)
+		}
+
 		waitGroup.Wait()
 		done <- struct{}{}
 	}(c, done)
@@ -208,10 +377,137 @@ func (c *CompressionProcess) CompressSingle(fileIdx int, ctx context.Context, to
 	return done
 }
 
+// Runs `batchTools` on all files at once, and `perFileTools` and `chains` on each file with up to `maxFiles` files
+// being compressed at once (larger files first). Cached files are skipped.
+//
+// Returns a channel that receives the index of each file as soon as all of its tools finish. The channel is closed
+// once every tool finishes. If `ctx` is done, files that are not started yet are never received.
+func (c *CompressionProcess) CompressFiles(
+	ctx context.Context,
+	batchTools map[string]ExecutedTool,
+	perFileTools map[string]ExecutedTool,
+	chains map[string]ExecutedChain,
+	maxFiles int,
+) (finished chan int) {
+
+	finished = make(chan int, len(c.OriginalFileInfo))
+
+	// Allocated beforehand, tools for different files write to the results concurrently
+	for _, name := range slices.Concat(
+		slices.Collect(maps.Keys(batchTools)),
+		slices.Collect(maps.Keys(perFileTools)),
+		slices.Collect(maps.Keys(chains)),
+	) {
+		c.allocateResults(name)
+	}
+
+	indices := c.UncachedIndices()
+	hasPerFileTools := len(perFileTools) > 0 || len(chains) > 0
+
+	remaining := make([]int, len(c.OriginalFileInfo))
+	for _, i := range indices {
+		if len(batchTools) > 0 {
+			remaining[i]++
+		}
+
+		if hasPerFileTools {
+			remaining[i]++
+		}
+	}
+
+	var remainingMutex sync.Mutex
+	markFinished := func(fileIdx int) {
+		remainingMutex.Lock()
+		defer remainingMutex.Unlock()
+
+		remaining[fileIdx]--
+		if remaining[fileIdx] <= 0 {
+			finished <- fileIdx
+		}
+	}
+
+	for i := range c.OriginalFileInfo {
+		if c.IsCached(i) {
+			finished <- i
+		}
+	}
+
+	var waitGroup sync.WaitGroup
+
+	if len(batchTools) > 0 && len(indices) > 0 {
+		waitGroup.Add(1)
+
+		batchDone := c.CompressAll(ctx, batchTools)
+		go func() {
+			defer waitGroup.Done()
+			<-batchDone
+
+			for _, i := range indices {
+				markFinished(i)
+			}
+		}()
+	}
+
+	if hasPerFileTools && len(indices) > 0 {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			sortedIndices := slices.Clone(indices)
+			slices.SortStableFunc(sortedIndices, func(a, b int) int {
+				return cmp.Compare(c.OriginalFileInfo[b].Size, c.OriginalFileInfo[a].Size)
+			})
+
+			var fileGroup sync.WaitGroup
+			slots := make(chan struct{}, max(maxFiles, 1))
+
+			for _, i := range sortedIndices {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+				}
+
+				if ctx.Err() != nil {
+					break
+				}
+
+				fileGroup.Add(1)
+				go func(i int) {
+					defer fileGroup.Done()
+					<-c.CompressSingle(i, ctx, perFileTools, chains)
+					<-slots
+
+					markFinished(i)
+				}(i)
+			}
+
+			fileGroup.Wait()
+		}()
+	}
+
+	go func() {
+		waitGroup.Wait()
+		close(finished)
+	}()
+
+	return finished
+}
+
 func (c *CompressionProcess) CompressAll(ctx context.Context, tools map[string]ExecutedTool) (done chan struct{}) {
 	commands := make(map[string]*compressionCommand)
 	commandListBuilder := &strings.Builder{}
 
+	// Cached files are skipped
+	indices := c.UncachedIndices()
+	fileInfo := make([]*FileInfo, 0, len(indices))
+
+	var totalSize int64
+	for _, i := range indices {
+		fileInfo = append(fileInfo, c.OriginalFileInfo[i])
+		totalSize += c.OriginalFileInfo[i].Size
+	}
+
 	for name, tool := range tools {
 		if !tool.CanBatchCompress() {
 			prints.Warnf("Compressing all files at once requires tools to be able to batch compress, which %s don't do. Skipping...\n", name)
@@ -221,15 +517,29 @@ func (c *CompressionProcess) CompressAll(ctx context.Context, tools map[string]E
 		wrapper := config.QueryWrapper(c.Wrappers, tool.Platform, runtime.GOOS)
 
 		command := newCompressionCommand(name, tool, wrapper)
+		command.scheduler = c.Scheduler
+		command.priority = totalSize
+		command.progress = c.Progress
+		command.filePaths = make([]string, len(fileInfo))
+		for i, info := range fileInfo {
+			command.filePaths[i] = info.Path
+		}
 		commands[name] = command
 
-		c.TempFiles[name] = command.prepareTempFiles(c.OriginalFileInfo)
+		c.allocateResults(name)
+		tempFiles := command.prepareTempFiles(fileInfo)
+		for j, i := range indices {
+			c.TempFiles[name][i] = tempFiles[j]
+		}
+
 		command.prepareCommand(ctx)
 
 		command.writeCommandLine(commandListBuilder)
 	}
 
-	prints.Print(commandListBuilder.String())
+	if c.Progress == nil {
+		prints.Print(commandListBuilder.String())
+	}
 
 	done = make(chan struct{})
 
@@ -248,11 +558,17 @@ func (c *CompressionProcess) CompressAll(ctx context.Context, tools map[string]E
 				defer wg.Done()
 				command.executeAndReport()
 
-				tempFiles := c.TempFiles[command.toolName]
-				results := command.generateResults(c.OriginalFileInfo, tempFiles)
+				tempFiles := make([]TempFile, len(indices))
+				for j, i := range indices {
+					tempFiles[j] = c.TempFiles[command.toolName][i]
+				}
+
+				results := command.generateResults(fileInfo, tempFiles)
 
 				mut.Lock()
-				c.Results[command.toolName] = results
+				for j, i := range indices {
+					c.Results[command.toolName][i] = results[j]
+				}
 				mut.Unlock()
 			}(c, command, &waitGroup, &mutex)
 		}
@@ -264,9 +580,11 @@ func (c *CompressionProcess) CompressAll(ctx context.Context, tools map[string]E
 	return done
 }
 
-func (c *CompressionProcess) BenchmarkDecodeTime(minTime time.Duration) (done chan struct{}) {
+// Benchmarks the decode time of every file and its results, stripping the metadata of results first if `Metadata` is
+// enforced. Stops before the next file once `ctx` is cancelled, the remaining files are left unmeasured.
+func (c *CompressionProcess) BenchmarkDecodeTime(ctx context.Context, options DecodeBenchOptions) (done chan struct{}) {
 	c.AreDecodeTimeComputed = true
-	c.MinDecodeTime = minTime
+	c.DecodeBench = options
 
 	done = make(chan struct{})
 
@@ -276,12 +594,31 @@ func (c *CompressionProcess) BenchmarkDecodeTime(minTime time.Duration) (done ch
 		fileText := textutils.PluralNoun(totalFiles, "files", "file")
 		prints.Println(color.BlueString("Computing decode time for %d %s:", totalFiles, fileText))
 
+		mimeTypes := make([]*mimetype.MIME, totalFiles)
+		for i, file := range c.OriginalFileInfo {
+			mimeTypes[i], _ = mimetype.DetectFile(file.Path)
+		}
+
+		c.DecoderNames = c.supportingDecoders(mimeTypes)
+
 		for i, file := range c.OriginalFileInfo {
+			if ctx.Err() != nil {
+				prints.Warnf("Decode time benchmarking is interrupted, %d of %d files are not measured.\n", totalFiles-i, totalFiles)
+				break
+			}
+
 			prints.Printf("%s %s\n", file.Path, color.CyanString("(%d/%d)", i+1, totalFiles))
 
-			file.Decode = benchDecodeTime(file.Path, minTime)
-			if file.Decode.Err != nil {
-				prints.Warnf("Error occurred while benchmarking %s: %v\n", file.Path, file.Decode.Err)
+			file.Decodes = c.benchDecoders(file.Path, mimeTypes[i], options)
+			for _, decode := range file.Decodes {
+				if decode.Err != nil {
+					prints.Warnf("Error occurred while benchmarking %s with %s: %v\n", file.Path, decode.Decoder, decode.Err)
+				}
+			}
+
+			// Results are measured as they are written, after stripping their metadata
+			if c.Metadata.IsEnforced() {
+				c.enforceMetadata(i)
 			}
 
 			for toolName, results := range c.Results {
@@ -290,11 +627,9 @@ func (c *CompressionProcess) BenchmarkDecodeTime(minTime time.Duration) (done ch
 				tempFile := c.TempFiles[toolName][i]
 
 				if tempFile.CreateError != nil {
-					result.Decode = DecodeTimeBench{
-						Total:   file.Decode.Total,
-						Average: file.Decode.Average,
-						Trials:  file.Decode.Trials,
-						Err:     tempFile.CreateError,
+					result.Decodes = make([]DecodeTimeBench, len(c.DecoderNames))
+					for j, decoderName := range c.DecoderNames {
+						result.Decodes[j] = DecodeTimeBench{Decoder: decoderName, Err: tempFile.CreateError}
 					}
 
 					prints.Warnf("Cannot benchmark %s on %s. Output file doesn't exist: %v\n",
@@ -306,9 +641,11 @@ func (c *CompressionProcess) BenchmarkDecodeTime(minTime time.Duration) (done ch
 					continue
 				}
 
-				result.Decode = benchDecodeTime(tempFile.Path, minTime)
-				if result.Decode.Err != nil {
-					prints.Warnf("Error occurred while benchmarking %s on %s: %v\n", tempFile.Path, toolName, result.Decode.Err)
+				result.Decodes = c.benchDecoders(tempFile.Path, mimeTypes[i], options)
+				for _, decode := range result.Decodes {
+					if decode.Err != nil {
+						prints.Warnf("Error occurred while benchmarking %s on %s with %s: %v\n", tempFile.Path, toolName, decode.Decoder, decode.Err)
+					}
 				}
 			}
 		}
@@ -320,35 +657,167 @@ func (c *CompressionProcess) BenchmarkDecodeTime(minTime time.Duration) (done ch
 	return done
 }
 
+// Returns the names of the decoders that support at least one of `mimeTypes`, Go's built-in decoders first.
+func (c *CompressionProcess) supportingDecoders(mimeTypes []*mimetype.MIME) (names []string) {
+	isSupported := func(formats []string) bool {
+		return slices.ContainsFunc(mimeTypes, func(mimeType *mimetype.MIME) bool {
+			return mimeType != nil && slices.ContainsFunc(formats, func(format string) bool {
+				return mimeType.Is(format)
+			})
+		})
+	}
+
+	if slices.ContainsFunc(mimeTypes, func(mimeType *mimetype.MIME) bool {
+		_, ok := getDecodeFunc(mimeType)
+		return mimeType != nil && ok
+	}) {
+		names = append(names, config.BuiltinDecoder)
+	}
+
+	for _, decoder := range c.Decoders {
+		if isSupported(decoder.SupportedFormats) {
+			names = append(names, decoder.Name)
+		}
+	}
+
+	return names
+}
+
+// Benchmarks the file at `path` with each of `DecoderNames`. Decoders that do not support `mimeType` measure nothing.
+func (c *CompressionProcess) benchDecoders(path string, mimeType *mimetype.MIME, options DecodeBenchOptions) (decodes []DecodeTimeBench) {
+	decodes = make([]DecodeTimeBench, 0, len(c.DecoderNames))
+	for _, decoderName := range c.DecoderNames {
+		var decode DecodeTimeBench
+
+		if decoderName == config.BuiltinDecoder {
+			decode = benchBuiltinDecodeTime(path, options)
+		} else {
+			i := slices.IndexFunc(c.Decoders, func(decoder ExternalDecoder) bool { return decoder.Name == decoderName })
+			decoder := c.Decoders[i]
+
+			if mimeType != nil && slices.ContainsFunc(decoder.SupportedFormats, mimeType.Is) {
+				decode = benchExternalDecodeTime(path, decoder, options)
+			}
+		}
+
+		decode.Decoder = decoderName
+		decodes = append(decodes, decode)
+	}
+
+	return decodes
+}
+
+// Returns the benchmark at `decoderIdx`, or an empty benchmark if nothing is benchmarked.
+func DecodeAt(decodes []DecodeTimeBench, decoderIdx int) DecodeTimeBench {
+	if decoderIdx < 0 || decoderIdx >= len(decodes) {
+		return DecodeTimeBench{}
+	}
+
+	return decodes[decoderIdx]
+}
+
+// Returns the index of the first decoder in `DecoderNames` that measured the original of the file at `fileIdx`,
+// which is used to pick results by decode time. Returns `false` if no decoder measured it.
+func (c *CompressionProcess) primaryDecoder(fileIdx int) (decoderIdx int, ok bool) {
+	decoderIdx = slices.IndexFunc(c.OriginalFileInfo[fileIdx].Decodes, func(decode DecodeTimeBench) bool {
+		return decode.Err == nil && decode.Trials > 0
+	})
+
+	return decoderIdx, decoderIdx >= 0
+}
+
 func (c *CompressionProcess) SaveResultsAndReport(writeMode WriteMode) (allOk bool) {
 	allOk = true
 
-	sortedToolNames := maputils.SortedKeys(c.Results)
-
 	prints.Println(color.BlueString("SUMMARY:"))
 
 	for i := range c.OriginalFileInfo {
-		bestToolSize := c.findBestToolSize(i)
-		bestToolDecodeTime := c.findBestToolDecodeTime(i)
+		if !c.IsFileComplete(i) {
+			continue // Interrupted, its results are incomplete
+		}
 
-		c.printResultSummary(i, bestToolSize, bestToolDecodeTime, sortedToolNames)
-		ok := c.flushResult(bestToolSize, i, writeMode)
+		ok := c.saveFileResult(i, writeMode)
 		if !ok {
 			allOk = false
 		}
-
-		prints.Println()
 	}
 
 	return allOk
 }
 
+// Same as `SaveResultsAndReport()`, but only for the file at `fileIdx`. Meant to be called as soon as all tools
+// for the file finish.
+func (c *CompressionProcess) SaveFileResultAndReport(fileIdx int, writeMode WriteMode) (ok bool) {
+	prints.Println(color.BlueString("SUMMARY (%d/%d):", fileIdx+1, len(c.OriginalFileInfo)))
+	return c.saveFileResult(fileIdx, writeMode)
+}
+
+func (c *CompressionProcess) saveFileResult(fileIdx int, writeMode WriteMode) (ok bool) {
+	// Before anything else, stripping metadata changes the size of results. Already done if decode time is benchmarked
+	if c.Metadata.IsEnforced() {
+		c.enforceMetadata(fileIdx)
+	}
+
+	if c.VerifyPixels || c.ComputeQuality {
+		c.inspectResults(fileIdx)
+	}
+
+	sortedToolNames := maputils.SortedKeys(c.Results)
+
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	selection, unavailable := c.fileSelection(fileIdx)
+	if unavailable != "" {
+		prints.Warnf("Cannot pick the result of %s with %s, %s is unavailable. Picking the smallest result instead.\n", fileInfo.Path, c.Selection.String(), unavailable)
+	}
+
+	fileInfo.Selection = selection
+	bestTool := c.scoreResults(fileIdx, selection, c.fileResults(fileIdx))
+	fileInfo.BestTool = bestTool
+	bestToolsDecodeTime := make([]string, len(c.DecoderNames))
+	for decoderIdx := range c.DecoderNames {
+		bestToolsDecodeTime[decoderIdx] = c.findBestToolDecodeTime(fileIdx, decoderIdx)
+	}
+
+	c.printResultSummary(fileIdx, bestTool, bestToolsDecodeTime, sortedToolNames)
+	c.storeCachedResults(fileIdx, bestTool)
+
+	ok = c.flushResult(bestTool, fileIdx, writeMode)
+	c.notifyFileDone(fileIdx, bestTool)
+
+	prints.Println()
+	return ok
+}
+
 func (c *CompressionProcess) CleanUp() {
 	for _, tempFiles := range c.TempFiles {
 		for _, tempFile := range tempFiles {
 			_ = os.Remove(tempFile.Path)
 		}
 	}
+
+	for _, path := range c.intermediateFiles {
+		_ = os.Remove(path)
+	}
+
+	for _, dir := range c.workspaceDirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// Creates the temp files of each file in its own directory inside `workspace`, instead of in `os.TempDir()`.
+// Must be called before compressing. The directories are removed on `CleanUp()`.
+func (c *CompressionProcess) UseWorkspace(workspace *Workspace) (err error) {
+	for _, fileInfo := range c.OriginalFileInfo {
+		dir, err := workspace.newFileDir()
+		if err != nil {
+			return err
+		}
+
+		fileInfo.TempDir = dir
+		c.workspaceDirs = append(c.workspaceDirs, dir)
+	}
+
+	return nil
 }
 
 func (c *CompressionProcess) IsErrorFree() (ok bool) {
@@ -363,41 +832,168 @@ func (c *CompressionProcess) IsErrorFree() (ok bool) {
 	return true
 }
 
+// Returns `true` if every tool ran on the file at `fileIdx` without being interrupted. Returns `false` otherwise.
+func (c *CompressionProcess) IsFileComplete(fileIdx int) bool {
+	for _, toolResults := range c.Results {
+		result := toolResults[fileIdx]
+		if result == nil || result.IsInterrupted() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns `true` if the tool was stopped or never started due to an interrupt. Returns `false` otherwise.
+func (r *CompressionResult) IsInterrupted() bool {
+	return errors.Is(r.CommandError, ErrInterrupted)
+}
+
+// Returns `true` if the tool was stopped for exceeding its timeout. Returns `false` otherwise.
+func (r *CompressionResult) IsTimedOut() bool {
+	return errors.Is(r.CommandError, ErrTimedOut)
+}
+
+// Returns `true` if the tool failed after exceeding its memory limit. Returns `false` otherwise.
+func (r *CompressionResult) IsOverMemoryLimit() bool {
+	return errors.Is(r.CommandError, ErrMemoryLimit)
+}
 
 func (r *CompressionResult) HasError() bool {
-	return r.CommandError != nil || r.ReadFinalSizeError != nil || r.Decode.Err != nil || r.CreateFileError != nil
+	isDecodeError := slices.ContainsFunc(r.Decodes, func(decode DecodeTimeBench) bool { return decode.Err != nil })
+	return r.CommandError != nil || r.ReadFinalSizeError != nil || isDecodeError || r.CreateFileError != nil
 }
 
+func (c *CompressionProcess) allocateResults(name string) {
+	if _, ok := c.Results[name]; !ok {
+		c.Results[name] = make([]*CompressionResult, len(c.OriginalFileInfo))
+	}
 
-func (c *CompressionProcess) findBestToolSize(fileIdx int) (bestTool string) {
-	bestSize := c.OriginalFileInfo[fileIdx].Size
+	if _, ok := c.TempFiles[name]; !ok {
+		c.TempFiles[name] = make([]TempFile, len(c.OriginalFileInfo))
+	}
+}
 
-	for toolName, toolResults := range c.Results {
-		result := toolResults[fileIdx]
-		if result.HasError() {
-			continue
+// Runs the chain's tools one after another on a file, each compressing the output of the previous tool. Stops
+// at the first tool that fails. Returns the chain's result and the temp file of the last executed tool.
+func (c *CompressionProcess) runChain(ctx context.Context, fileIdx int, chainName string, chain ExecutedChain) (result *CompressionResult, tempFile TempFile) {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	stageInput := fileInfo
+
+	stageResults := make([]*CompressionResult, 0, len(chain.Stages))
+	for i, stage := range chain.Stages {
+		wrapper := config.QueryWrapper(c.Wrappers, stage.Platform, runtime.GOOS)
+
+		command := newCompressionCommand(stage.Name, stage.ExecutedTool, wrapper)
+		command.toolName = chainName + " (" + stage.Name + ")"
+		command.scheduler = c.Scheduler
+		command.priority = fileInfo.Size
+		command.progress = c.Progress
+		command.filePaths = []string{fileInfo.Path}
+
+		isLast := i+1 == len(chain.Stages)
+		if isLast {
+			command.tempName = chainName
+		} else {
+			command.tempName = fmt.Sprintf("%s-%d-%s", chainName, i+1, stage.Name)
 		}
 
-		if result.FinalSize < bestSize {
-			bestSize = result.FinalSize
-			bestTool = toolName
+		tempFile = command.prepareSingleTempFile(stageInput)
+		if !isLast {
+			c.intermediateMutex.Lock()
+			c.intermediateFiles = append(c.intermediateFiles, tempFile.Path)
+			c.intermediateMutex.Unlock()
+		}
+
+		command.prepareCommand(ctx)
+		if command.isAvailable {
+			command.setStdoutAndErr(c.toolOutput)
+		}
+
+		command.executeAndReport()
+
+		stageResult := command.generateSingleResult(stageInput, tempFile)
+		stageResults = append(stageResults, stageResult)
+
+		if stageResult.HasError() {
+			break
+		}
+
+		stageInput = &FileInfo{
+			Path:      tempFile.Path,
+			BaseName:  fileInfo.BaseName,
+			Extension: fileInfo.Extension,
+			Size:      stageResult.FinalSize,
+			TempDir:   fileInfo.TempDir,
 		}
 	}
 
-	return bestTool
+	return newChainResult(fileInfo, stageResults), tempFile
+}
+
+func newChainResult(originalFileInfo *FileInfo, stageResults []*CompressionResult) (result *CompressionResult) {
+	lastResult := stageResults[len(stageResults)-1]
+
+	result = &CompressionResult{
+		Command:   lastResult.Command,
+		Arguments: lastResult.Arguments,
+		IsWrapped: lastResult.IsWrapped,
+
+		OriginalSize: originalFileInfo.Size,
+		FinalSize:    lastResult.FinalSize,
+
+		CreateFileError:    lastResult.CreateFileError,
+		CommandError:       lastResult.CommandError,
+		ReadFinalSizeError: lastResult.ReadFinalSizeError,
+
+		Stages: stageResults,
+	}
+
+	for _, stageResult := range stageResults {
+		result.TimeTaken += stageResult.TimeTaken
+		result.Resources = result.Resources.Add(stageResult.Resources)
+		result.Attempts = max(result.Attempts, stageResult.Attempts)
+	}
+
+	return result
 }
 
-func (c *CompressionProcess) findBestToolDecodeTime(fileIdx int) (bestTool string) {
-	bestDecodeTime := c.OriginalFileInfo[fileIdx].Decode.Average
+// Returns the tool with the fastest mean decode time with the decoder at `decoderIdx`, if it's significantly faster
+// than the original and every other result. Returns an empty string otherwise, as the difference may only be noise.
+func (c *CompressionProcess) findBestToolDecodeTime(fileIdx, decoderIdx int) (bestTool string) {
+	originalDecode := DecodeAt(c.OriginalFileInfo[fileIdx].Decodes, decoderIdx)
+	if originalDecode.Err != nil || originalDecode.Trials == 0 {
+		return ""
+	}
 
+	candidates := make([]string, 0, len(c.Results))
 	for toolName, toolResults := range c.Results {
 		result := toolResults[fileIdx]
-		if result.Decode.Average < bestDecodeTime {
-			bestDecodeTime = result.Decode.Average
+		if result.HasError() || result.IsDisqualified() || DecodeAt(result.Decodes, decoderIdx).Trials == 0 {
+			continue
+		}
+
+		candidates = append(candidates, toolName)
+		if bestTool == "" || result.Decodes[decoderIdx].Average < c.Results[bestTool][fileIdx].Decodes[decoderIdx].Average {
 			bestTool = toolName
 		}
 	}
 
+	if bestTool == "" {
+		return ""
+	}
+
+	bestDecode := c.Results[bestTool][fileIdx].Decodes[decoderIdx]
+	if bestDecode.Average >= originalDecode.Average || !bestDecode.IsSignificantlyDifferent(originalDecode) {
+		return ""
+	}
+
+	for _, toolName := range candidates {
+		if toolName != bestTool && !bestDecode.IsSignificantlyDifferent(c.Results[toolName][fileIdx].Decodes[decoderIdx]) {
+			return ""
+		}
+	}
+
 	return bestTool
 }
 
@@ -406,23 +1002,88 @@ func (c *CompressionProcess) flushResult(fromTool string, fileIdx int, writeMode
 
 	fileInfo := c.OriginalFileInfo[fileIdx]
 
+	// Kept results are written regardless, they are meant to be compared
+	isNotWorthIt := writeMode != KeepAll && c.isBelowMinSaving(fileIdx, fromTool)
+	if isNotWorthIt {
+		fromTool = ""
+	}
+
 	switch writeMode {
 	case None:
 		return ok
 	case KeepAll:
+		resultDir, err := c.resultDirectory(fileInfo)
+		if err != nil {
+			prints.Warnf("Cannot create directory %s: %v\n", resultDir, err)
+			return false
+		}
+
+		attrs := c.readOriginalAttributes(fileInfo)
 		for toolName := range c.Results {
 			tempFile := c.TempFiles[toolName][fileIdx]
-			resultPath := compressedFilePath(fileInfo.Directory, fileInfo.BaseName, toolName, fileInfo.Extension)
+			resultPath := compressedFilePath(resultDir, fileInfo.BaseName, toolName, fileInfo.Extension)
 
 			err := moveFile(tempFile.Path, resultPath)
 			if err != nil {
 				prints.Warnf("Cannot move result %s to %s: %v\n", tempFile.Path, resultPath, err)
 				ok = false
 			} else {
+				preserveAttributes(attrs, fileInfo.Path, resultPath)
+				c.setWrittenPath(fileIdx, toolName, fromTool, resultPath)
 				prints.Printf("Successfully moved result %s to %s.\n", tempFile.Path, color.CyanString(resultPath))
 			}
 		}
 
+		return ok
+	case Stream:
+		sourcePath := fileInfo.Path
+		if fromTool != "" {
+			sourcePath = c.TempFiles[fromTool][fileIdx].Path
+		}
+
+		err := copyFileToWriter(sourcePath, c.ResultWriter)
+		if err != nil {
+			prints.Warnf("Cannot write result of %s: %v\n", fileInfo.Path, err)
+			return false
+		}
+
+		if isNotWorthIt {
+			prints.Println("Best result is not worth it. The original file is written as is.")
+		} else if fromTool == "" {
+			prints.Println("File cannot be compressed further. The original file is written as is.")
+		} else {
+			prints.Printf("%s wins! Successfully written the result.\n", fromTool)
+		}
+
+		return ok
+	}
+
+	if fromTool == "" && writeMode == KeepBest && c.OutputDir != "" {
+		// The output directory should have every file, even the ones that can't be compressed further
+		resultPath, err := c.outputDirPath(fileInfo)
+		if err == nil {
+			err = copyFileTo(fileInfo.Path, resultPath)
+		}
+
+		if err != nil {
+			prints.Warnf("Cannot copy %s to %s: %v\n", fileInfo.Path, resultPath, err)
+			return false
+		}
+
+		preserveAttributes(c.readOriginalAttributes(fileInfo), fileInfo.Path, resultPath)
+		fileInfo.WrittenPath = resultPath
+
+		if isNotWorthIt {
+			prints.Printf("Best result is not worth it. Copied the original file to %s.\n", color.CyanString(resultPath))
+		} else {
+			prints.Printf("File cannot be compressed further. Copied the original file to %s.\n", color.CyanString(resultPath))
+		}
+
+		return ok
+	}
+
+	if isNotWorthIt {
+		prints.Printf("Best result is not worth it, it saves less than %s. The original file is left as is.\n", c.MinSaving.String())
 		return ok
 	}
 
@@ -434,31 +1095,152 @@ func (c *CompressionProcess) flushResult(fromTool string, fileIdx int, writeMode
 	bestTempFile := c.TempFiles[fromTool][fileIdx]
 	bestTempPath := bestTempFile.Path
 
-	switch writeMode {
-	case KeepBest:
-		resultPath := compressedFilePath(fileInfo.Directory, fileInfo.BaseName, fromTool, fileInfo.Extension)
+	// Read before writing, overwriting replaces the original
+	attrs := c.readOriginalAttributes(fileInfo)
+
+	switch writeMode {
+	case KeepBest:
+		resultPath := compressedFilePath(fileInfo.Directory, fileInfo.BaseName, fromTool, fileInfo.Extension)
+
+		var err error
+		if c.OutputDir != "" {
+			resultPath, err = c.outputDirPath(fileInfo)
+		}
+
+		if err == nil {
+			err = moveFile(bestTempPath, resultPath)
+		}
+
+		if err != nil {
+			prints.Warnf("Cannot move result %s to %s: %v\n", bestTempPath, resultPath, err)
+			ok = false
+		} else {
+			preserveAttributes(attrs, fileInfo.Path, resultPath)
+			c.setWrittenPath(fileIdx, fromTool, fromTool, resultPath)
+			prints.Printf("%s wins! Successfully moved result %s to %s.\n", fromTool, bestTempPath, color.CyanString(resultPath))
+		}
+	case Overwrite:
+		var entry journal.Entry
+		if c.Journal != nil {
+			var err error
+			entry, err = c.Journal.Backup(fileInfo.Path, c.BackupSuffix)
+			if err != nil {
+				prints.Warnf("Cannot back up %s, it is not overwritten: %v\n", fileInfo.Path, err)
+				return false
+			}
+		}
+
+		err := moveFile(bestTempPath, fileInfo.Path)
+		if err != nil {
+			prints.Warnf("Cannot overwrite %s: %v\n", fileInfo.Path, err)
+			if c.Journal != nil {
+				_ = c.Journal.Discard(entry)
+			}
+
+			return false
+		}
+
+		preserveAttributes(attrs, fileInfo.Path, fileInfo.Path)
+		c.setWrittenPath(fileIdx, fromTool, fromTool, fileInfo.Path)
+		if c.Journal != nil {
+			err = c.Journal.Record(entry, fromTool)
+			if err != nil {
+				prints.Warnf("Cannot record %s in the journal, it cannot be undone: %v\n", fileInfo.Path, err)
+			}
+		}
+
+		prints.Printf("%s wins! Successfully overwritten %s.\n", fromTool, color.CyanString(fileInfo.Path))
+	}
+
+	return ok
+}
+
+// Records that the result of `toolName` is written to `path`, also as the file's if it comes from `bestTool`.
+func (c *CompressionProcess) setWrittenPath(fileIdx int, toolName, bestTool, path string) {
+	c.Results[toolName][fileIdx].WrittenPath = path
+	if toolName == bestTool {
+		c.OriginalFileInfo[fileIdx].WrittenPath = path
+	}
+}
+
+// Returns `true` if the result of `toolName` saves less than `MinSaving` over the original of the file at `fileIdx`.
+// Returns `false` otherwise, or if `toolName` is empty.
+func (c *CompressionProcess) isBelowMinSaving(fileIdx int, toolName string) bool {
+	if toolName == "" || c.MinSaving.IsZero() {
+		return false
+	}
+
+	return !c.MinSaving.IsMet(c.OriginalFileInfo[fileIdx].Size, c.Results[toolName][fileIdx].FinalSize)
+}
+
+// Returns the attributes of the original to preserve on its results, or nil if there is none or they cannot be read.
+func (c *CompressionProcess) readOriginalAttributes(fileInfo *FileInfo) *fileAttributes {
+	if c.Preserve == PreserveNone {
+		return nil
+	}
+
+	attrs, err := readFileAttributes(fileInfo.Path, c.Preserve)
+	if err != nil {
+		prints.Warnf("Cannot read attributes of %s, they are not preserved: %v\n", fileInfo.Path, err)
+		return nil
+	}
+
+	if !fileInfo.AccessTime.IsZero() {
+		attrs.atime = fileInfo.AccessTime
+	}
+
+	return attrs
+}
+
+func preserveAttributes(attrs *fileAttributes, originalPath, resultPath string) {
+	if attrs == nil {
+		return
+	}
+
+	err := attrs.applyTo(resultPath)
+	if err != nil {
+		prints.Warnf("Cannot preserve attributes of %s on %s: %v\n", originalPath, resultPath, err)
+	}
+}
+
+// Writes results into `dir` instead of next to the input files. `relativePaths` maps input paths to where their
+// results are written inside `dir`, files that are not in it use their file name.
+func (c *CompressionProcess) SetOutputDir(dir string, relativePaths map[string]string) {
+	c.OutputDir = dir
 
-		err := moveFile(bestTempPath, resultPath)
-		if err != nil {
-			prints.Warnf("Cannot move result %s to %s: %v\n", bestTempPath, resultPath, err)
-			ok = false
-		} else {
-			prints.Printf("%s wins! Successfully moved result %s to %s.\n", fromTool, bestTempPath, color.CyanString(resultPath))
-		}
-	case Overwrite:
-		err := moveFile(bestTempPath, fileInfo.Path)
-		if err != nil {
-			prints.Warnf("Cannot overwrite %s: %v\n", fileInfo.Path, err)
-			ok = false
-		} else {
-			prints.Printf("%s wins! Successfully overwritten %s.\n", fromTool, color.CyanString(fileInfo.Path))
+	for _, fileInfo := range c.OriginalFileInfo {
+		fileInfo.RelativePath = fileInfo.FileName
+		if relativePath, ok := relativePaths[fileInfo.Path]; ok {
+			fileInfo.RelativePath = relativePath
 		}
 	}
+}
 
-	return ok
+// Sets the access times to preserve on results. Reading a file may update its access time, so `accessTimes` should be
+// read before anything reads the input files, see `FileAccessTime()`.
+func (c *CompressionProcess) SetAccessTimes(accessTimes map[string]time.Time) {
+	for _, fileInfo := range c.OriginalFileInfo {
+		fileInfo.AccessTime = accessTimes[fileInfo.Path]
+	}
+}
+
+// Returns the directory the results of the file are written to, creating it if needed.
+func (c *CompressionProcess) resultDirectory(fileInfo *FileInfo) (dir string, err error) {
+	if c.OutputDir == "" {
+		return fileInfo.Directory, nil
+	}
+
+	dir = filepath.Join(c.OutputDir, filepath.Dir(fileInfo.RelativePath))
+	return dir, os.MkdirAll(dir, rwxr_xr_x)
+}
+
+// Returns the path of the file inside `OutputDir` with its original file name, creating its directory if needed.
+func (c *CompressionProcess) outputDirPath(fileInfo *FileInfo) (path string, err error) {
+	dir, err := c.resultDirectory(fileInfo)
+	return filepath.Join(dir, filepath.Base(fileInfo.RelativePath)), err
 }
 
-func (c *CompressionProcess) printResultSummary(fileIdx int, bestToolSize, bestToolDecodeTime string, presortedToolNames []string) {
+func (c *CompressionProcess) printResultSummary(fileIdx int, bestTool string, bestToolsDecodeTime, presortedToolNames []string) {
 	fileInfo := c.OriginalFileInfo[fileIdx]
 
 	summaryBuilder := &strings.Builder{}
@@ -466,26 +1248,70 @@ func (c *CompressionProcess) printResultSummary(fileIdx int, bestToolSize, bestT
 	summaryBuilder.WriteString(fileInfo.Path)
 	summaryBuilder.WriteString(" | ")
 	summaryBuilder.WriteString(color.CyanString("Size (B)"))
+	summaryBuilder.WriteString(" - ")
+	summaryBuilder.WriteString(color.CyanString("CPU (s user/sys), Peak Memory (MB)"))
+
 	if c.AreDecodeTimeComputed {
 		summaryBuilder.WriteString(" - ")
-		summaryBuilder.WriteString(color.CyanString("Decode Time (ms avg within %v, w/ Go's native libraries)", c.MinDecodeTime))
+		summaryBuilder.WriteString(color.CyanString("Decode Time (ms mean ±stddev within %v, per decoder)", c.DecodeBench.MinTime))
+	}
+
+	if c.ComputeQuality {
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("Quality (MS-SSIM)"))
+	}
+
+	if c.Metadata.IsEnforced() {
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("Metadata (%s)", c.Metadata.String()))
+	}
+
+	if !c.Selection.IsSize() {
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("Score (%s)", fileInfo.Selection.String()))
 	}
 
 	summaryBuilder.WriteByte('\n')
 
 	summaryBuilder.WriteString("| original: ")
 	summaryBuilder.WriteString(color.CyanString("%d (100.000000%%)", fileInfo.Size))
+	summaryBuilder.WriteString(" - ")
+	summaryBuilder.WriteString(color.CyanString("-"))
 
 	if c.AreDecodeTimeComputed {
 		summaryBuilder.WriteString(" - ")
 
-		if fileInfo.Decode.Err != nil {
-			summaryBuilder.WriteString(color.YellowString("DECODE TIME ERROR"))
-		} else {
-			summaryBuilder.WriteString(color.CyanString(fileInfo.Decode.MSAverageWithTrialsCountString()))
+		for decoderIdx, decoderName := range c.DecoderNames {
+			if decoderIdx > 0 {
+				summaryBuilder.WriteString(", ")
+			}
+
+			summaryBuilder.WriteString(decoderName + ": ")
+
+			originalDecode := DecodeAt(fileInfo.Decodes, decoderIdx)
+			if originalDecode.Err != nil {
+				summaryBuilder.WriteString(color.YellowString("DECODE TIME ERROR"))
+			} else {
+				summaryBuilder.WriteString(color.CyanString(originalDecode.MSStatisticsString()))
+			}
 		}
 	}
 
+	if c.ComputeQuality {
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("1.000000"))
+	}
+
+	if c.Metadata.IsEnforced() {
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("-"))
+	}
+
+	if !c.Selection.IsSize() {
+		summaryBuilder.WriteString(" - ")
+		writeScore(summaryBuilder, fileInfo.Score, bestTool == "")
+	}
+
 	summaryBuilder.WriteByte('\n')
 
 	for _, toolName := range presortedToolNames {
@@ -499,17 +1325,77 @@ func (c *CompressionProcess) printResultSummary(fileIdx int, bestToolSize, bestT
 			continue
 		}
 
+		if toolResult.IsTimedOut() {
+			summaryBuilder.WriteString(color.YellowString("TIMED OUT"))
+			summaryBuilder.WriteByte('\n') // Coloured \n messes up spacing, must be separated
+			continue
+		}
+
+		if toolResult.IsOverMemoryLimit() {
+			summaryBuilder.WriteString(color.YellowString("EXCEEDED MEMORY LIMIT"))
+			summaryBuilder.WriteByte('\n') // Coloured \n messes up spacing, must be separated
+			continue
+		}
+
 		if toolResult.CommandError != nil {
-			summaryBuilder.WriteString(color.YellowString("COMPRESSION FAILED DUE TO ERROR"))
+			summaryBuilder.WriteString(color.YellowString("COMPRESSION FAILED DUE TO ERROR" + attemptsTag(toolResult.Attempts)))
 			summaryBuilder.WriteByte('\n') // Coloured \n messes up spacing, must be separated
 			continue
 		}
 
-		writeSizeLine(summaryBuilder, toolResult, toolName == bestToolSize)
+		writeSizeLine(summaryBuilder, toolResult, toolName == bestTool)
+		if toolResult.IsCached {
+			summaryBuilder.WriteString(color.CyanString(" (cached)"))
+		}
+
+		if toolResult.Attempts > 1 {
+			summaryBuilder.WriteString(color.YellowString(attemptsTag(toolResult.Attempts)))
+		}
+
+		summaryBuilder.WriteString(" - ")
+		summaryBuilder.WriteString(color.CyanString("%s, %s", toolResult.Resources.CPUTimeString(), toolResult.Resources.PeakMemoryString()))
 
 		if c.AreDecodeTimeComputed {
 			summaryBuilder.WriteString(" - ")
-			writeDecodeTime(summaryBuilder, toolResult, fileInfo.Decode, toolName == bestToolDecodeTime)
+
+			for decoderIdx, decoderName := range c.DecoderNames {
+				if decoderIdx > 0 {
+					summaryBuilder.WriteString(", ")
+				}
+
+				summaryBuilder.WriteString(decoderName + ": ")
+				writeDecodeTime(
+					summaryBuilder,
+					DecodeAt(toolResult.Decodes, decoderIdx),
+					DecodeAt(fileInfo.Decodes, decoderIdx),
+					toolName == bestToolsDecodeTime[decoderIdx],
+				)
+			}
+		}
+
+		if c.ComputeQuality {
+			summaryBuilder.WriteString(" - ")
+			writeQuality(summaryBuilder, toolResult)
+		}
+
+		if c.Metadata.IsEnforced() {
+			summaryBuilder.WriteString(" - ")
+			writeMetadataCheck(summaryBuilder, toolResult)
+		}
+
+		if !c.Selection.IsSize() {
+			summaryBuilder.WriteString(" - ")
+			writeScore(summaryBuilder, toolResult.Score, toolName == bestTool)
+		}
+
+		if toolResult.Pixels == PixelsDiffer {
+			summaryBuilder.WriteString(color.YellowString(" (DISQUALIFIED: NOT LOSSLESS)"))
+		} else if toolResult.Quality.IsBelowMinimum {
+			summaryBuilder.WriteString(color.YellowString(" (DISQUALIFIED: BELOW MINIMUM QUALITY)"))
+		} else if toolResult.Metadata.Err != nil || len(toolResult.Metadata.Missing) > 0 {
+			summaryBuilder.WriteString(color.YellowString(" (DISQUALIFIED: MISSING METADATA)"))
+		} else if toolName == bestTool && c.isBelowMinSaving(fileIdx, toolName) {
+			summaryBuilder.WriteString(color.YellowString(" (NOT WORTH IT: SAVES LESS THAN %s)", c.MinSaving.String()))
 		}
 
 		summaryBuilder.WriteByte('\n')
@@ -537,27 +1423,62 @@ func writeSizeLine(summaryBuilder *strings.Builder, result *CompressionResult, i
 	summaryBuilder.WriteString(sizeLine)
 }
 
-func writeDecodeTime(summaryBuilder *strings.Builder, result *CompressionResult, originalDecode DecodeTimeBench, isBest bool) {
-	if result.Decode.Err != nil {
+func writeDecodeTime(summaryBuilder *strings.Builder, decode, originalDecode DecodeTimeBench, isBest bool) {
+	if decode.Err != nil {
 		summaryBuilder.WriteString(color.YellowString("DECODE TIME ERROR"))
 		return
 	}
 
-	decodeTimeLine := result.Decode.MSAverageWithTrialsCountString()
+	isSignificant := decode.IsSignificantlyDifferent(originalDecode)
+
+	decodeTimeLine := decode.MSStatisticsString()
 	if isBest {
 		decodeTimeLine = color.GreenString(decodeTimeLine)
-	} else if result.Decode.Average > originalDecode.Average {
+	} else if isSignificant && decode.Average > originalDecode.Average {
 		decodeTimeLine = color.YellowString(decodeTimeLine)
 	} else {
 		decodeTimeLine = color.CyanString(decodeTimeLine)
 	}
 
 	summaryBuilder.WriteString(decodeTimeLine)
+	if !isSignificant && decode.Trials > 0 {
+		summaryBuilder.WriteString(color.CyanString(" (not significant)"))
+	}
+}
+
+func writeQuality(summaryBuilder *strings.Builder, result *CompressionResult) {
+	if result.Quality.Err != nil {
+		summaryBuilder.WriteString(color.YellowString("QUALITY ERROR"))
+		return
+	}
+
+	if result.Quality.IsBelowMinimum {
+		summaryBuilder.WriteString(color.YellowString(result.Quality.String()))
+	} else {
+		summaryBuilder.WriteString(color.CyanString(result.Quality.String()))
+	}
+}
+
+func writeMetadataCheck(summaryBuilder *strings.Builder, result *CompressionResult) {
+	if result.Metadata.Err != nil || len(result.Metadata.Missing) > 0 {
+		summaryBuilder.WriteString(color.YellowString(result.Metadata.String()))
+	} else {
+		summaryBuilder.WriteString(color.CyanString(result.Metadata.String()))
+	}
+}
+
+func writeScore(summaryBuilder *strings.Builder, score SelectionScore, isBest bool) {
+	if isBest {
+		summaryBuilder.WriteString(color.GreenString(score.String()))
+	} else {
+		summaryBuilder.WriteString(color.CyanString(score.String()))
+	}
 }
 
 func newCompressionCommand(toolName string, tool ExecutedTool, wrapper string) (cc *compressionCommand) {
 	return &compressionCommand{
 		toolName: toolName,
+		tempName: toolName,
 
 		tool: tool,
 
@@ -572,7 +1493,7 @@ func newCompressionCommand(toolName string, tool ExecutedTool, wrapper string) (
 }
 
 func (cc *compressionCommand) prepareSingleTempFile(fileInfo *FileInfo) (tempFile TempFile) {
-	tempPath := compressedFilePath(os.TempDir(), fileInfo.BaseName, cc.toolName, fileInfo.Extension)
+	tempPath := compressedFilePath(fileInfo.TempDir, fileInfo.BaseName, cc.tempName, fileInfo.Extension)
 
 	if cc.tool.OutputMode == config.Stdout {
 		file, err := os.Create(tempPath)
@@ -601,6 +1522,7 @@ func (cc *compressionCommand) prepareSingleTempFile(fileInfo *FileInfo) (tempFil
 		}
 
 		cc.inputPaths = []string{tempPath}
+		cc.copiedInputs = map[string]string{tempPath: fileInfo.Path}
 	} else {
 		cc.inputPaths = []string{fileInfo.Path, tempPath}
 	}
@@ -614,9 +1536,10 @@ func (cc *compressionCommand) prepareSingleTempFile(fileInfo *FileInfo) (tempFil
 func (cc *compressionCommand) prepareTempFiles(fileInfo []*FileInfo) (tempFiles []TempFile) {
 	tempFiles = make([]TempFile, len(fileInfo))
 	cc.inputPaths = make([]string, 0, len(fileInfo))
+	cc.copiedInputs = make(map[string]string, len(fileInfo))
 
 	for i, file := range fileInfo {
-		tempPath := compressedFilePath(os.TempDir(), file.BaseName, cc.toolName, file.Extension)
+		tempPath := compressedFilePath(file.TempDir, file.BaseName, cc.tempName, file.Extension)
 		err := copyFileTo(file.Path, tempPath)
 
 		tempFiles[i] = TempFile{
@@ -630,6 +1553,7 @@ func (cc *compressionCommand) prepareTempFiles(fileInfo []*FileInfo) (tempFiles
 		}
 
 		cc.inputPaths = append(cc.inputPaths, tempPath)
+		cc.copiedInputs[tempPath] = file.Path
 	}
 
 	return tempFiles
@@ -672,7 +1596,29 @@ func (cc *compressionCommand) writeCommandLine(commandListBuilder *strings.Build
 	commandListBuilder.WriteByte('\n')
 }
 
+func writeChainLine(commandListBuilder *strings.Builder, chainName string, chain ExecutedChain) {
+	commandListBuilder.WriteString("| ")
+	commandListBuilder.WriteString(chainName)
+	commandListBuilder.WriteString(": ")
+
+	for i, stage := range chain.Stages {
+		if i > 0 {
+			commandListBuilder.WriteString(color.CyanString(" -> "))
+		}
+
+		commandListBuilder.WriteString(stage.Name)
+		if len(stage.Arguments) > 0 {
+			commandListBuilder.WriteByte(' ')
+			commandListBuilder.WriteString(strings.Join(stage.Arguments, " "))
+		}
+	}
+
+	commandListBuilder.WriteByte('\n')
+}
+
 func (cc *compressionCommand) prepareCommand(ctx context.Context) {
+	cc.ctx = ctx
+
 	var commandString string
 	usedArgs := make([]string, 0, len(cc.tool.Arguments)+len(cc.inputPaths))
 
@@ -689,26 +1635,70 @@ func (cc *compressionCommand) prepareCommand(ctx context.Context) {
 	usedArgs = append(usedArgs, cc.tool.Arguments...)
 	usedArgs = append(usedArgs, cc.inputPaths...)
 
-	cc.command = exec.CommandContext(ctx, commandString, usedArgs...)
+	cc.commandPath, cc.commandArgs = commandString, usedArgs
+	cc.newCommand()
+
+	cc.isAvailable = true
+}
+
+// Creates the command to run, once per attempt as commands can't be started twice.
+func (cc *compressionCommand) newCommand() {
+	// Cancelled separately from ctx on timeout
+	cc.commandCtx, cc.cancelCommand = context.WithCancelCause(cc.ctx)
+
+	cc.command = exec.CommandContext(cc.commandCtx, cc.commandPath, cc.commandArgs...)
 	if cc.stdoutFile != nil {
 		cc.command.Stdout = cc.stdoutFile
 	}
 
-	cc.isAvailable = true
+	// Stopped along with its children on timeout or interruption, as wrappers (eg. wine, scripts) run the actual tool
+	// as a child that would otherwise keep running
+	setProcessGroup(cc.command)
+
+	err := limitCommand(cc.command, cc.tool.Limits)
+	if err != nil {
+		prints.Warnf("Cannot apply limits to %s: %v\n", cc.toolName, err)
+	}
+
+	command := cc.command
+	command.Cancel = func() error {
+		cc.cancelledAt = time.Now()
+		if cc.tool.TimeoutGrace <= 0 {
+			return killProcessGroup(command.Process)
+		}
+
+		// Ask to terminate first, the process group is killed once the grace period is over
+		return terminateProcessGroup(command.Process)
+	}
+
+	command.WaitDelay = cc.tool.TimeoutGrace
+
+	if cc.output != nil {
+		cc.setStdoutAndErr(cc.output)
+	}
 }
 
 func (cc *compressionCommand) setStdoutAndErr(writer io.Writer) {
+	cc.output = writer
+
 	_, isOsFile := cc.command.Stdout.(*os.File)
 	if !isOsFile {
 		cc.command.Stdout = writer
 	}
 
 	cc.command.Stderr = writer
+	if cc.tool.Limits.MemoryLimit > 0 || (cc.tool.Retries > 0 && len(cc.tool.RetryPatterns) > 0) {
+		cc.stderrTail = &tailBuffer{}
+		cc.command.Stderr = io.MultiWriter(writer, cc.stderrTail)
+	}
 }
 
 var errCmdNotFound = errors.New("tool not found")
 var errNoInput = errors.New("no input given")
 
+var ErrTimedOut = errors.New("timed out")
+var ErrInterrupted = errors.New("interrupted")
+
 func (cc *compressionCommand) executeAndReport() {
 	if !cc.isAvailable {
 		cc.commandError = errCmdNotFound
@@ -724,15 +1714,85 @@ func (cc *compressionCommand) executeAndReport() {
 		return
 	}
 
-	start := time.Now()
-	err := cc.command.Run()
+	hasSlot := false
+	if cc.scheduler != nil {
+		err := cc.scheduler.Acquire(cc.ctx, cc.priority)
+		if err != nil && cc.ctx.Err() != nil {
+			cc.commandError = ErrInterrupted
+			return // Not worth a warning, every queued tool stops the same way
+		} else if err != nil {
+			cc.commandError = err
 
-	cc.timeTaken = time.Since(start)
+			prints.Warnf("Cannot start %s: %v\n", cc.toolName, err)
+			return
+		}
 
-	if err != nil {
+		hasSlot = true
+		defer func() {
+			if hasSlot {
+				cc.scheduler.Release()
+			}
+		}()
+	}
+
+	cc.notifyStarted()
+	defer cc.notifyFinished()
+
+	cc.attempts = 1
+	err := cc.run()
+	for err != nil && cc.isRetryable(err) {
+		delay := cc.tool.RetryDelay(cc.attempts)
+		prints.Warnf("%s failed on attempt %d of %d in %s: %v. Retrying in %s...\n",
+			cc.toolName, cc.attempts, cc.tool.Retries+1, cc.timeTaken.String(), err, delay.String())
+
+		// Other tools may run while waiting
+		if hasSlot {
+			cc.scheduler.Release()
+			hasSlot = false
+		}
+
+		if !sleepContext(cc.ctx, delay) {
+			break
+		}
+
+		if cc.scheduler != nil {
+			if cc.scheduler.Acquire(cc.ctx, cc.priority) != nil {
+				break // Only fails once interrupted
+			}
+
+			hasSlot = true
+		}
+
+		errReset := cc.resetForRetry()
+		if errReset != nil {
+			prints.Warnf("Cannot retry %s: %v\n", cc.toolName, errReset)
+			break
+		}
+
+		cc.attempts++
+		err = cc.run()
+	}
+
+	if err != nil && errors.Is(context.Cause(cc.commandCtx), ErrTimedOut) {
+		cc.commandError = fmt.Errorf("%w after %v", ErrTimedOut, cc.tool.TimeLimit)
+
+		prints.Warnf("%s timed out after %s and was stopped\n", cc.toolName, cc.tool.TimeLimit.String())
+		return
+	} else if err != nil && cc.ctx.Err() != nil {
+		cc.commandError = fmt.Errorf("%w: %v", ErrInterrupted, err)
+
+		prints.Warnf("%s was stopped by an interrupt after %s\n", cc.toolName, cc.timeTaken.String())
+		return
+	} else if err != nil && cc.isMemoryLimitExceeded() {
+		cc.commandError = fmt.Errorf("%w of %s: %v", ErrMemoryLimit, cc.tool.Limits.MemoryLimit.String(), err)
+
+		prints.Warnf("%s exceeded its memory limit of %s in %s and failed: %v\n",
+			cc.toolName, cc.tool.Limits.MemoryLimit.String(), cc.timeTaken.String(), err)
+		return
+	} else if err != nil {
 		cc.commandError = err
 
-		prints.Warnf("%s errored in %s: %v\n", cc.toolName, cc.timeTaken.String(), err)
+		prints.Warnf("%s errored in %s%s: %v\n", cc.toolName, cc.timeTaken.String(), cc.attemptsString(), err)
 		return
 	} else if cc.stdoutFile != nil {
 		err := cc.stdoutFile.Close()
@@ -744,7 +1804,192 @@ func (cc *compressionCommand) executeAndReport() {
 		}
 	}
 
-	prints.Println(cc.toolName, "finished in", cc.timeTaken.String())
+	if cc.progress == nil {
+		prints.Println(cc.toolName, "finished in", cc.timeTaken.String()+cc.attemptsString(), color.CyanString(cc.resources.summaryString()))
+	}
+}
+
+// Runs the command once, timing it and measuring its resource usage.
+func (cc *compressionCommand) run() error {
+	defer cc.cancelCommand(nil)
+
+	if cc.tool.TimeLimit > 0 {
+		timer := time.AfterFunc(cc.tool.TimeLimit, func() {
+			cc.cancelCommand(ErrTimedOut)
+		})
+
+		defer timer.Stop()
+	}
+
+	// Timed after being scheduled, waiting for other processes is not included
+	start := time.Now()
+	err := cc.command.Start()
+	if err == nil {
+		runningTools.add(cc.command.Process)
+		err = cc.command.Wait()
+
+		if cc.commandCtx.Err() != nil {
+			stopProcessGroup(cc.command.Process, cc.cancelledAt.Add(cc.tool.TimeoutGrace))
+		}
+
+		runningTools.remove(cc.command.Process)
+	}
+
+	cc.timeTaken = time.Since(start)
+	cc.resources = processResourceUsage(cc.command.ProcessState)
+
+	return err
+}
+
+// Processes of the tools that are running, across every `CompressionProcess`
+var runningTools = processSet{processes: make(map[*os.Process]struct{})}
+
+type processSet struct {
+	mutex     sync.Mutex
+	processes map[*os.Process]struct{}
+}
+
+func (ps *processSet) add(process *os.Process) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	ps.processes[process] = struct{}{}
+}
+
+func (ps *processSet) remove(process *os.Process) {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	delete(ps.processes, process)
+}
+
+// Kills every running tool along with its children, without waiting for them. Meant for aborting right before
+// exiting, the results of the killed tools are lost.
+func KillRunningTools() {
+	runningTools.mutex.Lock()
+	defer runningTools.mutex.Unlock()
+
+	for process := range runningTools.processes {
+		_ = killProcessGroup(process)
+	}
+}
+
+// Waits for the rest of the process group of the stopped `process` to exit until `deadline`, then kills what is left
+// of it. Children may outlive the process and keep writing into temp files otherwise, which must only be removed once
+// they are gone.
+func stopProcessGroup(process *os.Process, deadline time.Time) {
+	const pollInterval = 10 * time.Millisecond
+	const killTimeout = 5 * time.Second // Processes stuck in the kernel can't be killed, give up on them
+
+	for isProcessGroupRunning(process) && time.Now().Before(deadline) {
+		time.Sleep(pollInterval)
+	}
+
+	if !isProcessGroupRunning(process) {
+		return
+	}
+
+	_ = killProcessGroup(process)
+
+	killDeadline := time.Now().Add(killTimeout)
+	for isProcessGroupRunning(process) && time.Now().Before(killDeadline) {
+		time.Sleep(pollInterval)
+	}
+}
+
+// Returns `true` if the tool has retries left and `err` is a failure it may be retried on. Timeouts, exceeded memory
+// limits, cancellations and tools that could not start fail right away. Returns `false` otherwise.
+func (cc *compressionCommand) isRetryable(err error) bool {
+	if cc.attempts > cc.tool.Retries || cc.ctx.Err() != nil {
+		return false
+	}
+
+	if errors.Is(context.Cause(cc.commandCtx), ErrTimedOut) || cc.isMemoryLimitExceeded() {
+		return false
+	}
+
+	var exitError *exec.ExitError
+	if !errors.As(err, &exitError) {
+		return false
+	}
+
+	var stderr []byte
+	if cc.stderrTail != nil {
+		stderr = cc.stderrTail.bytes()
+	}
+
+	return cc.tool.IsRetryableFailure(exitError.ExitCode(), stderr)
+}
+
+// Restores the outputs and inputs of the failed attempt, and creates the command of the next one.
+func (cc *compressionCommand) resetForRetry() error {
+	if cc.stdoutFile != nil {
+		err := cc.stdoutFile.Truncate(0)
+		if err != nil {
+			return err
+		}
+
+		_, err = cc.stdoutFile.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Tools that overwrite their inputs may have left them half-written
+	for tempPath, originalPath := range cc.copiedInputs {
+		err := copyFileTo(originalPath, tempPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	cc.newCommand()
+	return nil
+}
+
+// Returns the amount of attempts to append to messages, if the tool was retried.
+func (cc *compressionCommand) attemptsString() string {
+	return attemptsTag(cc.attempts)
+}
+
+func attemptsTag(attempts int) string {
+	if attempts <= 1 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (%d attempts)", attempts)
+}
+
+// Waits for `delay`. Returns `false` if `ctx` is cancelled before then, `true` otherwise.
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Returns `true` if the failed tool has a memory limit and either printed an allocation failure or came close to the
+// limit. Other crashes are ordinary failures. Returns `false` otherwise.
+func (cc *compressionCommand) isMemoryLimitExceeded() bool {
+	if cc.tool.Limits.MemoryLimit <= 0 || cc.command.ProcessState == nil {
+		return false
+	}
+
+	// Killed by cancellation instead
+	if cc.ctx.Err() != nil {
+		return false
+	}
+
+	if cc.stderrTail != nil && cc.stderrTail.hasOutOfMemoryMessage() {
+		return true
+	}
+
+	return cc.resources.PeakMemory >= int64(float64(cc.tool.Limits.MemoryLimit)*memoryLimitReachedRatio)
 }
 
 func (cc *compressionCommand) generateSingleResult(originalFileInfo *FileInfo, tempFile TempFile) (result *CompressionResult) {
@@ -753,10 +1998,12 @@ func (cc *compressionCommand) generateSingleResult(originalFileInfo *FileInfo, t
 		Arguments: cc.tool.Arguments,
 		IsWrapped: cc.wrapper != "",
 
-		FinalSize: originalFileInfo.Size,
+		FinalSize:    originalFileInfo.Size,
 		OriginalSize: originalFileInfo.Size,
 
 		TimeTaken: cc.timeTaken,
+		Resources: cc.resources,
+		Attempts:  cc.attempts,
 
 		CommandError:       nil,
 		ReadFinalSizeError: nil,
@@ -812,6 +2059,8 @@ func getFileInfo(path string) (FileInfo, error) {
 
 		Size: originalSize,
 
+		TempDir: os.TempDir(),
+
 		// Keep decode time optional
 	}, err
 }
@@ -842,6 +2091,17 @@ func copyFileTo(pathSrc, pathDest string) (err error) {
 	return err
 }
 
+func copyFileToWriter(pathSrc string, writer io.Writer) (err error) {
+	source, err := os.Open(pathSrc)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	_, err = io.Copy(writer, source)
+	return err
+}
+
 func moveFile(pathSrc, pathDest string) error {
 	err := os.Rename(pathSrc, pathDest)
 	if err == nil {
@@ -851,10 +2111,20 @@ func moveFile(pathSrc, pathDest string) error {
 	var linkErr *os.LinkError
 	if errors.As(err, &linkErr) {
 		// Assume cross-device error or something that requires a fallback, try again
+		info, err := os.Stat(pathSrc)
+		if err != nil {
+			return err
+		}
+
 		if err := copyFileTo(pathSrc, pathDest); err != nil {
 			return err
 		}
 
+		// Same mode as renaming would leave, attributes of the original are preserved afterwards
+		if err := os.Chmod(pathDest, info.Mode().Perm()); err != nil {
+			return err
+		}
+
 		return os.Remove(pathSrc)
 	}
 
@@ -0,0 +1,220 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+// Environment of the halving tool, see `TestHelperHalvingTool()`
+const (
+	halvingToolEnv = "COMPACTY_HALVING_TOOL" // Set to run as the halving tool
+	releaseEnv     = "COMPACTY_HALVING_RELEASE"
+)
+
+// Not a test, acts as a tool run by `TestCompressFiles()` when the test binary is run with `halvingToolEnv` set.
+// Writes the first half of its input to its output. Inputs named "slow" wait until the file at `releaseEnv` exists.
+func TestHelperHalvingTool(t *testing.T) {
+	if os.Getenv(halvingToolEnv) == "" {
+		t.Skip("only run as a tool by other tests")
+	}
+
+	inputPath, outputPath := flag.Arg(0), flag.Arg(1)
+	if strings.HasPrefix(filepath.Base(inputPath), "slow") {
+		for {
+			if _, err := os.Stat(os.Getenv(releaseEnv)); err == nil {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(outputPath, data[:len(data)/2], rw_r__r__); err != nil {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func TestCompressFiles(t *testing.T) {
+	dir := t.TempDir()
+	releasePath := filepath.Join(dir, "release")
+	t.Setenv(halvingToolEnv, "1")
+	t.Setenv(releaseEnv, releasePath)
+
+	// Larger files start first, the slow one takes a slot until it is released
+	names := []string{"slow", "fast-a", "fast-b"}
+	contents := make(map[string][]byte)
+	paths := make([]string, len(names))
+	for i, name := range names {
+		contents[name] = bytes.Repeat([]byte(name), 100*(len(names)-i))
+		paths[i] = filepath.Join(dir, name+".png")
+		if err := os.WriteFile(paths[i], contents[name], rw_r__r__); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, ok := NewCompressionProcess(paths, nil, io.Discard)
+	if !ok {
+		t.Fatal("NewCompressionProcess() failed")
+	}
+
+	workspace, err := NewWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UseWorkspace(workspace); err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.CleanUp()
+
+	c.Scheduler = NewScheduler(2)
+	tools := map[string]ExecutedTool{
+		"halve": {
+			CompressionTool: &config.CompressionTool{
+				Command:    os.Args[0],
+				Platform:   []string{runtime.GOOS},
+				OutputMode: config.InputOutput,
+			},
+			Arguments: []string{"-test.run=^TestHelperHalvingTool$"},
+		},
+	}
+
+	finished := c.CompressFiles(context.Background(), nil, tools, nil, 2)
+
+	receive := func() (fileIdx int, ok bool) {
+		select {
+		case fileIdx, ok = <-finished:
+			return fileIdx, ok
+		case <-time.After(10 * time.Second):
+			t.Fatal("no file finished in time")
+			return 0, false
+		}
+	}
+
+	// Both fast files finish and are written while the slow one is still running
+	for range 2 {
+		fileIdx, ok := receive()
+		if !ok {
+			t.Fatal("finished is closed before every file finished")
+		}
+
+		if names[fileIdx] == "slow" {
+			t.Fatal("slow file finished before it was released")
+		}
+
+		if !c.SaveFileResultAndReport(fileIdx, KeepBest) {
+			t.Errorf("SaveFileResultAndReport() of %s failed", names[fileIdx])
+		}
+	}
+
+	if result := c.Results["halve"][0]; result != nil {
+		t.Errorf("result of the slow file = %+v before it finished, want nil", result)
+	}
+
+	if err := os.WriteFile(releasePath, nil, rw_r__r__); err != nil {
+		t.Fatal(err)
+	}
+
+	fileIdx, ok := receive()
+	if !ok || names[fileIdx] != "slow" {
+		t.Fatalf("received file %d, %v, want the slow file", fileIdx, ok)
+	}
+
+	if !c.SaveFileResultAndReport(fileIdx, KeepBest) {
+		t.Errorf("SaveFileResultAndReport() of the slow file failed")
+	}
+
+	if _, ok := receive(); ok {
+		t.Errorf("finished is not closed after every file finished")
+	}
+
+	for i, name := range names {
+		result := c.Results["halve"][i]
+		want := contents[name][:len(contents[name])/2]
+		if result.HasError() || result.FinalSize != int64(len(want)) {
+			t.Errorf("result of %s = %+v, want %d bytes", name, result, len(want))
+		}
+
+		written, err := os.ReadFile(c.OriginalFileInfo[i].WrittenPath)
+		if err != nil || !bytes.Equal(written, want) {
+			t.Errorf("written result of %s = %q, %v, want the half of its own input", name, written, err)
+		}
+	}
+}
+
+func TestCompressFilesInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(halvingToolEnv, "1")
+	t.Setenv(releaseEnv, filepath.Join(dir, "never"))
+
+	paths := []string{filepath.Join(dir, "slow.png"), filepath.Join(dir, "slow-too.png")}
+	for _, path := range paths {
+		if err := os.WriteFile(path, []byte("contents"), rw_r__r__); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, _ := NewCompressionProcess(paths, nil, io.Discard)
+	workspace, err := NewWorkspace(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.UseWorkspace(workspace); err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.CleanUp()
+
+	tools := map[string]ExecutedTool{
+		"halve": {
+			CompressionTool: &config.CompressionTool{
+				Command:    os.Args[0],
+				Platform:   []string{runtime.GOOS},
+				OutputMode: config.InputOutput,
+			},
+			Arguments: []string{"-test.run=^TestHelperHalvingTool$"},
+		},
+	}
+
+	// Only one file runs at a time, the other one is never started
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := c.CompressFiles(ctx, nil, tools, nil, 1)
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	var received []int
+	for fileIdx := range finished {
+		received = append(received, fileIdx)
+	}
+
+	if len(received) != 1 {
+		t.Fatalf("received %v, want only the started file", received)
+	}
+
+	if result := c.Results["halve"][received[0]]; !errors.Is(result.CommandError, ErrInterrupted) {
+		t.Errorf("CommandError = %v, want %v", result.CommandError, ErrInterrupted)
+	}
+
+	if c.IsFileComplete(received[0]) {
+		t.Errorf("IsFileComplete() of the interrupted file = true, want false")
+	}
+}
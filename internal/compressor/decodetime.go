@@ -7,8 +7,13 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
+	"math"
 	"os"
+	"os/exec"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ArrayNone/compacty/internal/textutils"
@@ -16,13 +21,38 @@ import (
 )
 
 type DecodeTimeBench struct {
-	Total   time.Duration
-	Average time.Duration
+	Decoder string // `config.BuiltinDecoder` or the name of an `ExternalDecoder`
+
+	Total   time.Duration // Sum of every timed trial, excluding warmups and garbage collections
+	Average time.Duration // Mean of the trials
+	Median  time.Duration
+	P95     time.Duration // 95th percentile, trials slower than this are outliers
+	StdDev  time.Duration // Sample standard deviation of the trials
 	Trials  int
 
 	Err error
 }
 
+// How decode time is benchmarked
+type DecodeBenchOptions struct {
+	MinTime   time.Duration // Keep running trials until this much wall time passes, garbage collections included
+	Warmup    int           // Untimed decodes before the first trial, so that caches and the allocator are warm
+	PinThread bool          // Run every trial on the same OS thread
+}
+
+const (
+	minDecodeTrials = 5 // Fewer trials make the statistics meaningless, run at least this many regardless of time
+
+	nanoPerMilli = 1000000
+)
+
+// Two-sided critical values of Student's t-distribution at p = 0.05, indexed by degrees of freedom - 1
+var tCriticalValues = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
 func (dt DecodeTimeBench) MSAverageToString() string {
 	if dt.Err != nil {
 		return "ERROR: " + dt.Err.Error()
@@ -30,9 +60,7 @@ func (dt DecodeTimeBench) MSAverageToString() string {
 		return "-"
 	}
 
-	const nanoPerMilli = 1000000
-	decodeMillisecondsAverage := float64(dt.Total.Nanoseconds()) / float64(nanoPerMilli*dt.Trials)
-	return strconv.FormatFloat(decodeMillisecondsAverage, 'f', 6, 64)
+	return msString(dt.Average)
 }
 
 func (dt DecodeTimeBench) MSAverageWithTrialsCountString() string {
@@ -44,7 +72,81 @@ func (dt DecodeTimeBench) MSAverageWithTrialsCountString() string {
 	return fmt.Sprintf("%s (%d %s)", dt.MSAverageToString(), dt.Trials, trialText)
 }
 
-func benchDecodeTime(filePath string, minTime time.Duration) (result DecodeTimeBench) {
+// Returns the mean with its standard deviation, median, 95th percentile and trial count.
+func (dt DecodeTimeBench) MSStatisticsString() string {
+	if dt.Err != nil || dt.Trials == 0 || dt.Total == 0 {
+		return dt.MSAverageToString()
+	}
+
+	trialText := textutils.PluralNoun(dt.Trials, "trials", "trial")
+	return fmt.Sprintf(
+		"%s ±%s (median %s, p95 %s, %d %s)",
+		msString(dt.Average), msString(dt.StdDev), msString(dt.Median), msString(dt.P95), dt.Trials, trialText,
+	)
+}
+
+// Returns `field` in milliseconds, or "-" if nothing is measured.
+func (dt DecodeTimeBench) MSString(field time.Duration) string {
+	if dt.Err != nil || dt.Trials == 0 || dt.Total == 0 {
+		return "-"
+	}
+
+	return msString(field)
+}
+
+// Returns `true` if both benchmarks are measured and their means differ according to Welch's t-test at p < 0.05.
+// Returns `false` otherwise, where the difference may only be noise.
+func (dt DecodeTimeBench) IsSignificantlyDifferent(other DecodeTimeBench) bool {
+	if dt.Err != nil || other.Err != nil || dt.Trials < 2 || other.Trials < 2 {
+		return false
+	}
+
+	varianceA := math.Pow(float64(dt.StdDev), 2) / float64(dt.Trials)
+	varianceB := math.Pow(float64(other.StdDev), 2) / float64(other.Trials)
+	standardError := math.Sqrt(varianceA + varianceB)
+	if standardError == 0 {
+		return dt.Average != other.Average
+	}
+
+	t := math.Abs(float64(dt.Average-other.Average)) / standardError
+
+	// Welch-Satterthwaite equation
+	degreesOfFreedom := math.Pow(varianceA+varianceB, 2) /
+		(math.Pow(varianceA, 2)/float64(dt.Trials-1) + math.Pow(varianceB, 2)/float64(other.Trials-1))
+
+	return t > tCriticalValue(degreesOfFreedom)
+}
+
+func tCriticalValue(degreesOfFreedom float64) float64 {
+	switch df := int(degreesOfFreedom); {
+	case df < 1:
+		return tCriticalValues[0]
+	case df <= len(tCriticalValues):
+		return tCriticalValues[df-1]
+	case df <= 60:
+		return 2.000
+	case df <= 120:
+		return 1.980
+	}
+
+	return 1.960
+}
+
+func msString(d time.Duration) string {
+	return strconv.FormatFloat(float64(d.Nanoseconds())/nanoPerMilli, 'f', 6, 64)
+}
+
+// Decoder run by `BenchmarkDecodeTime()` alongside Go's built-in decoders. Runs once per trial, with the path of the
+// decoded file appended to `Arguments`.
+type ExternalDecoder struct {
+	Name             string
+	Command          string
+	Arguments        []string
+	SupportedFormats []string
+}
+
+// Benchmarks Go's built-in decoder for the format of the file. Nothing is measured if there is no such decoder.
+func benchBuiltinDecodeTime(filePath string, options DecodeBenchOptions) (result DecodeTimeBench) {
 	data, err := os.ReadFile(filePath)
 	if err != nil {
 		return DecodeTimeBench{Err: err}
@@ -61,26 +163,92 @@ func benchDecodeTime(filePath string, minTime time.Duration) (result DecodeTimeB
 		return DecodeTimeBench{}
 	}
 
-	_, _ = reader.Seek(0, io.SeekStart)
-	err = decodeFunc(reader)
+	return benchDecodeTrials(options, func() error {
+		_, _ = reader.Seek(0, io.SeekStart)
+		return decodeFunc(reader)
+	})
+}
+
+// Benchmarks `decoder` by running it on the file, process startup included.
+func benchExternalDecodeTime(filePath string, decoder ExternalDecoder, options DecodeBenchOptions) (result DecodeTimeBench) {
+	arguments := append(slices.Clone(decoder.Arguments), filePath)
+
+	return benchDecodeTrials(options, func() error {
+		stderr := &bytes.Buffer{}
+
+		command := exec.Command(decoder.Command, arguments...)
+		command.Stdout = io.Discard
+		command.Stderr = stderr
+
+		err := command.Run()
+		if err != nil && stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+
+		return err
+	})
+}
+
+// Runs `decode` once to check for errors, then `options.Warmup` times untimed, then times it until `options.MinTime`
+// passes.
+func benchDecodeTrials(options DecodeBenchOptions, decode func() error) (result DecodeTimeBench) {
+	err := decode()
 	if err != nil { // Minimise interference by only checking once
 		return DecodeTimeBench{Err: err}
 	}
 
-	var totalTime time.Duration
-	var trials int
+	if options.PinThread {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+	}
+
+	for range options.Warmup {
+		_ = decode()
+	}
+
+	var samples []time.Duration
 
 	start := time.Now()
-	for totalTime < minTime {
-		_, _ = reader.Seek(0, io.SeekStart)
-		_ = decodeFunc(reader)
+	for time.Since(start) < options.MinTime || len(samples) < minDecodeTrials {
+		// Start every trial on a collected heap so that collections rarely land inside it. The collector is left on,
+		// other goroutines may still be allocating
+		runtime.GC()
+
+		sampleStart := time.Now()
+		_ = decode()
+		samples = append(samples, time.Since(sampleStart))
+	}
+
+	return decodeStatistics(samples)
+}
+
+func decodeStatistics(samples []time.Duration) (result DecodeTimeBench) {
+	slices.Sort(samples)
+
+	result.Trials = len(samples)
+	for _, sample := range samples {
+		result.Total += sample
+	}
+
+	result.Average = result.Total / time.Duration(result.Trials)
+	result.Median = samples[result.Trials/2]
+	if result.Trials%2 == 0 {
+		result.Median = (samples[result.Trials/2-1] + samples[result.Trials/2]) / 2
+	}
+
+	// Nearest rank
+	result.P95 = samples[int(math.Ceil(0.95*float64(result.Trials)))-1]
 
-		totalTime = time.Since(start)
+	if result.Trials > 1 {
+		sumSquares := 0.0
+		for _, sample := range samples {
+			sumSquares += math.Pow(float64(sample-result.Average), 2)
+		}
 
-		trials++
+		result.StdDev = time.Duration(math.Sqrt(sumSquares / float64(result.Trials-1)))
 	}
 
-	return DecodeTimeBench{Total: totalTime, Average: totalTime / time.Duration(trials), Trials: trials}
+	return result
 }
 
 func getDecodeFunc(mime *mimetype.MIME) (decodeFunc func(io.Reader) error, ok bool) {
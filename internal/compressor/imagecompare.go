@@ -0,0 +1,327 @@
+package compressor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/ArrayNone/compacty/internal/maputils"
+	"github.com/ArrayNone/compacty/internal/prints"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+type PixelCheck int
+
+const (
+	PixelsUnchecked   PixelCheck = iota // Verification is disabled
+	PixelsMatch                         // Decoded pixels are the same as the original's
+	PixelsDiffer                        // Decoded pixels are different, or the result cannot be decoded
+	PixelsUnsupported                   // File format cannot be decoded with Go's native libraries
+)
+
+type decodedImage struct {
+	frames []image.Image
+	delays []int // GIF only, in 100ths of a second
+}
+
+var errPixelsUnsupported = errors.New("file format cannot be decoded")
+
+// Returns the name stored in the cache. Returns "" for `PixelsUnchecked`.
+func (pc PixelCheck) String() string {
+	switch pc {
+	case PixelsMatch:
+		return "match"
+	case PixelsDiffer:
+		return "differ"
+	case PixelsUnsupported:
+		return "unsupported"
+	}
+
+	return ""
+}
+
+func parsePixelCheck(name string) PixelCheck {
+	switch name {
+	case "match":
+		return PixelsMatch
+	case "differ":
+		return PixelsDiffer
+	case "unsupported":
+		return PixelsUnsupported
+	}
+
+	return PixelsUnchecked
+}
+
+// Returns `true` if the result changed the pixels of a lossless preset, its quality is below the minimum or it lacks
+// metadata kept by the policy, and must not be picked. Returns `false` otherwise.
+func (r *CompressionResult) IsDisqualified() bool {
+	return r.Pixels == PixelsDiffer || r.Quality.IsBelowMinimum || r.Metadata.Err != nil || len(r.Metadata.Missing) > 0
+}
+
+// Decodes the original file and every successful result, then compares them. If `VerifyPixels` is set, results
+// with different pixels are disqualified. If `ComputeQuality` is set, their quality is scored and results below
+// `MinQuality` are disqualified, along with results that cannot be scored, such as when the original's format cannot
+// be decoded. Cached results keep their stored outcomes.
+func (c *CompressionProcess) inspectResults(fileIdx int) {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	var original *decodedImage
+	var originalErr error
+	isDecoded := false
+
+	for _, toolName := range maputils.SortedKeys(c.Results) {
+		result := c.Results[toolName][fileIdx]
+		if result == nil || result.HasError() || result.IsCached {
+			continue
+		}
+
+		if !isDecoded {
+			original, originalErr = decodeImageFile(fileInfo.Path)
+			isDecoded = true
+
+			if originalErr != nil && !errors.Is(originalErr, errPixelsUnsupported) {
+				prints.Warnf("Cannot decode %s to inspect its results: %v\n", fileInfo.Path, originalErr)
+			}
+		}
+
+		if originalErr != nil {
+			if c.VerifyPixels {
+				result.Pixels = PixelsUnsupported
+			}
+
+			if c.ComputeQuality && c.MinQuality > 0 {
+				c.disqualifyUnscoredQuality(toolName, result, originalErr)
+			}
+
+			continue
+		}
+
+		candidate, err := decodeImageFile(c.TempFiles[toolName][fileIdx].Path)
+
+		if c.VerifyPixels {
+			c.verifyPixels(toolName, result, original, candidate, err)
+		}
+
+		if c.ComputeQuality {
+			c.scoreQuality(toolName, result, original, candidate, err)
+		}
+	}
+}
+
+// Disqualifies `result`, which cannot be scored as the original cannot be decoded, so that the minimum is never assumed
+// to be met.
+func (c *CompressionProcess) disqualifyUnscoredQuality(toolName string, result *CompressionResult, originalErr error) {
+	result.Quality = QualityScore{
+		Err:            fmt.Errorf("original cannot be decoded: %w", originalErr),
+		IsBelowMinimum: true,
+	}
+
+	prints.Warnf(
+		"%s is disqualified, its quality cannot be scored to meet the minimum of %s: %v\n",
+		toolName, strconv.FormatFloat(c.MinQuality, 'f', -1, 64), result.Quality.Err,
+	)
+}
+
+func (c *CompressionProcess) verifyPixels(
+	toolName string,
+	result *CompressionResult,
+	original, candidate *decodedImage,
+	decodeErr error,
+) {
+
+	err := decodeErr
+	if err == nil {
+		err = compareDecodedImages(original, candidate)
+	}
+
+	if err != nil {
+		result.Pixels = PixelsDiffer
+		result.PixelsError = err
+		prints.Warnf("%s is disqualified, its result is not lossless: %v\n", toolName, err)
+	} else {
+		result.Pixels = PixelsMatch
+	}
+}
+
+// Returns `true` if the file's format can be decoded to inspect results. Returns `false` otherwise.
+func canDecodeImage(path string) bool {
+	mimeType, err := mimetype.DetectFile(path)
+	if err != nil {
+		return false
+	}
+
+	_, ok := getImageDecodeFunc(mimeType)
+	return ok
+}
+
+func decodeImageFile(path string) (decoded *decodedImage, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(data)
+	mimeType, err := mimetype.DetectReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	decodeFunc, ok := getImageDecodeFunc(mimeType)
+	if !ok {
+		return nil, errPixelsUnsupported
+	}
+
+	_, _ = reader.Seek(0, io.SeekStart)
+	return decodeFunc(reader)
+}
+
+// Same decoders as `getDecodeFunc()`, but returns the decoded image. Every frame of GIFs is decoded.
+func getImageDecodeFunc(mime *mimetype.MIME) (decodeFunc func(io.Reader) (*decodedImage, error), ok bool) {
+	switch {
+	case mime.Is("image/png"):
+		return func(r io.Reader) (*decodedImage, error) {
+			img, err := png.Decode(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return &decodedImage{frames: []image.Image{img}}, nil
+		}, true
+	case mime.Is("image/jpeg"):
+		return func(r io.Reader) (*decodedImage, error) {
+			img, err := jpeg.Decode(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return &decodedImage{frames: []image.Image{img}}, nil
+		}, true
+	case mime.Is("image/gif"):
+		return func(r io.Reader) (*decodedImage, error) {
+			animation, err := gif.DecodeAll(r)
+			if err != nil {
+				return nil, err
+			}
+
+			return &decodedImage{frames: composeGIFFrames(animation), delays: animation.Delay}, nil
+		}, true
+	}
+
+	return nil, false
+}
+
+// Draws every frame of the animation onto a canvas, the same way it's displayed. Optimisers are free to change
+// how frames are stored (cropping, disposal, transparency), so the stored frames cannot be compared directly.
+func composeGIFFrames(animation *gif.GIF) (frames []image.Image) {
+	bounds := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	canvas := image.NewNRGBA(bounds)
+
+	frames = make([]image.Image, 0, len(animation.Image))
+	for i, frame := range animation.Image {
+		var disposal byte
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewNRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		composed := image.NewNRGBA(bounds)
+		copy(composed.Pix, canvas.Pix)
+		frames = append(frames, composed)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
+func compareDecodedImages(original, candidate *decodedImage) (err error) {
+	if len(original.frames) != len(candidate.frames) {
+		return fmt.Errorf("frame count differs: %d, got %d", len(original.frames), len(candidate.frames))
+	}
+
+	if !slices.Equal(original.delays, candidate.delays) {
+		return errors.New("frame delays differ")
+	}
+
+	for i := range original.frames {
+		err = comparePixels(original.frames[i], candidate.frames[i])
+		if err != nil && len(original.frames) > 1 {
+			return fmt.Errorf("frame #%d: %w", i+1, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Compares two images pixel by pixel. The colour of fully transparent pixels (a = 0) is ignored.
+func comparePixels(original, candidate image.Image) (err error) {
+	originalBounds := original.Bounds()
+	candidateBounds := candidate.Bounds()
+
+	if originalBounds.Dx() != candidateBounds.Dx() || originalBounds.Dy() != candidateBounds.Dy() {
+		return fmt.Errorf(
+			"dimensions differ: %dx%d, got %dx%d",
+			originalBounds.Dx(), originalBounds.Dy(), candidateBounds.Dx(), candidateBounds.Dy(),
+		)
+	}
+
+	for y := range originalBounds.Dy() {
+		for x := range originalBounds.Dx() {
+			originalPixel := toNRGBA64(original.At(originalBounds.Min.X+x, originalBounds.Min.Y+y))
+			candidatePixel := toNRGBA64(candidate.At(candidateBounds.Min.X+x, candidateBounds.Min.Y+y))
+
+			if originalPixel.A == 0 && candidatePixel.A == 0 {
+				continue
+			}
+
+			if originalPixel != candidatePixel {
+				return fmt.Errorf("pixel at (%d, %d) differs", x, y)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Converts without premultiplying first, so that colours of translucent pixels are compared exactly.
+func toNRGBA64(c color.Color) color.NRGBA64 {
+	switch c := c.(type) {
+	case color.NRGBA:
+		return color.NRGBA64{
+			R: uint16(c.R) * 0x101,
+			G: uint16(c.G) * 0x101,
+			B: uint16(c.B) * 0x101,
+			A: uint16(c.A) * 0x101,
+		}
+	case color.NRGBA64:
+		return c
+	}
+
+	return color.NRGBA64Model.Convert(c).(color.NRGBA64)
+}
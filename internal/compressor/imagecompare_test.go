@@ -0,0 +1,300 @@
+package compressor
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	transparent = color.NRGBA{}
+	red         = color.NRGBA{R: 255, A: 255}
+	blue        = color.NRGBA{B: 255, A: 255}
+	green       = color.NRGBA{G: 255, A: 255}
+
+	gifPalette = color.Palette{transparent, red, blue, green}
+)
+
+// Returns a copy of `img` with the pixel at (x, y) replaced by `c`.
+func withPixel(img *image.NRGBA, x, y int, c color.NRGBA) *image.NRGBA {
+	changed := image.NewNRGBA(img.Bounds())
+	copy(changed.Pix, img.Pix)
+	changed.SetNRGBA(x, y, c)
+
+	return changed
+}
+
+func reencodePNG(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := png.Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return decoded
+}
+
+func TestComparePixels(t *testing.T) {
+	textured := texturedImage(16, 16, 0)
+
+	translucent := filledImage(8, 8, color.NRGBA{R: 10, G: 20, B: 30, A: 128})
+	paletted := image.NewPaletted(image.Rect(0, 0, 8, 8), gifPalette)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(i % len(gifPalette))
+	}
+
+	palettedAsNRGBA := image.NewNRGBA(paletted.Bounds())
+	for y := range 8 {
+		for x := range 8 {
+			palettedAsNRGBA.Set(x, y, paletted.At(x, y))
+		}
+	}
+
+	shifted := image.NewNRGBA(image.Rect(5, 5, 21, 21))
+	for y := range 16 {
+		for x := range 16 {
+			shifted.SetNRGBA(x+5, y+5, textured.NRGBAAt(x, y))
+		}
+	}
+
+	tests := []struct {
+		name      string
+		original  image.Image
+		candidate image.Image
+		wantErr   string
+	}{
+		{name: "identical", original: textured, candidate: texturedImage(16, 16, 0)},
+		{name: "re-encoded", original: textured, candidate: reencodePNG(t, textured)},
+		{name: "translucent pixels re-encoded", original: translucent, candidate: reencodePNG(t, translucent)},
+		{name: "paletted and true colour", original: paletted, candidate: palettedAsNRGBA},
+		{name: "different origin", original: textured, candidate: shifted},
+		{
+			name:      "single pixel differs",
+			original:  textured,
+			candidate: withPixel(textured, 3, 4, color.NRGBA{R: 1, G: 2, B: 3, A: 255}),
+			wantErr:   "pixel at (3, 4) differs",
+		},
+		{
+			name:      "colour of fully transparent pixels",
+			original:  filledImage(8, 8, color.NRGBA{R: 255, A: 0}),
+			candidate: filledImage(8, 8, color.NRGBA{G: 255, B: 12, A: 0}),
+		},
+		{
+			name:      "colour of translucent pixels",
+			original:  translucent,
+			candidate: withPixel(translucent, 7, 7, color.NRGBA{R: 11, G: 20, B: 30, A: 128}),
+			wantErr:   "pixel at (7, 7) differs",
+		},
+		{
+			name:      "pixel made transparent",
+			original:  textured,
+			candidate: withPixel(textured, 0, 0, transparent),
+			wantErr:   "pixel at (0, 0) differs",
+		},
+		{
+			name:      "dimensions differ",
+			original:  textured,
+			candidate: texturedImage(16, 15, 0),
+			wantErr:   "dimensions differ: 16x16, got 16x15",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := comparePixels(test.original, test.candidate)
+			if test.wantErr == "" && err != nil {
+				t.Errorf("comparePixels() error = %v, want nil", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("comparePixels() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func palettedFrame(bounds image.Rectangle, c color.NRGBA) *image.Paletted {
+	frame := image.NewPaletted(bounds, gifPalette)
+	index := uint8(gifPalette.Index(c))
+	for i := range frame.Pix {
+		frame.Pix[i] = index
+	}
+
+	return frame
+}
+
+// Returns the colour of every pixel of `img`, row by row, as one letter each: R, G, B or . for transparent.
+func pixelLetters(img image.Image) string {
+	var letters strings.Builder
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			switch toNRGBA64(img.At(x, y)) {
+			case toNRGBA64(red):
+				letters.WriteByte('R')
+			case toNRGBA64(green):
+				letters.WriteByte('G')
+			case toNRGBA64(blue):
+				letters.WriteByte('B')
+			case toNRGBA64(transparent):
+				letters.WriteByte('.')
+			default:
+				letters.WriteByte('?')
+			}
+		}
+
+		letters.WriteByte('/')
+	}
+
+	return letters.String()
+}
+
+func TestComposeGIFFrames(t *testing.T) {
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			palettedFrame(image.Rect(0, 0, 4, 4), red),
+			palettedFrame(image.Rect(1, 1, 3, 3), blue),        // Cleared to the background afterwards
+			palettedFrame(image.Rect(0, 0, 1, 1), green),       // Restored to the previous canvas afterwards
+			palettedFrame(image.Rect(3, 3, 4, 4), transparent), // Draws nothing
+		},
+		Delay:    []int{10, 10, 10, 10},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalPrevious, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	want := []string{
+		"RRRR/RRRR/RRRR/RRRR/",
+		"RRRR/RBBR/RBBR/RRRR/",
+		"GRRR/R..R/R..R/RRRR/",
+		"RRRR/R..R/R..R/RRRR/",
+	}
+
+	frames := composeGIFFrames(animation)
+	if len(frames) != len(want) {
+		t.Fatalf("composeGIFFrames() returned %d frames, want %d", len(frames), len(want))
+	}
+
+	for i, frame := range frames {
+		if frame.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Errorf("frame #%d bounds = %v, want the whole canvas", i+1, frame.Bounds())
+		}
+
+		if got := pixelLetters(frame); got != want[i] {
+			t.Errorf("frame #%d = %s, want %s", i+1, got, want[i])
+		}
+	}
+}
+
+func TestCompareDecodedGIFs(t *testing.T) {
+	canvas := image.Rect(0, 0, 4, 4)
+	fullFrame := func(centre color.NRGBA) *image.Paletted {
+		frame := palettedFrame(canvas, red)
+		for y := 1; y < 3; y++ {
+			for x := 1; x < 3; x++ {
+				frame.Set(x, y, centre)
+			}
+		}
+
+		return frame
+	}
+
+	// Every frame is stored whole
+	original := &gif.GIF{
+		Image:    []*image.Paletted{fullFrame(red), fullFrame(blue), fullFrame(green)},
+		Delay:    []int{10, 20, 30},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	// The same animation as an optimiser stores it, only the changed area of later frames
+	optimised := &gif.GIF{
+		Image: []*image.Paletted{
+			fullFrame(red),
+			palettedFrame(image.Rect(1, 1, 3, 3), blue),
+			palettedFrame(image.Rect(1, 1, 3, 3), green),
+		},
+		Delay:    []int{10, 20, 30},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	// Cleared instead of drawn over, so the centre of the last frame is transparent
+	cleared := &gif.GIF{
+		Image: []*image.Paletted{
+			fullFrame(red),
+			palettedFrame(image.Rect(1, 1, 3, 3), blue),
+			palettedFrame(image.Rect(0, 0, 1, 1), red),
+		},
+		Delay:    []int{10, 20, 30},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 4, Height: 4},
+	}
+
+	slower := &gif.GIF{
+		Image:    original.Image,
+		Delay:    []int{10, 20, 40},
+		Disposal: original.Disposal,
+		Config:   original.Config,
+	}
+
+	shorter := &gif.GIF{
+		Image:    original.Image[:2],
+		Delay:    original.Delay[:2],
+		Disposal: original.Disposal[:2],
+		Config:   original.Config,
+	}
+
+	decode := func(t *testing.T, animation *gif.GIF) *decodedImage {
+		t.Helper()
+
+		path := filepath.Join(t.TempDir(), "animation.gif")
+		var encoded bytes.Buffer
+		if err := gif.EncodeAll(&encoded, animation); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, encoded.Bytes(), rw_r__r__); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, err := decodeImageFile(path)
+		if err != nil {
+			t.Fatalf("decodeImageFile() error = %v", err)
+		}
+
+		return decoded
+	}
+
+	tests := []struct {
+		name      string
+		candidate *gif.GIF
+		wantErr   string
+	}{
+		{name: "re-encoded", candidate: original},
+		{name: "optimised frames", candidate: optimised},
+		{name: "different disposal", candidate: cleared, wantErr: "frame #3: pixel at (1, 1) differs"},
+		{name: "different delays", candidate: slower, wantErr: "frame delays differ"},
+		{name: "missing frame", candidate: shorter, wantErr: "frame count differs: 3, got 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := compareDecodedImages(decode(t, original), decode(t, test.candidate))
+			if test.wantErr == "" && err != nil {
+				t.Errorf("compareDecodedImages() error = %v, want nil", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("compareDecodedImages() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
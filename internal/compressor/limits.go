@@ -0,0 +1,69 @@
+package compressor
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+var ErrMemoryLimit = errors.New("exceeded memory limit")
+
+// Bytes kept from the end of the stderr of tools with a memory limit or retry patterns, to tell allocation failures
+// and retryable failures apart from other errors
+const stderrTailSize = 4096
+
+// Failed tools with a peak resident set size of at least this much of their memory limit are assumed to have
+// exceeded it. Lower than 1, as the limit also counts address space that is reserved but never used
+const memoryLimitReachedRatio = 0.9
+
+// Messages tools and runtimes print when an allocation fails, matched case-insensitively
+var outOfMemoryMessages = [][]byte{
+	[]byte("out of memory"),
+	[]byte("cannot allocate memory"),
+	[]byte("memory allocation failed"),
+	[]byte("failed to allocate"),
+	[]byte("bad_alloc"),
+	[]byte("enomem"),
+	[]byte("memoryerror"),
+}
+
+// Keeps the last `stderrTailSize` bytes written to it.
+type tailBuffer struct {
+	mutex sync.Mutex
+	tail  []byte
+}
+
+func (tb *tailBuffer) Write(p []byte) (n int, err error) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tb.tail = append(tb.tail, p...)
+	if excess := len(tb.tail) - stderrTailSize; excess > 0 {
+		tb.tail = tb.tail[excess:]
+	}
+
+	return len(p), nil
+}
+
+// Returns a copy of the kept output.
+func (tb *tailBuffer) bytes() []byte {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	return bytes.Clone(tb.tail)
+}
+
+// Returns `true` if the output has a message of a failed allocation. Returns `false` otherwise.
+func (tb *tailBuffer) hasOutOfMemoryMessage() bool {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	lowered := bytes.ToLower(tb.tail)
+	for _, message := range outOfMemoryMessages {
+		if bytes.Contains(lowered, message) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,148 @@
+//go:build linux
+
+package compressor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/prints"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+var ioprioClasses = map[config.IOPriorityClass]int{
+	config.IOPriorityRealtime:   1,
+	config.IOPriorityBestEffort: 2,
+	config.IOPriorityIdle:       3,
+}
+
+// Set on commands limited by `limitCommand()`, holds the `limitedExec` to run as JSON
+const limitsEnv = "COMPACTY_TOOL_LIMITS"
+
+type limitedExec struct {
+	Path   string // Executable of the tool
+	Limits config.Limits
+}
+
+func init() {
+	// Started by `limitCommand()` to run a tool, never returns
+	if encoded, ok := os.LookupEnv(limitsEnv); ok {
+		execLimited(encoded)
+	}
+}
+
+// Makes `command` apply `limits` before the tool runs. Go offers no way to run code between fork and exec, so this
+// executable is started instead. It applies the limits to itself, then execs the tool in place, which keeps the
+// arguments and process of the command. See `execLimited()`.
+func limitCommand(command *exec.Cmd, limits config.Limits) error {
+	if limits.IsZero() {
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(limitedExec{Path: command.Path, Limits: limits})
+	if err != nil {
+		return err
+	}
+
+	env := command.Env
+	if env == nil {
+		env = os.Environ()
+	}
+
+	command.Env = append(env, limitsEnv+"="+string(encoded))
+	command.Path = self
+
+	return nil
+}
+
+// Applies the limits of `encoded` to this process, then replaces it with the tool. Limits that cannot be applied are
+// warned about on the tool's stderr, and the tool runs regardless.
+func execLimited(encoded string) {
+	// Nice, IO priority and affinity are per thread, exec keeps those of the calling thread
+	runtime.LockOSThread()
+
+	var limited limitedExec
+	err := json.Unmarshal([]byte(encoded), &limited)
+	if err != nil {
+		prints.Warnf("Cannot read the limits of the tool: %v\n", err)
+		os.Exit(127)
+	}
+
+	err = applyLimits(0, limited.Limits)
+	if err != nil {
+		prints.Warnf("Cannot apply limits to %s: %v\n", filepath.Base(limited.Path), err)
+	}
+
+	env := slices.DeleteFunc(os.Environ(), func(variable string) bool {
+		return strings.HasPrefix(variable, limitsEnv+"=")
+	})
+
+	err = syscall.Exec(limited.Path, os.Args, env)
+	prints.Warnf("Cannot run %s: %v\n", limited.Path, err)
+	os.Exit(127)
+}
+
+// Applies `limits` to the process (or thread, for per thread limits) of `pid`, 0 for the calling one. Every limit is
+// attempted, the errors of those that failed are joined.
+func applyLimits(pid int, limits config.Limits) error {
+	var errs []error
+
+	if limits.Nice != nil {
+		err := unix.Setpriority(unix.PRIO_PROCESS, pid, *limits.Nice)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("nice: %w", err))
+		}
+	}
+
+	if !limits.IOPriority.IsZero() {
+		priority := ioprioClasses[limits.IOPriority.Class]<<ioprioClassShift | limits.IOPriority.Level
+
+		_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), uintptr(priority))
+		if errno != 0 {
+			errs = append(errs, fmt.Errorf("io-priority: %w", errno))
+		}
+	}
+
+	if limits.MemoryLimit > 0 {
+		limit := &unix.Rlimit{Cur: uint64(limits.MemoryLimit), Max: uint64(limits.MemoryLimit)}
+
+		err := unix.Prlimit(pid, unix.RLIMIT_AS, limit, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("memory-limit: %w", err))
+		}
+	}
+
+	if len(limits.CPUAffinity) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range limits.CPUAffinity {
+			set.Set(cpu)
+		}
+
+		err := unix.SchedSetaffinity(pid, &set)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cpu-affinity: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
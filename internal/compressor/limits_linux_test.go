@@ -0,0 +1,50 @@
+//go:build linux
+
+package compressor
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+func TestLimitCommand(t *testing.T) {
+	nice := 19
+	limits := config.Limits{
+		Nice:        &nice,
+		IOPriority:  config.IOPriority{Class: config.IOPriorityIdle},
+		MemoryLimit: 1 << 30,
+		CPUAffinity: config.CPUList{0},
+	}
+
+	// The shell reports the limits it started with, children inherit them
+	script := `nice; ionice; ulimit -v; grep Cpus_allowed_list /proc/$$/status; echo "$` + limitsEnv + `"`
+	command := exec.Command("/bin/sh", "-c", script)
+	if err := limitCommand(command, limits); err != nil {
+		t.Fatalf("limitCommand() error = %v", err)
+	}
+
+	if strings.Join(command.Args, " ") != "/bin/sh -c "+script {
+		t.Errorf("command arguments = %v, want them unchanged", command.Args)
+	}
+
+	output, err := command.CombinedOutput()
+	if err != nil {
+		t.Fatalf("limited command failed: %v\n%s", err, output)
+	}
+
+	want := "19\nidle\n1048576\nCpus_allowed_list:\t0\n\n"
+	if string(output) != want {
+		t.Errorf("limited command printed:\n%s\nwant:\n%s", output, want)
+	}
+}
+
+func TestLimitCommandWithoutLimits(t *testing.T) {
+	command := exec.Command("/bin/sh", "-c", "true")
+	path := command.Path
+	if err := limitCommand(command, config.Limits{}); err != nil || command.Path != path || command.Env != nil {
+		t.Errorf("limitCommand() without limits = %v, changed the command to %s %v", err, command.Path, command.Env)
+	}
+}
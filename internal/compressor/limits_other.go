@@ -0,0 +1,26 @@
+//go:build !linux
+
+package compressor
+
+import (
+	"os/exec"
+	"sync"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/prints"
+)
+
+var unsupportedLimitsWarning sync.Once
+
+// Limits are only applied on Linux, warns once that they are ignored.
+func limitCommand(command *exec.Cmd, limits config.Limits) error {
+	if limits.IsZero() {
+		return nil
+	}
+
+	unsupportedLimitsWarning.Do(func() {
+		prints.Warnln("Tool limits (nice, io-priority, memory-limit and cpu-affinity) are only supported on Linux. Ignoring...")
+	})
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package compressor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/maputils"
+	"github.com/ArrayNone/compacty/internal/prints"
+)
+
+// Outcome of enforcing `CompressionProcess.Metadata` on a result
+type MetadataCheck struct {
+	IsChecked bool
+
+	Removed []string // Metadata stripped from the result to follow the policy
+	Missing []string // Metadata of the original that the policy keeps, but the result lacks
+
+	Err error
+}
+
+// PNG chunk or JPEG segment, located at `data[start:end]` of the parsed file
+type metadataItem struct {
+	name       string
+	start, end int
+	isColor    bool
+}
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+var errMetadataUnsupported = errors.New("file format has no supported metadata")
+
+// Chunks that are required to render the image, these are never stripped
+var pngStructuralChunks = []string{"IHDR", "PLTE", "IDAT", "IEND", "tRNS", "acTL", "fcTL", "fdAT"}
+var pngColorChunks = []string{"iCCP", "sRGB", "gAMA", "cHRM", "cICP", "mDCV", "cLLI"}
+
+const (
+	jpegMarkerRST0  = 0xd0
+	jpegMarkerRST7  = 0xd7
+	jpegMarkerStart = 0xd8
+	jpegMarkerEnd   = 0xd9
+	jpegMarkerScan  = 0xda
+	jpegMarkerTEM   = 0x01
+	jpegMarkerApp0  = 0xe0
+	jpegMarkerApp15 = 0xef
+	jpegMarkerCOM   = 0xfe
+)
+
+func (mc MetadataCheck) String() string {
+	switch {
+	case mc.Err != nil:
+		return "ERROR: " + mc.Err.Error()
+	case !mc.IsChecked:
+		return "-"
+	case len(mc.Missing) > 0:
+		return "MISSING: " + strings.Join(mc.Missing, ", ")
+	case len(mc.Removed) > 0:
+		return "REMOVED: " + strings.Join(mc.Removed, ", ")
+	}
+
+	return "OK"
+}
+
+// Strips metadata that `Metadata` does not allow from every successful result, and checks that the metadata it
+// keeps is still there. Results that lack the original's kept metadata are disqualified. Only the first call on
+// each file does anything.
+func (c *CompressionProcess) enforceMetadata(fileIdx int) {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	if fileInfo.isMetadataEnforced {
+		return
+	}
+
+	fileInfo.isMetadataEnforced = true
+
+	originalData, err := os.ReadFile(fileInfo.Path)
+	if err != nil {
+		prints.Warnf("Cannot read %s to check metadata: %v\n", fileInfo.Path, err)
+		return
+	}
+
+	originalItems, err := parseMetadata(originalData)
+	if errors.Is(err, errMetadataUnsupported) {
+		return
+	} else if err != nil {
+		prints.Warnf("Cannot read metadata of %s: %v\n", fileInfo.Path, err)
+		return
+	}
+
+	// Metadata of the original that results must keep
+	keptNames := make(map[string]struct{})
+	for _, item := range originalItems {
+		if isMetadataAllowed(c.Metadata, item) {
+			keptNames[item.name] = struct{}{}
+		}
+	}
+
+	for _, toolName := range maputils.SortedKeys(c.Results) {
+		result := c.Results[toolName][fileIdx]
+		if result == nil || result.HasError() || result.IsCached {
+			continue
+		}
+
+		result.Metadata = MetadataCheck{IsChecked: true}
+
+		tempPath := c.TempFiles[toolName][fileIdx].Path
+		size, err := stripMetadata(tempPath, keptNames, &result.Metadata)
+		if err != nil {
+			result.Metadata.Err = err
+			prints.Warnf("%s is disqualified, cannot check its metadata: %v\n", toolName, err)
+			continue
+		}
+
+		result.FinalSize = size
+
+		if len(result.Metadata.Missing) > 0 {
+			prints.Warnf(
+				"%s is disqualified, its result is missing metadata kept by the policy: %s\n",
+				toolName, strings.Join(result.Metadata.Missing, ", "),
+			)
+		}
+	}
+}
+
+// Returns `true` if `policy` keeps `item`. Returns `false` otherwise.
+func isMetadataAllowed(policy config.MetadataPolicy, item metadataItem) bool {
+	switch policy.Mode {
+	case config.MetadataKeepColor:
+		return item.isColor
+	case config.MetadataKeepAll:
+		return true
+	case config.MetadataWhitelist:
+		return slices.Contains(policy.Whitelist, item.name)
+	}
+
+	return false
+}
+
+// Rewrites the file at `path` without the metadata that is not in `keptNames`. Records what's removed and what's
+// missing in `check`. Returns the new size of the file.
+func stripMetadata(path string, keptNames map[string]struct{}, check *MetadataCheck) (size int64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	items, err := parseMetadata(data)
+	if err != nil {
+		return 0, err
+	}
+
+	presentNames := make(map[string]struct{})
+	stripped := make([]byte, 0, len(data))
+	lastEnd := 0
+
+	for _, item := range items {
+		if _, ok := keptNames[item.name]; ok {
+			presentNames[item.name] = struct{}{}
+			continue
+		}
+
+		stripped = append(stripped, data[lastEnd:item.start]...)
+		lastEnd = item.end
+
+		if !slices.Contains(check.Removed, item.name) {
+			check.Removed = append(check.Removed, item.name)
+		}
+	}
+
+	for _, name := range maputils.SortedKeys(keptNames) {
+		if _, ok := presentNames[name]; !ok {
+			check.Missing = append(check.Missing, name)
+		}
+	}
+
+	if len(check.Removed) == 0 {
+		return int64(len(data)), nil
+	}
+
+	stripped = append(stripped, data[lastEnd:]...)
+	err = os.WriteFile(path, stripped, rw_r__r__)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(stripped)), nil
+}
+
+// Returns the metadata chunks of a PNG, or the metadata segments before the first scan of a JPEG, in file order.
+func parseMetadata(data []byte) (items []metadataItem, err error) {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return parsePNGMetadata(data)
+	case len(data) >= 2 && data[0] == 0xff && data[1] == jpegMarkerStart:
+		return parseJPEGMetadata(data)
+	}
+
+	return nil, errMetadataUnsupported
+}
+
+func parsePNGMetadata(data []byte) (items []metadataItem, err error) {
+	offset := len(pngSignature)
+	for offset < len(data) {
+		if offset+8 > len(data) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+
+		length := int(binary.BigEndian.Uint32(data[offset:]))
+		chunkType := string(data[offset+4 : offset+8])
+		end := offset + 12 + length // Length, type, data and CRC
+
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("truncated PNG chunk %q", chunkType)
+		}
+
+		// Unknown critical chunks (uppercase first letter) can't be skipped by decoders, so they're not metadata
+		isCritical := chunkType[0] >= 'A' && chunkType[0] <= 'Z'
+		if !slices.Contains(pngStructuralChunks, chunkType) && !isCritical {
+			items = append(items, metadataItem{
+				name:    chunkType,
+				start:   offset,
+				end:     end,
+				isColor: slices.Contains(pngColorChunks, chunkType),
+			})
+		}
+
+		offset = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return items, nil
+}
+
+func parseJPEGMetadata(data []byte) (items []metadataItem, err error) {
+	offset := 2
+	for offset < len(data) {
+		if data[offset] != 0xff {
+			return nil, fmt.Errorf("invalid JPEG marker at byte %d", offset)
+		}
+
+		// Markers can be padded with any amount of 0xff
+		markerStart := offset
+		for offset < len(data) && data[offset] == 0xff {
+			offset++
+		}
+
+		if offset+3 > len(data) {
+			return nil, errors.New("truncated JPEG segment")
+		}
+
+		marker := data[offset]
+		if marker == jpegMarkerScan || marker == jpegMarkerEnd {
+			break
+		}
+
+		// Standalone markers have no length
+		if marker == jpegMarkerTEM || (marker >= jpegMarkerRST0 && marker <= jpegMarkerRST7) {
+			offset++
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[offset+1:]))
+		end := offset + 1 + length
+		if length < 2 || end > len(data) {
+			return nil, fmt.Errorf("truncated JPEG segment %X", marker)
+		}
+
+		payload := data[offset+3 : end]
+
+		var name string
+		switch {
+		case marker >= jpegMarkerApp0 && marker <= jpegMarkerApp15:
+			name = fmt.Sprintf("APP%d", marker-jpegMarkerApp0)
+		case marker == jpegMarkerCOM:
+			name = "COM"
+		}
+
+		// The JFIF header is part of the format, not metadata
+		isJFIF := marker == jpegMarkerApp0 && bytes.HasPrefix(payload, []byte("JFIF\x00"))
+		if name != "" && !isJFIF {
+			isICC := marker == jpegMarkerApp0+2 && bytes.HasPrefix(payload, []byte("ICC_PROFILE\x00"))
+			isAdobe := marker == jpegMarkerApp0+14 && bytes.HasPrefix(payload, []byte("Adobe"))
+
+			items = append(items, metadataItem{
+				name:    name,
+				start:   markerStart,
+				end:     end,
+				isColor: isICC || isAdobe,
+			})
+		}
+
+		offset = end
+	}
+
+	return items, nil
+}
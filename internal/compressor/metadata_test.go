@@ -0,0 +1,339 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+func pngChunk(chunkType string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xff, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+// Returns a PNG with tEXt, iCCP and eXIf chunks after its header.
+func pngWithMetadata(t *testing.T) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, texturedImage(16, 16, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	data := encoded.Bytes()
+	headerEnd := len(pngSignature) + 12 + 13 // IHDR always holds 13 bytes
+
+	withMetadata := slices.Clone(data[:headerEnd])
+	withMetadata = append(withMetadata, pngChunk("tEXt", []byte("Comment\x00made by a test"))...)
+	withMetadata = append(withMetadata, pngChunk("iCCP", []byte("profile\x00\x00not really zlib"))...)
+	withMetadata = append(withMetadata, pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08"))...)
+
+	return append(withMetadata, data[headerEnd:]...)
+}
+
+// Returns a JPEG with JFIF, APP1 (Exif), APP2 (ICC profile) and COM segments after its start marker.
+func jpegWithMetadata(t *testing.T) []byte {
+	t.Helper()
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, texturedImage(16, 16, 0), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data := encoded.Bytes()
+
+	withMetadata := slices.Clone(data[:2])
+	withMetadata = append(withMetadata, jpegSegment(jpegMarkerApp0, []byte("JFIF\x00\x01\x02\x00\x00\x01\x00\x01\x00\x00"))...)
+	withMetadata = append(withMetadata, jpegSegment(jpegMarkerApp0+1, []byte("Exif\x00\x00MM\x00\x2a"))...)
+	withMetadata = append(withMetadata, jpegSegment(jpegMarkerApp0+2, []byte("ICC_PROFILE\x00\x01\x01data"))...)
+	withMetadata = append(withMetadata, jpegSegment(jpegMarkerCOM, []byte("made by a test"))...)
+
+	return append(withMetadata, data[2:]...)
+}
+
+func metadataNames(items []metadataItem) (names []string) {
+	for _, item := range items {
+		names = append(names, item.name)
+	}
+
+	return names
+}
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       func(t *testing.T) []byte
+		wantNames  []string
+		wantColors []string
+		wantSizes  []int // Bytes taken by each item in the file
+	}{
+		{
+			name:       "PNG",
+			data:       pngWithMetadata,
+			wantNames:  []string{"tEXt", "iCCP", "eXIf"},
+			wantColors: []string{"iCCP"},
+			wantSizes:  []int{12 + 22, 12 + 24, 12 + 8},
+		},
+		{
+			name:       "JPEG",
+			data:       jpegWithMetadata,
+			wantNames:  []string{"APP1", "APP2", "COM"},
+			wantColors: []string{"APP2"},
+			wantSizes:  []int{4 + 10, 4 + 18, 4 + 14},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			items, err := parseMetadata(test.data(t))
+			if err != nil {
+				t.Fatalf("parseMetadata() error = %v", err)
+			}
+
+			if got := metadataNames(items); !slices.Equal(got, test.wantNames) {
+				t.Fatalf("parseMetadata() names = %v, want %v", got, test.wantNames)
+			}
+
+			var colors []string
+			for i, item := range items {
+				if item.isColor {
+					colors = append(colors, item.name)
+				}
+
+				if item.end-item.start != test.wantSizes[i] {
+					t.Errorf("%s takes %d bytes, want %d", item.name, item.end-item.start, test.wantSizes[i])
+				}
+			}
+
+			if !slices.Equal(colors, test.wantColors) {
+				t.Errorf("parseMetadata() colour items = %v, want %v", colors, test.wantColors)
+			}
+		})
+	}
+}
+
+func TestParseMetadataUnsupported(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("GIF89a"), []byte("plain text")} {
+		if _, err := parseMetadata(data); !errors.Is(err, errMetadataUnsupported) {
+			t.Errorf("parseMetadata(%q) error = %v, want %v", data, err, errMetadataUnsupported)
+		}
+	}
+}
+
+func TestParseMetadataCorrupt(t *testing.T) {
+	pngData := pngWithMetadata(t)
+	jpegData := jpegWithMetadata(t)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "PNG cut in a chunk header", data: pngData[:len(pngSignature)+4]},
+		{name: "PNG cut in a chunk", data: pngData[:len(pngSignature)+20]},
+		{name: "PNG with a huge chunk length", data: append(slices.Clone(pngData[:len(pngSignature)]), 0xff, 0xff, 0xff, 0xf0, 'I', 'H', 'D', 'R')},
+		{name: "JPEG cut in a segment header", data: jpegData[:5]},
+		{name: "JPEG cut in a segment", data: jpegData[:10]},
+		{name: "JPEG with a length below 2", data: []byte{0xff, jpegMarkerStart, 0xff, jpegMarkerCOM, 0x00, 0x01, 0x00}},
+		{name: "JPEG without a marker", data: []byte{0xff, jpegMarkerStart, 0x00, 0x00, 0x00, 0x00}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseMetadata(test.data); err == nil {
+				t.Errorf("parseMetadata() error = nil, want an error")
+			}
+		})
+	}
+
+	// No prefix of a valid file may panic
+	for _, data := range [][]byte{pngData, jpegData} {
+		for end := range len(data) {
+			_, _ = parseMetadata(data[:end])
+		}
+	}
+}
+
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        func(t *testing.T) []byte
+		decode      func(r io.Reader) (image.Image, error)
+		keptNames   []string
+		wantRemoved []string
+		wantMissing []string
+		wantKept    []string
+	}{
+		{
+			name:        "PNG, strip all",
+			data:        pngWithMetadata,
+			decode:      png.Decode,
+			wantRemoved: []string{"tEXt", "iCCP", "eXIf"},
+		},
+		{
+			name:        "PNG, keep colour",
+			data:        pngWithMetadata,
+			decode:      png.Decode,
+			keptNames:   []string{"iCCP"},
+			wantRemoved: []string{"tEXt", "eXIf"},
+			wantKept:    []string{"iCCP"},
+		},
+		{
+			name:        "PNG, keep missing",
+			data:        pngWithMetadata,
+			decode:      png.Decode,
+			keptNames:   []string{"eXIf", "sRGB", "tEXt"},
+			wantRemoved: []string{"iCCP"},
+			wantMissing: []string{"sRGB"},
+			wantKept:    []string{"tEXt", "eXIf"},
+		},
+		{
+			name:        "JPEG, strip all",
+			data:        jpegWithMetadata,
+			decode:      jpeg.Decode,
+			wantRemoved: []string{"APP1", "APP2", "COM"},
+		},
+		{
+			name:        "JPEG, keep colour",
+			data:        jpegWithMetadata,
+			decode:      jpeg.Decode,
+			keptNames:   []string{"APP2"},
+			wantRemoved: []string{"APP1", "COM"},
+			wantKept:    []string{"APP2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data(t)
+			path := filepath.Join(t.TempDir(), "image")
+			if err := os.WriteFile(path, data, rw_r__r__); err != nil {
+				t.Fatal(err)
+			}
+
+			keptNames := make(map[string]struct{})
+			for _, name := range test.keptNames {
+				keptNames[name] = struct{}{}
+			}
+
+			var check MetadataCheck
+			size, err := stripMetadata(path, keptNames, &check)
+			if err != nil {
+				t.Fatalf("stripMetadata() error = %v", err)
+			}
+
+			if !slices.Equal(check.Removed, test.wantRemoved) || !slices.Equal(check.Missing, test.wantMissing) {
+				t.Errorf("stripMetadata() removed %v and missing %v, want %v and %v",
+					check.Removed, check.Missing, test.wantRemoved, test.wantMissing)
+			}
+
+			stripped, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if size != int64(len(stripped)) || len(stripped) >= len(data) {
+				t.Errorf("stripMetadata() size = %d, file holds %d bytes, original %d", size, len(stripped), len(data))
+			}
+
+			items, err := parseMetadata(stripped)
+			if err != nil {
+				t.Fatalf("parseMetadata() of the stripped file error = %v", err)
+			}
+
+			if got := metadataNames(items); !slices.Equal(got, test.wantKept) {
+				t.Errorf("stripped file holds %v, want %v", got, test.wantKept)
+			}
+
+			if _, err := test.decode(bytes.NewReader(stripped)); err != nil {
+				t.Errorf("stripped file cannot be decoded: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripMetadataKeepsUnchangedFiles(t *testing.T) {
+	data := pngWithMetadata(t)
+	path := filepath.Join(t.TempDir(), "image.png")
+	if err := os.WriteFile(path, data, rw_r__r__); err != nil {
+		t.Fatal(err)
+	}
+
+	keptNames := map[string]struct{}{"tEXt": {}, "iCCP": {}, "eXIf": {}}
+
+	var check MetadataCheck
+	size, err := stripMetadata(path, keptNames, &check)
+	if err != nil || size != int64(len(data)) || len(check.Removed) > 0 || len(check.Missing) > 0 {
+		t.Errorf("stripMetadata() = %d, %v, %+v, want the file untouched", size, err, check)
+	}
+}
+
+func TestEnforceMetadataBeforeDecodeTime(t *testing.T) {
+	dir := t.TempDir()
+	data := pngWithMetadata(t)
+
+	originalPath := filepath.Join(dir, "original.png")
+	resultPath := filepath.Join(dir, "result.png")
+	for _, path := range []string{originalPath, resultPath} {
+		if err := os.WriteFile(path, data, rw_r__r__); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := &CompressionResult{OriginalSize: int64(len(data)), FinalSize: int64(len(data))}
+	c := &CompressionProcess{
+		OriginalFileInfo: []*FileInfo{{Path: originalPath, Size: int64(len(data))}},
+		Results:          map[string][]*CompressionResult{"tool": {result}},
+		TempFiles:        map[string][]TempFile{"tool": {{Path: resultPath}}},
+		Metadata:         config.MetadataPolicy{Mode: config.MetadataStripAll},
+	}
+
+	<-c.BenchmarkDecodeTime(context.Background(), DecodeBenchOptions{MinTime: time.Millisecond})
+
+	stripped, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Measured and scored as it is written
+	if result.FinalSize != int64(len(stripped)) || len(stripped) >= len(data) {
+		t.Errorf("FinalSize = %d, stripped result holds %d bytes, original %d", result.FinalSize, len(stripped), len(data))
+	}
+
+	if len(result.Decodes) != 1 || result.Decodes[0].Trials == 0 {
+		t.Errorf("Decodes = %+v, want the result measured", result.Decodes)
+	}
+
+	wantRemoved := []string{"tEXt", "iCCP", "eXIf"}
+	if !slices.Equal(result.Metadata.Removed, wantRemoved) {
+		t.Errorf("Metadata.Removed = %v, want %v", result.Metadata.Removed, wantRemoved)
+	}
+
+	// Enforcing again when saving keeps what the first check found
+	c.enforceMetadata(0)
+	if !slices.Equal(result.Metadata.Removed, wantRemoved) {
+		t.Errorf("Metadata.Removed = %v after enforcing again, want %v", result.Metadata.Removed, wantRemoved)
+	}
+}
@@ -0,0 +1,158 @@
+package compressor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// Attributes of the original file that are copied to written results
+type PreserveFlags int
+
+const (
+	PreserveMode  PreserveFlags = 1 << iota // Permission bits, including setuid, setgid and sticky
+	PreserveOwner                           // Owner and group, only when permitted
+	PreserveTimes                           // Modification and access time
+	PreserveXattr                           // Extended attributes, on Linux, macOS, FreeBSD and NetBSD
+
+	PreserveNone PreserveFlags = 0
+	PreserveAll                = PreserveMode | PreserveOwner | PreserveTimes | PreserveXattr
+)
+
+var preserveFlagNames = []struct {
+	name string
+	flag PreserveFlags
+}{
+	{"mode", PreserveMode},
+	{"owner", PreserveOwner},
+	{"times", PreserveTimes},
+	{"xattr", PreserveXattr},
+}
+
+// Attributes read from a file before it's replaced
+type fileAttributes struct {
+	preserve PreserveFlags
+
+	mode         fs.FileMode
+	uid, gid     int
+	hasOwner     bool
+	atime, mtime time.Time
+	xattrs       map[string][]byte
+}
+
+// Parses a comma separated list of attributes (`mode`, `owner`, `times`, `xattr`), `all` or `none`, as used by
+// `--preserve`.
+func ParsePreserveFlags(value string) (flags PreserveFlags, err error) {
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(strings.ToLower(name))
+
+		switch name {
+		case "all":
+			flags |= PreserveAll
+			continue
+		case "none":
+			continue
+		}
+
+		found := false
+		for _, flagName := range preserveFlagNames {
+			if flagName.name == name {
+				flags |= flagName.flag
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return PreserveNone, fmt.Errorf("unknown attribute %q", name)
+		}
+	}
+
+	return flags, nil
+}
+
+func (pf PreserveFlags) String() string {
+	switch pf {
+	case PreserveNone:
+		return "none"
+	case PreserveAll:
+		return "all"
+	}
+
+	names := make([]string, 0, len(preserveFlagNames))
+	for _, flagName := range preserveFlagNames {
+		if pf&flagName.flag != 0 {
+			names = append(names, flagName.name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// Returns the access time of the file at `path`. Returns the zero time if it cannot be read.
+func FileAccessTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return fileAccessTime(path, info)
+}
+
+// Reads the attributes in `preserve` from the file at `path`. Must be called before the file is replaced.
+func readFileAttributes(path string, preserve PreserveFlags) (attrs *fileAttributes, err error) {
+	attrs = &fileAttributes{preserve: preserve}
+	if preserve == PreserveNone {
+		return attrs, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs.mode = info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	attrs.uid, attrs.gid, attrs.hasOwner = fileOwner(info)
+	attrs.mtime = info.ModTime()
+	attrs.atime = fileAccessTime(path, info)
+
+	if preserve&PreserveXattr != 0 {
+		attrs.xattrs, err = readXattrs(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read extended attributes: %w", err)
+		}
+	}
+
+	return attrs, nil
+}
+
+// Applies the read attributes to the file at `path`. Ownership that is not permitted to be changed is skipped.
+func (attrs *fileAttributes) applyTo(path string) (err error) {
+	var errs []error
+
+	if attrs.preserve&PreserveXattr != 0 {
+		errs = append(errs, writeXattrs(path, attrs.xattrs))
+	}
+
+	// Before the mode, changing the owner may clear setuid and setgid
+	if attrs.preserve&PreserveOwner != 0 && attrs.hasOwner {
+		err := os.Lchown(path, attrs.uid, attrs.gid)
+		if err != nil && !errors.Is(err, fs.ErrPermission) {
+			errs = append(errs, err)
+		}
+	}
+
+	if attrs.preserve&PreserveMode != 0 {
+		errs = append(errs, os.Chmod(path, attrs.mode))
+	}
+
+	// Last, everything else may change the times
+	if attrs.preserve&PreserveTimes != 0 {
+		errs = append(errs, os.Chtimes(path, attrs.atime, attrs.mtime))
+	}
+
+	return errors.Join(errs...)
+}
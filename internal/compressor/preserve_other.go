@@ -0,0 +1,27 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package compressor
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Ownership is not preserved on this platform.
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	return 0, 0, false
+}
+
+// Access times cannot be read on this platform, the modification time is used instead.
+func fileAccessTime(path string, info fs.FileInfo) time.Time {
+	return info.ModTime()
+}
+
+// Extended attributes are not preserved on this platform.
+func readXattrs(path string) (xattrs map[string][]byte, err error) {
+	return nil, nil
+}
+
+func writeXattrs(path string, xattrs map[string][]byte) (err error) {
+	return nil
+}
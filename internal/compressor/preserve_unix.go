@@ -0,0 +1,86 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package compressor
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func fileOwner(info fs.FileInfo) (uid, gid int, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// Returns the access time of the file, or its modification time if it cannot be read.
+func fileAccessTime(path string, info fs.FileInfo) time.Time {
+	var stat unix.Stat_t
+	if err := unix.Stat(path, &stat); err != nil {
+		return info.ModTime()
+	}
+
+	return time.Unix(stat.Atim.Unix())
+}
+
+func readXattrs(path string) (xattrs map[string][]byte, err error) {
+	size, err := unix.Listxattr(path, nil)
+	if isXattrUnsupported(err) {
+		return nil, nil
+	} else if err != nil || size == 0 {
+		return nil, err
+	}
+
+	names := make([]byte, size)
+	size, err = unix.Listxattr(path, names)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs = make(map[string][]byte)
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		valueSize, err := unix.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, valueSize)
+		valueSize, err = unix.Getxattr(path, string(name), value)
+		if err != nil {
+			return nil, err
+		}
+
+		xattrs[string(name)] = value[:valueSize]
+	}
+
+	return xattrs, nil
+}
+
+// Attributes that are not permitted to be set (such as `security.*` for regular users) are skipped.
+func writeXattrs(path string, xattrs map[string][]byte) (err error) {
+	var errs []error
+	for name, value := range xattrs {
+		err := unix.Setxattr(path, name, value, 0)
+		if err != nil && !errors.Is(err, fs.ErrPermission) && !isXattrUnsupported(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isXattrUnsupported(err error) bool {
+	return errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP)
+}
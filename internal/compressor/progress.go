@@ -0,0 +1,40 @@
+package compressor
+
+// Notified of the progress of a `CompressionProcess`, such as to display it live. Called concurrently from the
+// goroutines running the tools.
+type ProgressListener interface {
+	// A tool (or a stage of a chain, named "<chain> (<tool>)") started compressing `filePaths` after being scheduled
+	ToolStarted(toolName string, filePaths []string)
+	// The tool that started on `filePaths` stopped. `err` is nil if it succeeded
+	ToolFinished(toolName string, filePaths []string, err error)
+	// The result of a file is picked and written. `bestSize` is the size of the kept file, the original's if it is kept
+	FileDone(filePath string, originalSize, bestSize int64)
+}
+
+func (cc *compressionCommand) notifyStarted() {
+	if cc.progress != nil {
+		cc.progress.ToolStarted(cc.toolName, cc.filePaths)
+	}
+}
+
+func (cc *compressionCommand) notifyFinished() {
+	if cc.progress != nil {
+		cc.progress.ToolFinished(cc.toolName, cc.filePaths, cc.commandError)
+	}
+}
+
+// Notifies that the file at `fileIdx` is done, keeping the result of `bestTool` (or the original if empty).
+func (c *CompressionProcess) notifyFileDone(fileIdx int, bestTool string) {
+	if c.Progress == nil {
+		return
+	}
+
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	bestSize := fileInfo.Size
+	if bestTool != "" && !c.isBelowMinSaving(fileIdx, bestTool) {
+		bestSize = c.Results[bestTool][fileIdx].FinalSize
+	}
+
+	c.Progress.FileDone(fileInfo.Path, fileInfo.Size, bestSize)
+}
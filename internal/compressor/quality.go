@@ -0,0 +1,326 @@
+package compressor
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+
+	"github.com/ArrayNone/compacty/internal/prints"
+)
+
+// Perceptual quality of a result compared to its original, measured with MS-SSIM on luma. 1 means no visible
+// difference, lower scores mean more degradation.
+type QualityScore struct {
+	Score      float64
+	IsComputed bool
+
+	IsBelowMinimum bool // Disqualified by `CompressionProcess.MinQuality`
+
+	Err error
+}
+
+// Plane of luma values in [0, 1]
+type lumaPlane struct {
+	width, height int
+	pix           []float64
+}
+
+const (
+	ssimWindowSize = 11
+	ssimSigma      = 1.5
+
+	ssimC1 = 0.01 * 0.01 // (K1 * L)^2 with L = 1
+	ssimC2 = 0.03 * 0.03 // (K2 * L)^2 with L = 1
+)
+
+// Weights of each scale from the original MS-SSIM paper, finest scale first
+var msssimWeights = []float64{0.0448, 0.2856, 0.3001, 0.2363, 0.1333}
+
+var ssimKernel = gaussianKernel(ssimWindowSize, ssimSigma)
+
+func (qs QualityScore) String() string {
+	if qs.Err != nil {
+		return "ERROR: " + qs.Err.Error()
+	} else if !qs.IsComputed {
+		return "-"
+	}
+
+	return strconv.FormatFloat(qs.Score, 'f', 6, 64)
+}
+
+func (c *CompressionProcess) scoreQuality(
+	toolName string,
+	result *CompressionResult,
+	original, candidate *decodedImage,
+	decodeErr error,
+) {
+
+	result.Quality = QualityScore{}
+
+	err := decodeErr
+	if err == nil {
+		result.Quality.Score, err = decodedImageQuality(original, candidate)
+	}
+
+	if err != nil {
+		result.Quality.Err = err
+		prints.Warnf("Cannot score the quality of %s: %v\n", toolName, err)
+	} else {
+		result.Quality.IsComputed = true
+	}
+
+	// Results that cannot be scored cannot be trusted to meet the minimum
+	if c.MinQuality > 0 && (err != nil || result.Quality.Score < c.MinQuality) {
+		result.Quality.IsBelowMinimum = true
+		if err == nil {
+			prints.Warnf(
+				"%s is disqualified, its quality %s is below the minimum of %s\n",
+				toolName, result.Quality.String(), strconv.FormatFloat(c.MinQuality, 'f', -1, 64),
+			)
+		}
+	}
+}
+
+// Returns the lowest quality across every frame.
+func decodedImageQuality(original, candidate *decodedImage) (score float64, err error) {
+	if len(original.frames) != len(candidate.frames) {
+		return 0, fmt.Errorf("frame count differs: %d, got %d", len(original.frames), len(candidate.frames))
+	}
+
+	score = 1
+	for i := range original.frames {
+		frameScore, err := imageQuality(original.frames[i], candidate.frames[i])
+		if err != nil {
+			return 0, err
+		}
+
+		score = min(score, frameScore)
+	}
+
+	return score, nil
+}
+
+// Scores `candidate` against `original` with MS-SSIM. Images with transparency are scored over a black and a white
+// background, and the lower score is used.
+func imageQuality(original, candidate image.Image) (score float64, err error) {
+	originalBounds := original.Bounds()
+	candidateBounds := candidate.Bounds()
+
+	if originalBounds.Dx() != candidateBounds.Dx() || originalBounds.Dy() != candidateBounds.Dy() {
+		return 0, fmt.Errorf(
+			"dimensions differ: %dx%d, got %dx%d",
+			originalBounds.Dx(), originalBounds.Dy(), candidateBounds.Dx(), candidateBounds.Dy(),
+		)
+	}
+
+	if originalBounds.Empty() {
+		return 0, errors.New("image is empty")
+	}
+
+	originalOverBlack, originalOverWhite, originalHasAlpha := toLumaPlanes(original)
+	candidateOverBlack, candidateOverWhite, candidateHasAlpha := toLumaPlanes(candidate)
+
+	score = msssim(originalOverBlack, candidateOverBlack)
+	if originalHasAlpha || candidateHasAlpha {
+		score = min(score, msssim(originalOverWhite, candidateOverWhite))
+	}
+
+	return score, nil
+}
+
+// Returns the luma (BT.601) of the image composited over black and over white, and whether any pixel is translucent.
+func toLumaPlanes(img image.Image) (overBlack, overWhite lumaPlane, hasAlpha bool) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	overBlack = lumaPlane{width: width, height: height, pix: make([]float64, width*height)}
+	overWhite = lumaPlane{width: width, height: height, pix: make([]float64, width*height)}
+
+	const maxValue = 0xffff
+	for y := range height {
+		for x := range width {
+			// Premultiplied, which is the same as being composited over black
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			luma := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / maxValue
+
+			overBlack.pix[y*width+x] = luma
+			overWhite.pix[y*width+x] = luma + float64(maxValue-a)/maxValue
+
+			if a != maxValue {
+				hasAlpha = true
+			}
+		}
+	}
+
+	return overBlack, overWhite, hasAlpha
+}
+
+// Multi-scale SSIM. Scales that are smaller than the window are skipped, with the weights of the remaining scales
+// normalised.
+func msssim(original, candidate lumaPlane) float64 {
+	scales := len(msssimWeights)
+	for scales > 1 && min(original.width, original.height)>>(scales-1) < ssimWindowSize {
+		scales--
+	}
+
+	var weightSum float64
+	for _, weight := range msssimWeights[:scales] {
+		weightSum += weight
+	}
+
+	score := 1.0
+	for scale := range scales {
+		weight := msssimWeights[scale] / weightSum
+
+		luminance, contrastStructure := ssimComponents(original, candidate)
+		if scale == scales-1 {
+			score *= math.Pow(max(luminance*contrastStructure, 0), weight)
+			break
+		}
+
+		score *= math.Pow(max(contrastStructure, 0), weight)
+
+		original = downsample(original)
+		candidate = downsample(candidate)
+	}
+
+	return score
+}
+
+// Returns the mean luminance term and the mean contrast-structure term of SSIM, using a Gaussian window. Planes
+// smaller than the window are compared as a single window.
+func ssimComponents(original, candidate lumaPlane) (luminance, contrastStructure float64) {
+	if original.width < ssimWindowSize || original.height < ssimWindowSize {
+		return ssimWindow(globalStatistics(original, candidate))
+	}
+
+	products := func(f func(a, b float64) float64) lumaPlane {
+		result := lumaPlane{width: original.width, height: original.height, pix: make([]float64, len(original.pix))}
+		for i := range original.pix {
+			result.pix[i] = f(original.pix[i], candidate.pix[i])
+		}
+
+		return result
+	}
+
+	meanOriginal := blurValid(original)
+	meanCandidate := blurValid(candidate)
+	meanOriginalSq := blurValid(products(func(a, _ float64) float64 { return a * a }))
+	meanCandidateSq := blurValid(products(func(_, b float64) float64 { return b * b }))
+	meanProduct := blurValid(products(func(a, b float64) float64 { return a * b }))
+
+	for i := range meanOriginal.pix {
+		muA, muB := meanOriginal.pix[i], meanCandidate.pix[i]
+
+		l, cs := ssimWindow(
+			muA, muB,
+			meanOriginalSq.pix[i]-muA*muA,
+			meanCandidateSq.pix[i]-muB*muB,
+			meanProduct.pix[i]-muA*muB,
+		)
+
+		luminance += l
+		contrastStructure += cs
+	}
+
+	count := float64(len(meanOriginal.pix))
+	return luminance / count, contrastStructure / count
+}
+
+func ssimWindow(muA, muB, varianceA, varianceB, covariance float64) (luminance, contrastStructure float64) {
+	luminance = (2*muA*muB + ssimC1) / (muA*muA + muB*muB + ssimC1)
+	contrastStructure = (2*covariance + ssimC2) / (varianceA + varianceB + ssimC2)
+
+	return luminance, contrastStructure
+}
+
+func globalStatistics(a, b lumaPlane) (muA, muB, varianceA, varianceB, covariance float64) {
+	count := float64(len(a.pix))
+	for i := range a.pix {
+		muA += a.pix[i]
+		muB += b.pix[i]
+	}
+
+	muA /= count
+	muB /= count
+
+	for i := range a.pix {
+		deltaA, deltaB := a.pix[i]-muA, b.pix[i]-muB
+
+		varianceA += deltaA * deltaA
+		varianceB += deltaB * deltaB
+		covariance += deltaA * deltaB
+	}
+
+	return muA, muB, varianceA / count, varianceB / count, covariance / count
+}
+
+// Applies the Gaussian window on every position where it fits entirely, separably.
+func blurValid(plane lumaPlane) lumaPlane {
+	outWidth := plane.width - ssimWindowSize + 1
+	outHeight := plane.height - ssimWindowSize + 1
+
+	horizontal := make([]float64, outWidth*plane.height)
+	for y := range plane.height {
+		row := plane.pix[y*plane.width:]
+		for x := range outWidth {
+			var sum float64
+			for k, weight := range ssimKernel {
+				sum += row[x+k] * weight
+			}
+
+			horizontal[y*outWidth+x] = sum
+		}
+	}
+
+	result := lumaPlane{width: outWidth, height: outHeight, pix: make([]float64, outWidth*outHeight)}
+	for y := range outHeight {
+		for x := range outWidth {
+			var sum float64
+			for k, weight := range ssimKernel {
+				sum += horizontal[(y+k)*outWidth+x] * weight
+			}
+
+			result.pix[y*outWidth+x] = sum
+		}
+	}
+
+	return result
+}
+
+// Halves the plane's dimensions by averaging 2x2 blocks.
+func downsample(plane lumaPlane) lumaPlane {
+	result := lumaPlane{width: plane.width / 2, height: plane.height / 2}
+	result.pix = make([]float64, result.width*result.height)
+
+	for y := range result.height {
+		for x := range result.width {
+			top := plane.pix[2*y*plane.width+2*x:]
+			bottom := plane.pix[(2*y+1)*plane.width+2*x:]
+
+			result.pix[y*result.width+x] = (top[0] + top[1] + bottom[0] + bottom[1]) / 4
+		}
+	}
+
+	return result
+}
+
+func gaussianKernel(size int, sigma float64) (kernel []float64) {
+	kernel = make([]float64, size)
+	center := float64(size-1) / 2
+
+	var sum float64
+	for i := range kernel {
+		distance := float64(i) - center
+		kernel[i] = math.Exp(-(distance * distance) / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	return kernel
+}
@@ -0,0 +1,299 @@
+package compressor
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Returns an opaque grey image with some texture, offset by `noise` on every other pixel.
+func texturedImage(width, height int, noise int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			value := (x*7 + y*13) % 200
+			if (x+y)%2 == 0 {
+				value += noise
+			}
+
+			grey := uint8(min(max(value, 0), 255))
+			img.SetNRGBA(x, y, color.NRGBA{R: grey, G: grey, B: grey, A: 255})
+		}
+	}
+
+	return img
+}
+
+func filledImage(width, height int, fill color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.SetNRGBA(x, y, fill)
+		}
+	}
+
+	return img
+}
+
+func TestImageQuality(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  image.Image
+		candidate image.Image
+		wantMin   float64 // Inclusive
+		wantMax   float64 // Inclusive
+		wantErr   string
+	}{
+		{
+			name:      "identical",
+			original:  texturedImage(64, 64, 0),
+			candidate: texturedImage(64, 64, 0),
+			wantMin:   1,
+			wantMax:   1,
+		},
+		{
+			name:      "slightly degraded",
+			original:  texturedImage(64, 64, 0),
+			candidate: texturedImage(64, 64, 4),
+			wantMin:   0.9,
+			wantMax:   0.9999,
+		},
+		{
+			name:      "heavily degraded",
+			original:  texturedImage(64, 64, 0),
+			candidate: texturedImage(64, 64, 60),
+			wantMin:   0,
+			wantMax:   0.97,
+		},
+		{
+			name:      "smaller than the window, identical",
+			original:  texturedImage(8, 6, 0),
+			candidate: texturedImage(8, 6, 0),
+			wantMin:   1,
+			wantMax:   1,
+		},
+		{
+			name:      "smaller than the window, degraded",
+			original:  texturedImage(8, 6, 0),
+			candidate: texturedImage(8, 6, 40),
+			wantMin:   0,
+			wantMax:   0.9999,
+		},
+		{
+			name:      "transparent pixels that differ only over white",
+			original:  filledImage(32, 32, color.NRGBA{A: 0}),
+			candidate: filledImage(32, 32, color.NRGBA{A: 255}),
+			wantMin:   0,
+			wantMax:   0.9,
+		},
+		{
+			name:      "fully transparent pixels of any colour",
+			original:  filledImage(32, 32, color.NRGBA{R: 255, A: 0}),
+			candidate: filledImage(32, 32, color.NRGBA{B: 255, A: 0}),
+			wantMin:   1,
+			wantMax:   1,
+		},
+		{
+			name:      "dimensions differ",
+			original:  texturedImage(64, 64, 0),
+			candidate: texturedImage(64, 32, 0),
+			wantErr:   "dimensions differ",
+		},
+		{
+			name:      "empty",
+			original:  image.NewNRGBA(image.Rect(0, 0, 0, 0)),
+			candidate: image.NewNRGBA(image.Rect(0, 0, 0, 0)),
+			wantErr:   "empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score, err := imageQuality(test.original, test.candidate)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("imageQuality() error = %v, want %q", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("imageQuality() error = %v", err)
+			}
+
+			const tolerance = 1e-9
+			if score < test.wantMin-tolerance || score > test.wantMax+tolerance {
+				t.Errorf("imageQuality() = %v, want from %v to %v", score, test.wantMin, test.wantMax)
+			}
+		})
+	}
+}
+
+func TestImageQualityIsMonotonic(t *testing.T) {
+	original := texturedImage(64, 64, 0)
+
+	previous := 1.0
+	for _, noise := range []int{2, 8, 20, 50} {
+		score, err := imageQuality(original, texturedImage(64, 64, noise))
+		if err != nil {
+			t.Fatalf("imageQuality() error = %v", err)
+		}
+
+		if score >= previous {
+			t.Errorf("imageQuality() with noise %d = %v, want below %v", noise, score, previous)
+		}
+
+		previous = score
+	}
+}
+
+func TestDecodedImageQuality(t *testing.T) {
+	frame := texturedImage(32, 32, 0)
+	degraded := texturedImage(32, 32, 30)
+
+	tests := []struct {
+		name      string
+		original  []image.Image
+		candidate []image.Image
+		wantErr   string
+		wantBelow float64 // Score must be below this if set
+	}{
+		{name: "frame count differs", original: []image.Image{frame, frame}, candidate: []image.Image{frame}, wantErr: "frame count differs"},
+		{name: "dimensions of a frame differ", original: []image.Image{frame}, candidate: []image.Image{texturedImage(16, 32, 0)}, wantErr: "dimensions differ"},
+		{name: "lowest frame is used", original: []image.Image{frame, frame}, candidate: []image.Image{frame, degraded}, wantBelow: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			score, err := decodedImageQuality(&decodedImage{frames: test.original}, &decodedImage{frames: test.candidate})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("decodedImageQuality() error = %v, want %q", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || score >= test.wantBelow {
+				t.Errorf("decodedImageQuality() = %v, %v, want below %v", score, err, test.wantBelow)
+			}
+		})
+	}
+}
+
+func TestBlurValid(t *testing.T) {
+	plane := lumaPlane{width: 20, height: 15, pix: make([]float64, 20*15)}
+	for i := range plane.pix {
+		plane.pix[i] = 0.25
+	}
+
+	blurred := blurValid(plane)
+	if blurred.width != 20-ssimWindowSize+1 || blurred.height != 15-ssimWindowSize+1 {
+		t.Fatalf("blurValid() size = %dx%d, want %dx%d", blurred.width, blurred.height, 20-ssimWindowSize+1, 15-ssimWindowSize+1)
+	}
+
+	// The kernel is normalised, so a constant plane stays constant
+	for i, value := range blurred.pix {
+		if math.Abs(value-0.25) > 1e-12 {
+			t.Fatalf("blurValid().pix[%d] = %v, want 0.25", i, value)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	tests := []struct {
+		name  string
+		plane lumaPlane
+		want  lumaPlane
+	}{
+		{
+			name: "even",
+			plane: lumaPlane{width: 4, height: 2, pix: []float64{
+				0, 1, 2, 3,
+				1, 2, 3, 4,
+			}},
+			want: lumaPlane{width: 2, height: 1, pix: []float64{1, 3}},
+		},
+		{
+			name: "odd edges are dropped",
+			plane: lumaPlane{width: 3, height: 3, pix: []float64{
+				4, 0, 9,
+				0, 0, 9,
+				9, 9, 9,
+			}},
+			want: lumaPlane{width: 1, height: 1, pix: []float64{1}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := downsample(test.plane)
+			if got.width != test.want.width || got.height != test.want.height || !slicesEqual(got.pix, test.want.pix) {
+				t.Errorf("downsample() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func slicesEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-12 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestInspectResultsUndecodableOriginal(t *testing.T) {
+	tests := []struct {
+		name             string
+		minQuality       float64
+		wantDisqualified bool
+	}{
+		{name: "minimum cannot be met", minQuality: 0.97, wantDisqualified: true},
+		{name: "no minimum", minQuality: 0, wantDisqualified: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			originalPath := filepath.Join(dir, "notes.txt")
+			resultPath := filepath.Join(dir, "notes-tool.txt")
+
+			for _, path := range []string{originalPath, resultPath} {
+				if err := os.WriteFile(path, []byte("plain text, not an image"), rw_r__r__); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result := &CompressionResult{FinalSize: 10}
+			c := &CompressionProcess{
+				OriginalFileInfo: []*FileInfo{{Path: originalPath, Size: 24}},
+				Results:          map[string][]*CompressionResult{"tool": {result}},
+				TempFiles:        map[string][]TempFile{"tool": {{Path: resultPath}}},
+				ComputeQuality:   true,
+				MinQuality:       test.minQuality,
+			}
+
+			c.inspectResults(0)
+
+			if result.IsDisqualified() != test.wantDisqualified {
+				t.Errorf("IsDisqualified() = %v, want %v", result.IsDisqualified(), test.wantDisqualified)
+			}
+
+			if result.Quality.IsComputed {
+				t.Errorf("Quality.IsComputed = true, want false for an undecodable original")
+			}
+		})
+	}
+}
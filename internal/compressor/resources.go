@@ -0,0 +1,77 @@
+package compressor
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// CPU time and memory used by a finished tool process. Tools that compress multiple files at once share the usage of
+// the whole batch.
+type ResourceUsage struct {
+	UserTime   time.Duration
+	SystemTime time.Duration
+	PeakMemory int64 // Peak resident set size in bytes. 0 if unavailable on this platform
+
+	IsMeasured bool
+}
+
+// Returns the usage of the finished process of `state`. Returns an unmeasured usage if `state` is nil.
+func processResourceUsage(state *os.ProcessState) (usage ResourceUsage) {
+	if state == nil {
+		return ResourceUsage{}
+	}
+
+	return ResourceUsage{
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+		PeakMemory: peakMemory(state),
+
+		IsMeasured: true,
+	}
+}
+
+// Adds the CPU time of `other`, and keeps the highest peak memory. Used for chains, where tools run one at a time.
+func (ru ResourceUsage) Add(other ResourceUsage) ResourceUsage {
+	return ResourceUsage{
+		UserTime:   ru.UserTime + other.UserTime,
+		SystemTime: ru.SystemTime + other.SystemTime,
+		PeakMemory: max(ru.PeakMemory, other.PeakMemory),
+
+		IsMeasured: ru.IsMeasured || other.IsMeasured,
+	}
+}
+
+// Returns the user and system CPU time in seconds, separated by a slash.
+func (ru ResourceUsage) CPUTimeString() string {
+	if !ru.IsMeasured {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.3f/%.3f", ru.UserTime.Seconds(), ru.SystemTime.Seconds())
+}
+
+// Returns the peak memory in megabytes.
+func (ru ResourceUsage) PeakMemoryString() string {
+	if !ru.IsMeasured || ru.PeakMemory == 0 {
+		return "-"
+	}
+
+	const bytePerMegabyte = 1000000
+	return strconv.FormatFloat(float64(ru.PeakMemory)/bytePerMegabyte, 'f', 1, 64)
+}
+
+// Returns the usage as printed once a tool finishes, or an empty string if it's not measured.
+func (ru ResourceUsage) summaryString() string {
+	if !ru.IsMeasured {
+		return ""
+	}
+
+	summary := fmt.Sprintf("(CPU %s user, %s sys", ru.UserTime.Round(time.Millisecond), ru.SystemTime.Round(time.Millisecond))
+	if ru.PeakMemory > 0 {
+		summary += ", peak memory " + ru.PeakMemoryString() + " MB"
+	}
+
+	return summary + ")"
+}
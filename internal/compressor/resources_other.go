@@ -0,0 +1,12 @@
+//go:build !unix
+
+package compressor
+
+import (
+	"os"
+)
+
+// Peak memory of finished processes is unavailable on this platform.
+func peakMemory(state *os.ProcessState) int64 {
+	return 0
+}
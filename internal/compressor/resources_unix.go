@@ -0,0 +1,24 @@
+//go:build unix
+
+package compressor
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// Returns the peak resident set size of the finished process in bytes.
+func peakMemory(state *os.ProcessState) int64 {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return 0
+	}
+
+	// Bytes on macOS, kilobytes elsewhere
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		return int64(rusage.Maxrss)
+	}
+
+	return int64(rusage.Maxrss) * 1024
+}
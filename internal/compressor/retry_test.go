@@ -0,0 +1,294 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+// Environment of the helper tool, see `TestHelperTool()`
+const (
+	helperToolEnv   = "COMPACTY_HELPER_TOOL"   // Set to run as the helper tool
+	helperCountEnv  = "COMPACTY_HELPER_COUNT"  // File counting the attempts, one byte each
+	helperFailsEnv  = "COMPACTY_HELPER_FAILS"  // Amount of attempts that fail before one succeeds
+	helperCodeEnv   = "COMPACTY_HELPER_CODE"   // Exit code of failed attempts
+	helperStderrEnv = "COMPACTY_HELPER_STDERR" // Printed to stderr by failed attempts
+	helperSleepEnv  = "COMPACTY_HELPER_SLEEP"  // Duration each attempt takes
+)
+
+// Not a test, acts as a tool run by `TestRetries()` when the test binary is run with `helperToolEnv` set.
+func TestHelperTool(t *testing.T) {
+	if os.Getenv(helperToolEnv) == "" {
+		t.Skip("only run as a tool by other tests")
+	}
+
+	countPath := os.Getenv(helperCountEnv)
+	count, err := os.ReadFile(countPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		os.Exit(100)
+	}
+
+	if err := os.WriteFile(countPath, append(count, '.'), rw_r__r__); err != nil {
+		os.Exit(100)
+	}
+
+	if sleep, err := time.ParseDuration(os.Getenv(helperSleepEnv)); err == nil {
+		time.Sleep(sleep)
+	}
+
+	fails, _ := strconv.Atoi(os.Getenv(helperFailsEnv))
+	if len(count) >= fails {
+		os.Exit(0)
+	}
+
+	code, _ := strconv.Atoi(os.Getenv(helperCodeEnv))
+	fmt.Fprintln(os.Stderr, os.Getenv(helperStderrEnv))
+	os.Exit(code)
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		tool  config.CompressionTool
+		fails int
+		code  int
+
+		stderr      string
+		sleep       time.Duration
+		timeLimit   time.Duration
+		memoryLimit config.ByteSize // Never reached, only marks the tool as limited
+		cancel      time.Duration   // Interrupts the run after this long if set
+
+		wantAttempts int
+		wantErr      error // Checked with `errors.Is()` if set
+		wantFailed   bool
+	}{
+		{
+			name:         "succeeds at once",
+			tool:         config.CompressionTool{Retries: 3},
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after retrying",
+			tool:         config.CompressionTool{Retries: 3},
+			fails:        2,
+			code:         1,
+			wantAttempts: 3,
+		},
+		{
+			name:         "no retries",
+			fails:        1,
+			code:         1,
+			wantAttempts: 1,
+			wantFailed:   true,
+		},
+		{
+			name:         "retries run out",
+			tool:         config.CompressionTool{Retries: 2},
+			fails:        5,
+			code:         1,
+			wantAttempts: 3,
+			wantFailed:   true,
+		},
+		{
+			name:         "exit code to retry",
+			tool:         config.CompressionTool{Retries: 2, RetryExitCodes: []int{75}},
+			fails:        1,
+			code:         75,
+			wantAttempts: 2,
+		},
+		{
+			name:         "other exit code",
+			tool:         config.CompressionTool{Retries: 2, RetryExitCodes: []int{75}},
+			fails:        1,
+			code:         1,
+			wantAttempts: 1,
+			wantFailed:   true,
+		},
+		{
+			name:         "matching stderr",
+			tool:         config.CompressionTool{Retries: 2, RetryPatterns: []string{`resource (busy|locked)`}},
+			fails:        1,
+			code:         1,
+			stderr:       "error: resource locked, try again",
+			wantAttempts: 2,
+		},
+		{
+			name:         "other stderr",
+			tool:         config.CompressionTool{Retries: 2, RetryPatterns: []string{`resource (busy|locked)`}},
+			fails:        1,
+			code:         1,
+			stderr:       "error: invalid image",
+			wantAttempts: 1,
+			wantFailed:   true,
+		},
+		{
+			name:         "crashes under a memory limit",
+			tool:         config.CompressionTool{Retries: 2},
+			memoryLimit:  1 << 40,
+			fails:        1,
+			code:         1,
+			stderr:       "Segmentation fault",
+			wantAttempts: 2,
+		},
+		{
+			name:         "out of memory",
+			tool:         config.CompressionTool{Retries: 2},
+			memoryLimit:  1 << 40,
+			fails:        1,
+			code:         1,
+			stderr:       "error: out of memory",
+			wantAttempts: 1,
+			wantErr:      ErrMemoryLimit,
+		},
+		{
+			name:         "timeouts are not retried",
+			tool:         config.CompressionTool{Retries: 2},
+			fails:        5,
+			sleep:        5 * time.Second,
+			timeLimit:    100 * time.Millisecond,
+			wantAttempts: 1,
+			wantErr:      ErrTimedOut,
+		},
+		{
+			name:         "interrupted while waiting to retry",
+			tool:         config.CompressionTool{Retries: 2, RetryBackoff: time.Hour},
+			fails:        5,
+			code:         1,
+			cancel:       500 * time.Millisecond,
+			wantAttempts: 1,
+			wantErr:      ErrInterrupted,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			countPath := filepath.Join(t.TempDir(), "count")
+			t.Setenv(helperToolEnv, "1")
+			t.Setenv(helperCountEnv, countPath)
+			t.Setenv(helperFailsEnv, strconv.Itoa(test.fails))
+			t.Setenv(helperCodeEnv, strconv.Itoa(test.code))
+			t.Setenv(helperStderrEnv, test.stderr)
+			t.Setenv(helperSleepEnv, test.sleep.String())
+
+			tool := test.tool
+			tool.Command = os.Args[0]
+			tool.Platform = []string{runtime.GOOS}
+			tool.OutputMode = config.InputOutput
+			if tool.RetryBackoff == 0 {
+				tool.RetryBackoff = time.Millisecond
+			}
+
+			tool.CompileRetryPatterns()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if test.cancel > 0 {
+				timer := time.AfterFunc(test.cancel, cancel)
+				defer timer.Stop()
+			}
+
+			cc := newCompressionCommand("helper", ExecutedTool{
+				CompressionTool: &tool,
+				Arguments:       []string{"-test.run=^TestHelperTool$"},
+				TimeLimit:       test.timeLimit,
+				Limits:          config.Limits{MemoryLimit: test.memoryLimit},
+			}, "")
+
+			cc.inputPaths = []string{"input.png", "output.png"}
+			cc.output = io.Discard
+			cc.prepareCommand(ctx)
+			if !cc.isAvailable {
+				t.Fatalf("test binary %s cannot be run as a tool", os.Args[0])
+			}
+
+			cc.executeAndReport()
+
+			if cc.attempts != test.wantAttempts {
+				t.Errorf("attempts = %d, want %d", cc.attempts, test.wantAttempts)
+			}
+
+			count, _ := os.ReadFile(countPath)
+			if len(count) != test.wantAttempts {
+				t.Errorf("tool ran %d times, want %d", len(count), test.wantAttempts)
+			}
+
+			switch {
+			case test.wantErr != nil && !errors.Is(cc.commandError, test.wantErr):
+				t.Errorf("commandError = %v, want %v", cc.commandError, test.wantErr)
+			case test.wantErr == nil && (cc.commandError != nil) != test.wantFailed:
+				t.Errorf("commandError = %v, want failed = %v", cc.commandError, test.wantFailed)
+			}
+		})
+	}
+}
+
+func TestRetryBackoffReleasesSlot(t *testing.T) {
+	countPath := filepath.Join(t.TempDir(), "count")
+	t.Setenv(helperToolEnv, "1")
+	t.Setenv(helperCountEnv, countPath)
+	t.Setenv(helperFailsEnv, "1")
+	t.Setenv(helperCodeEnv, "1")
+
+	tool := config.CompressionTool{
+		Command:      os.Args[0],
+		Platform:     []string{runtime.GOOS},
+		OutputMode:   config.InputOutput,
+		Retries:      1,
+		RetryBackoff: time.Second,
+	}
+
+	scheduler := NewScheduler(1)
+	cc := newCompressionCommand("helper", ExecutedTool{
+		CompressionTool: &tool,
+		Arguments:       []string{"-test.run=^TestHelperTool$"},
+	}, "")
+
+	cc.inputPaths = []string{"input.png", "output.png"}
+	cc.output = io.Discard
+	cc.scheduler = scheduler
+	cc.prepareCommand(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		cc.executeAndReport()
+		close(done)
+	}()
+
+	// The slot is free while the tool waits to retry
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	for {
+		if count, _ := os.ReadFile(countPath); len(count) > 0 {
+			break
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := scheduler.Acquire(ctx, 0); err != nil {
+		t.Fatalf("Acquire() while the tool waits to retry error = %v, want the slot released", err)
+	}
+
+	scheduler.Release()
+	<-done
+
+	if cc.attempts != 2 || cc.commandError != nil {
+		t.Errorf("attempts = %d, commandError = %v, want 2 and nil", cc.attempts, cc.commandError)
+	}
+
+	if got := runningCount(scheduler); got != 0 {
+		t.Errorf("running = %d after the tool finished, want 0", got)
+	}
+}
@@ -0,0 +1,139 @@
+package compressor
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+)
+
+// Limits the amount of tool processes running at once across every tool and file. Processes with higher priority
+// (larger inputs) are started first, processes with the same priority are started in the order they're queued.
+type Scheduler struct {
+	limit   int
+	running int
+
+	waiting schedulerQueue
+	queued  uint64
+
+	mutex sync.Mutex
+}
+
+type schedulerWaiter struct {
+	priority int64
+	order    uint64
+	index    int
+
+	ready     chan struct{}
+	isGranted bool
+}
+
+type schedulerQueue []*schedulerWaiter
+
+// Creates a scheduler that allows up to `jobs` processes to run at once. If `jobs` is 0 or less, the limit is the
+// amount of logical CPUs.
+func NewScheduler(jobs int) *Scheduler {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	return &Scheduler{limit: jobs}
+}
+
+// Returns the amount of processes allowed to run at once.
+func (s *Scheduler) Limit() int {
+	return s.limit
+}
+
+// Blocks until a process is allowed to start or `ctx` is done. Higher `priority` starts first. Every successful
+// call must be followed by `Release()` once the process exits. Returns the context's error if `ctx` is done first.
+func (s *Scheduler) Acquire(ctx context.Context, priority int64) (err error) {
+	s.mutex.Lock()
+	if s.running < s.limit && len(s.waiting) == 0 {
+		s.running++
+		s.mutex.Unlock()
+		return nil
+	}
+
+	waiter := &schedulerWaiter{
+		priority: priority,
+		order:    s.queued,
+		ready:    make(chan struct{}),
+	}
+
+	s.queued++
+	heap.Push(&s.waiting, waiter)
+	s.mutex.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		if waiter.isGranted {
+			// Granted while being cancelled, hand the slot over
+			s.releaseLocked()
+		} else {
+			heap.Remove(&s.waiting, waiter.index)
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Frees a slot taken by `Acquire()` and starts the next waiting process, if any.
+func (s *Scheduler) Release() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.releaseLocked()
+}
+
+func (s *Scheduler) releaseLocked() {
+	if len(s.waiting) == 0 {
+		s.running--
+		return
+	}
+
+	// The slot is passed to the next waiter, the running count stays the same
+	waiter := heap.Pop(&s.waiting).(*schedulerWaiter)
+	waiter.isGranted = true
+	close(waiter.ready)
+}
+
+func (q schedulerQueue) Len() int {
+	return len(q)
+}
+
+func (q schedulerQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+
+	return q[i].order < q[j].order
+}
+
+func (q schedulerQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *schedulerQueue) Push(item any) {
+	waiter := item.(*schedulerWaiter)
+	waiter.index = len(*q)
+	*q = append(*q, waiter)
+}
+
+func (q *schedulerQueue) Pop() any {
+	old := *q
+	last := len(old) - 1
+
+	waiter := old[last]
+	old[last] = nil
+	*q = old[:last]
+
+	return waiter
+}
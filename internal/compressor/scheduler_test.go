@@ -0,0 +1,212 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Blocks until `count` processes are waiting in `s`.
+func waitForQueue(t *testing.T, s *Scheduler, count int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mutex.Lock()
+		waiting := len(s.waiting)
+		s.mutex.Unlock()
+
+		if waiting == count {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%d processes are waiting, want %d", waiting, count)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func runningCount(s *Scheduler) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.running
+}
+
+func TestNewScheduler(t *testing.T) {
+	tests := []struct {
+		jobs int
+		want int
+	}{
+		{jobs: 3, want: 3},
+		{jobs: 0, want: runtime.NumCPU()},
+		{jobs: -1, want: runtime.NumCPU()},
+	}
+
+	for _, test := range tests {
+		if got := NewScheduler(test.jobs).Limit(); got != test.want {
+			t.Errorf("NewScheduler(%d).Limit() = %d, want %d", test.jobs, got, test.want)
+		}
+	}
+}
+
+func TestSchedulerLimit(t *testing.T) {
+	s := NewScheduler(2)
+	ctx := context.Background()
+
+	for range 2 {
+		if err := s.Acquire(ctx, 0); err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		_ = s.Acquire(ctx, 0)
+		close(acquired)
+	}()
+
+	waitForQueue(t, s, 1)
+
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() returned while the limit is reached")
+	default:
+	}
+
+	s.Release()
+	<-acquired
+
+	if got := runningCount(s); got != 2 {
+		t.Errorf("running = %d after handing a slot over, want 2", got)
+	}
+
+	s.Release()
+	s.Release()
+	if got := runningCount(s); got != 0 {
+		t.Errorf("running = %d after releasing every slot, want 0", got)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	s := NewScheduler(1)
+	ctx := context.Background()
+
+	if err := s.Acquire(ctx, 0); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// Queued one by one, so that the order of equal priorities is known
+	waiters := []struct {
+		name     string
+		priority int64
+	}{
+		{"small", 10},
+		{"large", 500},
+		{"medium", 100},
+		{"large, queued later", 500},
+		{"empty", 0},
+	}
+
+	var mutex sync.Mutex
+	var started []string
+	var wg sync.WaitGroup
+
+	for i, waiter := range waiters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := s.Acquire(ctx, waiter.priority); err != nil {
+				t.Errorf("Acquire() error = %v", err)
+				return
+			}
+
+			mutex.Lock()
+			started = append(started, waiter.name)
+			mutex.Unlock()
+
+			s.Release()
+		}()
+
+		waitForQueue(t, s, i+1)
+	}
+
+	s.Release()
+	wg.Wait()
+
+	want := []string{"large", "large, queued later", "medium", "small", "empty"}
+	if !slices.Equal(started, want) {
+		t.Errorf("started = %v, want %v", started, want)
+	}
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	s := NewScheduler(1)
+	if err := s.Acquire(context.Background(), 0); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- s.Acquire(ctx, 100)
+	}()
+
+	waitForQueue(t, s, 1)
+	cancel()
+
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire() error = %v, want %v", err, context.Canceled)
+	}
+
+	// The cancelled process leaves the queue without taking a slot
+	waitForQueue(t, s, 0)
+	if got := runningCount(s); got != 1 {
+		t.Errorf("running = %d after cancelling, want 1", got)
+	}
+
+	s.Release()
+	if got := runningCount(s); got != 0 {
+		t.Errorf("running = %d after releasing, want 0", got)
+	}
+
+	if err := s.Acquire(context.Background(), 0); err != nil {
+		t.Errorf("Acquire() after cancelling error = %v", err)
+	}
+}
+
+func TestSchedulerCancelWhileGranted(t *testing.T) {
+	// Granting and cancelling at once may go either way, but the slot must never be lost
+	for range 200 {
+		s := NewScheduler(1)
+		if err := s.Acquire(context.Background(), 0); err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		result := make(chan error)
+		go func() {
+			result <- s.Acquire(ctx, 0)
+		}()
+
+		waitForQueue(t, s, 1)
+
+		go cancel()
+		s.Release()
+
+		if err := <-result; err == nil {
+			s.Release()
+		}
+
+		if got := runningCount(s); got != 0 {
+			t.Fatalf("running = %d once everything is released, want 0", got)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package compressor
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/expression"
+)
+
+// Score given to a result (or the original) by the selection strategy, the lowest score wins
+type SelectionScore struct {
+	Score    float64
+	IsScored bool // Not set for results that failed, are disqualified or lack a variable used by the strategy
+}
+
+func (ss SelectionScore) String() string {
+	if !ss.IsScored {
+		return "-"
+	}
+
+	return strconv.FormatFloat(ss.Score, 'f', 6, 64)
+}
+
+// Returns the selection to pick the result of the file at `fileIdx` with. Falls back to size, returning the missing
+// variable, if `Selection` uses a variable that is unavailable for this file.
+func (c *CompressionProcess) fileSelection(fileIdx int) (selection config.Selection, unavailable string) {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	_, isDecodeAvailable := c.primaryDecoder(fileIdx)
+	if !c.AreDecodeTimeComputed || !isDecodeAvailable {
+		for _, variable := range []string{"decode", "decode_ms"} {
+			if c.Selection.Uses(variable) {
+				return config.Selection{Strategy: config.SelectBySize}, variable
+			}
+		}
+	}
+
+	isQualityAvailable := c.ComputeQuality && canDecodeImage(fileInfo.Path)
+	if !isQualityAvailable {
+		for _, variable := range []string{"quality", "quality_loss"} {
+			if c.Selection.Uses(variable) {
+				return config.Selection{Strategy: config.SelectBySize}, variable
+			}
+		}
+	}
+
+	return c.Selection, ""
+}
+
+// Scores the original and `results` of the file at `fileIdx` with `selection`, and returns the tool with the lowest
+// score. Returns an empty string if no result beats the original. Ties are won by the original, then by the tool
+// that comes first in `ToolPriority`, then alphabetically. With `SelectByDecodeTime`, decode times that are not
+// significantly different from the fastest one are ties, settled by size, see `settleDecodeTimeNoise()`.
+func (c *CompressionProcess) scoreResults(
+	fileIdx int,
+	selection config.Selection,
+	results map[string]*CompressionResult,
+) (bestTool string) {
+
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	var parsedExpression *expression.Expression
+	if selection.Strategy == config.SelectByExpression {
+		parsedExpression = selection.ParsedExpression()
+	}
+
+	score := func(variables map[string]float64) float64 {
+		switch selection.Strategy {
+		case config.SelectByDecodeTime:
+			return variables["decode"]
+		case config.SelectByWeightedScore:
+			sum := 0.0
+			for variable, weight := range selection.Weights {
+				sum += variables[variable] * weight
+			}
+
+			return sum
+		case config.SelectByExpression:
+			return parsedExpression.Evaluate(variables)
+		}
+
+		return variables["size"]
+	}
+
+	fileInfo.Score = SelectionScore{Score: score(c.originalVariables(fileIdx)), IsScored: true}
+	bestScore := fileInfo.Score.Score
+
+	for _, toolName := range c.sortByToolPriority(results) {
+		result := results[toolName]
+		result.Score = SelectionScore{}
+
+		if result.HasError() || result.IsDisqualified() {
+			continue
+		}
+
+		variables, ok := c.resultVariables(fileIdx, selection, result)
+		if !ok {
+			continue
+		}
+
+		result.Score = SelectionScore{Score: score(variables), IsScored: true}
+		if result.Score.Score < bestScore {
+			bestScore = result.Score.Score
+			bestTool = toolName
+		}
+	}
+
+	if selection.Strategy == config.SelectByDecodeTime {
+		bestTool = c.settleDecodeTimeNoise(fileIdx, results, bestTool)
+	}
+
+	return bestTool
+}
+
+// Returns the smallest of the original and the scored `results` whose decode time is not significantly different
+// from the one of `fastestTool` (the original if empty), so that noise does not pick a larger file. Ties are won by
+// the original, then by `ToolPriority`. Returns `fastestTool` if it is significantly faster than everything else.
+func (c *CompressionProcess) settleDecodeTimeNoise(
+	fileIdx int,
+	results map[string]*CompressionResult,
+	fastestTool string,
+) (bestTool string) {
+
+	decoderIdx, ok := c.primaryDecoder(fileIdx)
+	if !ok {
+		return fastestTool
+	}
+
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	decodeOf := func(toolName string) DecodeTimeBench {
+		if toolName == "" {
+			return DecodeAt(fileInfo.Decodes, decoderIdx)
+		}
+
+		return DecodeAt(results[toolName].Decodes, decoderIdx)
+	}
+
+	sizeOf := func(toolName string) int64 {
+		if toolName == "" {
+			return fileInfo.Size
+		}
+
+		return results[toolName].FinalSize
+	}
+
+	fastest := decodeOf(fastestTool)
+	isWinnerSet := false
+
+	// The original comes first, so that it wins ties
+	for _, toolName := range append([]string{""}, c.sortByToolPriority(results)...) {
+		if toolName != "" && !results[toolName].Score.IsScored {
+			continue
+		}
+
+		isTied := toolName == fastestTool || !fastest.IsSignificantlyDifferent(decodeOf(toolName))
+		if !isTied {
+			continue
+		}
+
+		if !isWinnerSet || sizeOf(toolName) < sizeOf(bestTool) {
+			bestTool = toolName
+			isWinnerSet = true
+		}
+	}
+
+	return bestTool
+}
+
+func (c *CompressionProcess) originalVariables(fileIdx int) map[string]float64 {
+	fileInfo := c.OriginalFileInfo[fileIdx]
+	decoderIdx, _ := c.primaryDecoder(fileIdx)
+
+	return map[string]float64{
+		"size":         1,
+		"bytes":        float64(fileInfo.Size),
+		"decode":       1,
+		"decode_ms":    durationMilliseconds(DecodeAt(fileInfo.Decodes, decoderIdx).Average),
+		"time":         0,
+		"quality":      1,
+		"quality_loss": 0,
+	}
+}
+
+// Returns `false` if the result lacks a variable used by `selection`.
+func (c *CompressionProcess) resultVariables(
+	fileIdx int,
+	selection config.Selection,
+	result *CompressionResult,
+) (variables map[string]float64, ok bool) {
+
+	fileInfo := c.OriginalFileInfo[fileIdx]
+
+	variables = map[string]float64{
+		"size":  float64(result.FinalSize) / float64(fileInfo.Size),
+		"bytes": float64(result.FinalSize),
+		"time":  result.TimeTaken.Seconds(),
+	}
+
+	if selection.Uses("decode") || selection.Uses("decode_ms") {
+		// Measured by the same decoder as the original, see `primaryDecoder()`
+		decoderIdx, _ := c.primaryDecoder(fileIdx)
+
+		decode := DecodeAt(result.Decodes, decoderIdx)
+		if decode.Err != nil || decode.Trials == 0 {
+			return nil, false
+		}
+
+		variables["decode"] = float64(decode.Average) / float64(DecodeAt(fileInfo.Decodes, decoderIdx).Average)
+		variables["decode_ms"] = durationMilliseconds(decode.Average)
+	}
+
+	if selection.Uses("quality") || selection.Uses("quality_loss") {
+		if !result.Quality.IsComputed {
+			return nil, false
+		}
+
+		variables["quality"] = result.Quality.Score
+		variables["quality_loss"] = 1 - result.Quality.Score
+	}
+
+	return variables, true
+}
+
+// Returns the tool names of `results`, ordered by `ToolPriority` first and alphabetically after.
+func (c *CompressionProcess) sortByToolPriority(results map[string]*CompressionResult) (toolNames []string) {
+	rank := func(toolName string) int {
+		if i := slices.Index(c.ToolPriority, toolName); i >= 0 {
+			return i
+		}
+
+		return len(c.ToolPriority)
+	}
+
+	toolNames = make([]string, 0, len(results))
+	for toolName := range results {
+		toolNames = append(toolNames, toolName)
+	}
+
+	slices.SortFunc(toolNames, func(a, b string) int {
+		return cmp.Or(cmp.Compare(rank(a), rank(b)), cmp.Compare(a, b))
+	})
+
+	return toolNames
+}
+
+// Results of every tool for the file at `fileIdx`.
+func (c *CompressionProcess) fileResults(fileIdx int) map[string]*CompressionResult {
+	results := make(map[string]*CompressionResult, len(c.Results))
+	for toolName, toolResults := range c.Results {
+		results[toolName] = toolResults[fileIdx]
+	}
+
+	return results
+}
+
+func durationMilliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / nanoPerMilli
+}
@@ -0,0 +1,214 @@
+package compressor
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/config"
+)
+
+var errTest = errors.New("test error")
+
+func decodeBench(average, stdDev time.Duration, trials int) []DecodeTimeBench {
+	return []DecodeTimeBench{{
+		Decoder: config.BuiltinDecoder,
+		Average: average,
+		StdDev:  stdDev,
+		Trials:  trials,
+	}}
+}
+
+// Returns a process holding a single file of `originalSize` with the decode times of `originalDecodes`.
+func newSelectionProcess(originalSize int64, originalDecodes []DecodeTimeBench, results map[string]*CompressionResult) *CompressionProcess {
+	c := &CompressionProcess{
+		OriginalFileInfo:      []*FileInfo{{Path: "image.png", Size: originalSize, Decodes: originalDecodes}},
+		Results:               make(map[string][]*CompressionResult, len(results)),
+		AreDecodeTimeComputed: originalDecodes != nil,
+	}
+
+	for toolName, result := range results {
+		result.OriginalSize = originalSize
+		c.Results[toolName] = []*CompressionResult{result}
+	}
+
+	return c
+}
+
+func TestScoreResultsDecodeTimeSignificance(t *testing.T) {
+	const ms = time.Millisecond
+	selection := config.Selection{Strategy: config.SelectByDecodeTime}
+
+	tests := []struct {
+		name            string
+		originalDecodes []DecodeTimeBench
+		results         map[string]*CompressionResult
+		toolPriority    []string
+		want            string
+	}{
+		{
+			name:            "significantly fastest wins despite its size",
+			originalDecodes: decodeBench(10*ms, ms/10, 50),
+			results: map[string]*CompressionResult{
+				"fast":  {FinalSize: 900, Decodes: decodeBench(5*ms, ms/10, 50)},
+				"small": {FinalSize: 500, Decodes: decodeBench(8*ms, ms/10, 50)},
+			},
+			want: "fast",
+		},
+		{
+			name:            "noise between the fastest and the next falls back to size",
+			originalDecodes: decodeBench(10*ms, ms/10, 50),
+			results: map[string]*CompressionResult{
+				"fast":  {FinalSize: 900, Decodes: decodeBench(5*ms, 2*ms, 10)},
+				"small": {FinalSize: 500, Decodes: decodeBench(5*ms+ms/10, 2*ms, 10)},
+			},
+			want: "small",
+		},
+		{
+			name:            "noise against the original keeps the smaller original",
+			originalDecodes: decodeBench(5*ms+ms/10, 2*ms, 10),
+			results: map[string]*CompressionResult{
+				"fast": {FinalSize: 1200, Decodes: decodeBench(5*ms, 2*ms, 10)},
+			},
+			want: "",
+		},
+		{
+			name:            "significantly slower results are not tied",
+			originalDecodes: decodeBench(20*ms, ms/10, 50),
+			results: map[string]*CompressionResult{
+				"fast":   {FinalSize: 900, Decodes: decodeBench(5*ms, ms, 10)},
+				"noisy":  {FinalSize: 800, Decodes: decodeBench(5*ms+ms/10, ms, 10)},
+				"slower": {FinalSize: 100, Decodes: decodeBench(15*ms, ms/10, 50)},
+			},
+			want: "noisy",
+		},
+		{
+			name:            "tied sizes are won by tool priority",
+			originalDecodes: decodeBench(10*ms, ms/10, 50),
+			results: map[string]*CompressionResult{
+				"a": {FinalSize: 500, Decodes: decodeBench(5*ms, 2*ms, 10)},
+				"b": {FinalSize: 500, Decodes: decodeBench(5*ms+ms/10, 2*ms, 10)},
+			},
+			toolPriority: []string{"b", "a"},
+			want:         "b",
+		},
+		{
+			name:            "single trials can't be told apart",
+			originalDecodes: decodeBench(10*ms, 0, 1),
+			results: map[string]*CompressionResult{
+				"fast":  {FinalSize: 900, Decodes: decodeBench(2*ms, 0, 1)},
+				"small": {FinalSize: 500, Decodes: decodeBench(9*ms, 0, 1)},
+			},
+			want: "small",
+		},
+		{
+			name:            "failed results are ignored",
+			originalDecodes: decodeBench(10*ms, ms/10, 50),
+			results: map[string]*CompressionResult{
+				"fast":   {FinalSize: 900, Decodes: decodeBench(5*ms, ms/10, 50)},
+				"failed": {FinalSize: 100, CommandError: errTest},
+			},
+			want: "fast",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newSelectionProcess(1000, test.originalDecodes, test.results)
+			c.ToolPriority = test.toolPriority
+
+			got := c.scoreResults(0, selection, c.fileResults(0))
+			if got != test.want {
+				t.Errorf("scoreResults() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScoreResultsTieBreaks(t *testing.T) {
+	tests := []struct {
+		name         string
+		selection    config.Selection
+		sizes        map[string]int64
+		toolPriority []string
+		want         string
+	}{
+		{
+			name:  "smallest wins",
+			sizes: map[string]int64{"a": 700, "b": 600, "c": 800},
+			want:  "b",
+		},
+		{
+			name:  "alphabetical without priority",
+			sizes: map[string]int64{"c": 600, "a": 600, "b": 600},
+			want:  "a",
+		},
+		{
+			name:         "priority before alphabetical",
+			sizes:        map[string]int64{"a": 600, "b": 600, "c": 600},
+			toolPriority: []string{"c", "b"},
+			want:         "c",
+		},
+		{
+			name:         "prioritised tools before the rest",
+			sizes:        map[string]int64{"a": 600, "b": 600, "z": 600},
+			toolPriority: []string{"z"},
+			want:         "z",
+		},
+		{
+			name:         "priority does not beat a smaller result",
+			sizes:        map[string]int64{"a": 599, "b": 600},
+			toolPriority: []string{"b"},
+			want:         "a",
+		},
+		{
+			name:  "original wins ties",
+			sizes: map[string]int64{"a": 1000, "b": 1000},
+			want:  "",
+		},
+		{
+			name:         "expression ties follow the same order",
+			selection:    config.Selection{Strategy: config.SelectByExpression, Expression: "max(size, 0.5)"},
+			sizes:        map[string]int64{"a": 300, "b": 400, "c": 200},
+			toolPriority: []string{"b"},
+			want:         "b",
+		},
+		{
+			name:      "weighted scores",
+			selection: config.Selection{Strategy: config.SelectByWeightedScore, Weights: map[string]float64{"bytes": 1}},
+			sizes:     map[string]int64{"a": 300, "b": 200},
+			want:      "b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results := make(map[string]*CompressionResult, len(test.sizes))
+			for toolName, size := range test.sizes {
+				results[toolName] = &CompressionResult{FinalSize: size}
+			}
+
+			// Map iteration is random, repeat to catch orders that depend on it
+			for range 20 {
+				c := newSelectionProcess(1000, nil, results)
+				c.ToolPriority = test.toolPriority
+
+				got := c.scoreResults(0, test.selection, c.fileResults(0))
+				if got != test.want {
+					t.Fatalf("scoreResults() = %q, want %q", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSortByToolPriority(t *testing.T) {
+	c := &CompressionProcess{ToolPriority: []string{"zopfli", "missing", "oxipng"}}
+	results := map[string]*CompressionResult{"pngquant": {}, "oxipng": {}, "zopfli": {}, "advpng": {}}
+
+	want := []string{"zopfli", "oxipng", "advpng", "pngquant"}
+	if got := c.sortByToolPriority(results); !slices.Equal(got, want) {
+		t.Errorf("sortByToolPriority() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !unix
+
+package compressor
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Process groups are unavailable on this platform, only the process itself is stopped.
+func setProcessGroup(command *exec.Cmd) {}
+
+// Processes can't be asked to terminate on this platform, kill immediately instead.
+func terminateProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
+
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
+
+// Children can't be tracked on this platform, the process is gone once waited for.
+func isProcessGroupRunning(process *os.Process) bool {
+	return false
+}
+
+// Returns `true` if a process with `pid` exists. Returns `false` otherwise.
+func isProcessRunning(pid int) bool {
+	// Fails if the process does not exist on Windows, always succeeds elsewhere
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	_ = process.Release()
+	return true
+}
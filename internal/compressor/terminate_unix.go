@@ -0,0 +1,37 @@
+//go:build unix
+
+package compressor
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Starts the process of `command` in its own process group, so that it can be stopped along with its children.
+func setProcessGroup(command *exec.Cmd) {
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Asks the process group led by `process` to terminate, allowing it to clean up before exiting.
+func terminateProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGTERM)
+}
+
+// Kills the process group led by `process`, including children that outlived it.
+func killProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// Returns `true` if a process of the group led by `process` is still running. Returns `false` otherwise.
+func isProcessGroupRunning(process *os.Process) bool {
+	err := syscall.Kill(-process.Pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Returns `true` if a process with `pid` exists. Returns `false` otherwise.
+func isProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
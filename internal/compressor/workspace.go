@@ -0,0 +1,139 @@
+package compressor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Directory holding every temp file of a run. Each input file gets its own subdirectory, so that inputs with the same
+// name never collide, and concurrent runs never share a workspace.
+type Workspace struct {
+	Dir string
+
+	nextFileDir atomic.Int64
+	removeOnce  sync.Once
+}
+
+const (
+	workspacePrefix = "compacty-"
+
+	// Written first into every workspace as `<workspaceMagic> <pid>`. Directories without it are never swept, as
+	// they may belong to the user (eg. a `compacty-fork` checkout inside `--temp-dir`)
+	workspaceMarkerFile = ".compacty-workspace"
+	workspaceMagic      = "compacty-workspace-v1"
+)
+
+// Creates a workspace inside `parent`, or inside `os.TempDir()` if `parent` is empty.
+func NewWorkspace(parent string) (w *Workspace, err error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+
+	err = os.MkdirAll(parent, rwxr_xr_x)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(parent, workspacePrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	// Marks the workspace as ours and in use, see `SweepStaleWorkspaces()`
+	marker := workspaceMagic + " " + strconv.Itoa(os.Getpid()) + "\n"
+	err = os.WriteFile(filepath.Join(dir, workspaceMarkerFile), []byte(marker), rw_r__r__)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &Workspace{Dir: dir}, nil
+}
+
+// Creates a new subdirectory for the temp files of a single input file.
+func (w *Workspace) newFileDir() (dir string, err error) {
+	dir = filepath.Join(w.Dir, strconv.FormatInt(w.nextFileDir.Add(1), 10))
+	return dir, os.Mkdir(dir, rwxr_xr_x)
+}
+
+// Removes the workspace and everything inside it. Safe to call more than once and concurrently.
+func (w *Workspace) Remove() (err error) {
+	w.removeOnce.Do(func() {
+		err = os.RemoveAll(w.Dir)
+	})
+
+	return err
+}
+
+// Removes workspaces inside `parent` (or `os.TempDir()` if empty) that were left behind by runs that are no longer
+// running. Only directories with a well-formed marker written by `NewWorkspace()` are removed. Returns the amount of
+// removed workspaces.
+func SweepStaleWorkspaces(parent string) (removed int, err error) {
+	if parent == "" {
+		parent = os.TempDir()
+	}
+
+	dirEntries, err := os.ReadDir(parent)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var errs []error
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || !strings.HasPrefix(dirEntry.Name(), workspacePrefix) {
+			continue
+		}
+
+		dir := filepath.Join(parent, dirEntry.Name())
+		if !isWorkspaceStale(dir) {
+			continue
+		}
+
+		err := os.RemoveAll(dir)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", dir, err))
+			continue
+		}
+
+		removed++
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+// Returns `true` if `dir` is a workspace whose run is no longer running. Returns `false` otherwise, or if `dir` cannot
+// be proven to be a workspace.
+func isWorkspaceStale(dir string) bool {
+	markerPath := filepath.Join(dir, workspaceMarkerFile)
+
+	info, err := os.Lstat(markerPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > int64(len(workspaceMagic)+32) {
+		return false // Not ours
+	}
+
+	data, err := os.ReadFile(markerPath)
+	if err != nil {
+		return false
+	}
+
+	magic, pidString, ok := strings.Cut(strings.TrimSuffix(string(data), "\n"), " ")
+	if !ok || magic != workspaceMagic {
+		return false
+	}
+
+	pid, err := strconv.Atoi(pidString)
+	if err != nil || pid <= 0 {
+		return false
+	}
+
+	return pid != os.Getpid() && !isProcessRunning(pid)
+}
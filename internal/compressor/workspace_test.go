@@ -0,0 +1,152 @@
+package compressor
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Returns the pid of a process that ran and exited.
+func exitedPid(t *testing.T) int {
+	t.Helper()
+
+	// Runs no tests, the test binary exits right away
+	command := exec.Command(os.Args[0], "-test.run=^$")
+	if err := command.Run(); err != nil {
+		t.Skipf("cannot run a process to get an unused pid: %v", err)
+	}
+
+	return command.Process.Pid
+}
+
+func TestSweepStaleWorkspaces(t *testing.T) {
+	deadPid := exitedPid(t)
+	if isProcessRunning(deadPid) {
+		t.Skip("cannot tell exited processes apart on this platform")
+	}
+
+	old := time.Now().Add(-time.Hour * 24 * 30)
+
+	tests := []struct {
+		name        string
+		marker      *string // Contents of the marker file, nil if it is missing
+		extraFile   string  // Created inside the directory along with the marker
+		wantRemoved bool
+	}{
+		{
+			name:        "workspace of exited run",
+			marker:      ptr(workspaceMagic + " " + strconv.Itoa(deadPid) + "\n"),
+			extraFile:   "1/image.png",
+			wantRemoved: true,
+		},
+		{
+			name:        "workspace of this run",
+			marker:      ptr(workspaceMagic + " " + strconv.Itoa(os.Getpid()) + "\n"),
+			wantRemoved: false,
+		},
+		{
+			name:        "no marker",
+			extraFile:   "go.mod",
+			wantRemoved: false,
+		},
+		{
+			name:        "marker with another magic",
+			marker:      ptr("something-else " + strconv.Itoa(deadPid) + "\n"),
+			wantRemoved: false,
+		},
+		{
+			name:        "marker without pid",
+			marker:      ptr(workspaceMagic + "\n"),
+			wantRemoved: false,
+		},
+		{
+			name:        "marker with malformed pid",
+			marker:      ptr(workspaceMagic + " abc\n"),
+			wantRemoved: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, workspacePrefix+"test")
+			if err := os.Mkdir(dir, rwxr_xr_x); err != nil {
+				t.Fatal(err)
+			}
+
+			if test.marker != nil {
+				err := os.WriteFile(filepath.Join(dir, workspaceMarkerFile), []byte(*test.marker), rw_r__r__)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if test.extraFile != "" {
+				path := filepath.Join(dir, test.extraFile)
+				if err := os.MkdirAll(filepath.Dir(path), rwxr_xr_x); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := os.WriteFile(path, []byte("data"), rw_r__r__); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// Old enough to have counted as stale before markers were required
+			if err := os.Chtimes(dir, old, old); err != nil {
+				t.Fatal(err)
+			}
+
+			removed, err := SweepStaleWorkspaces(parent)
+			if err != nil {
+				t.Fatalf("SweepStaleWorkspaces() error = %v", err)
+			}
+
+			_, statErr := os.Stat(dir)
+			isRemoved := os.IsNotExist(statErr)
+			if isRemoved != test.wantRemoved {
+				t.Errorf("directory removed = %v, want %v", isRemoved, test.wantRemoved)
+			}
+
+			wantCount := 0
+			if test.wantRemoved {
+				wantCount = 1
+			}
+
+			if removed != wantCount {
+				t.Errorf("SweepStaleWorkspaces() removed = %d, want %d", removed, wantCount)
+			}
+		})
+	}
+}
+
+func TestNewWorkspaceIsNotSwept(t *testing.T) {
+	parent := t.TempDir()
+
+	workspace, err := NewWorkspace(parent)
+	if err != nil {
+		t.Fatalf("NewWorkspace() error = %v", err)
+	}
+	defer workspace.Remove()
+
+	removed, err := SweepStaleWorkspaces(parent)
+	if err != nil || removed != 0 {
+		t.Fatalf("SweepStaleWorkspaces() = %d, %v, want 0, nil", removed, err)
+	}
+
+	if _, err := os.Stat(workspace.Dir); err != nil {
+		t.Errorf("workspace of the running process was removed: %v", err)
+	}
+
+	markerData, err := os.ReadFile(filepath.Join(workspace.Dir, workspaceMarkerFile))
+	if err != nil || string(markerData) != workspaceMagic+" "+strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("marker = %q, %v, want the magic followed by the pid", markerData, err)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
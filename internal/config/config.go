@@ -7,9 +7,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/ArrayNone/compacty/internal/prints"
 
@@ -19,6 +21,15 @@ import (
 
 /* YAML Schema:
 default-preset: <preset name> # Default preset to run when --preset is not provided
+jobs: <int> # Maximum amount of tool processes running at once across all tools and files. 0 = amount of logical CPUs
+temp-dir: <path> # Directory to create temp files in (eg. a tmpfs). Undefined = the system's temp directory
+tool-priority: [<tool or chain names>] # Breaks ties between results with the same score, first listed wins. Unlisted tools come after, alphabetically
+
+limits: # Resource limits applied to every tool process. Only applied on Linux, ignored with a warning elsewhere
+  nice: <int> # Niceness, from -20 (highest priority) to 19 (lowest). Undefined = inherited from compacty
+  io-priority: <class>[:<level>] # IO scheduling class (idle, best-effort or realtime) and level, from 0 (highest) to 7 (lowest). Undefined = inherited
+  memory-limit: <bytes> # Address space limit (eg. `512MiB`, `2GB`). Tools exceeding it are reported as such. 0 or undefined = no limit
+  cpu-affinity: <CPUs> # CPUs tools may run on, as indexes and ranges (eg. `0-3,6`). Undefined = any
 
 mime-extensions:
   <MIME type> = [<extensions>] # Valid extensions for files with this mime type
@@ -32,8 +43,34 @@ presets: # Define presets, preset arguments for tools with a collection of defau
     description: <description> # Preset description, what it does and what it's intended for
     shorthands: [<name>] # Alternative names for the preset
     is-hidden: <bool> # If `true`, this preset is hidden when using --list, --list-args and --list-args-raw
+    lossless: <bool> # If `true`, results are decoded and compared with the original. Results with different pixels are disqualified
+    min-quality: <float> # Results with perceptual quality (MS-SSIM, 0 to 1) below this are disqualified. 0 or undefined = no minimum
+    # Quality is only scored for PNG, JPEG and GIF, results of other formats are disqualified if there is a minimum
+    metadata: <policy> # Metadata PNG and JPEG results must keep, enforced after compression. Undefined = not enforced
+    # Policies: strip-all, keep-color (ICC profiles, PNG colour chunks and Adobe APP14), keep-all (all of the original's)
+    # or a whitelist of PNG chunk types and JPEG segments to keep (eg. [iCCP, eXIf, APP1, APP2])
+    # Metadata not allowed is stripped from results, results missing the original's allowed metadata are disqualified
+    selection: <strategy> # How the winning result is picked, lowest score wins. Undefined = size
+    # Strategies: size, decode-time, or a mapping with `strategy: weighted` and `weights: {<variable>: <weight>}`,
+    # or `strategy: expression` and `expression: <expression>` (eg. `size * (1 - 0.005 * (decode <= 0.33))`)
+    # Variables: size, bytes, decode, decode_ms, time, quality, quality_loss. See `--help` for their meaning
+    min-saving: <saving> # The original is kept unless the best result saves at least this much. Bytes (eg. `4KiB`), percentage (eg. `0.5%`) or both (eg. `4KiB,0.5%`)
     default-tools:
-      <MIME type>: [<tool names>] # Default tools to use for files with a certain MIME type
+      <MIME type>: [<tool or chain names>] # Default tools (and chains) to use for files with a certain MIME type
+    timeouts:
+      <tool name>: <duration> # Overrides the tool's timeout while running this preset (eg. `30s`, `10m`, `1h`)
+
+chains: # Define tool chains, where each tool compresses the output of the previous one
+  <chain name>:
+    description: <description> # Chain description, what it does and what it's intended for
+    tools: [<tool name>[@<preset name>]] # Tools to run in order. `@<preset name>` runs the tool with the arguments of that preset
+
+decoders: # Define decoders to benchmark decode time with (--decode-time), alongside Go's built-in decoders (named "go")
+  <decoder name>:
+    description: <description> # Decoder description, typically what it is and a link to the homepage
+    command: <name> # Decoder/binary to be executed, once per measurement
+    arguments: [<arguments>] # Arguments to run the decoder with, the path of the decoded file is appended to them
+    supported-formats: [<MIME type>] # File formats the decoder supports (in MIME format, eg. `image/webp`)
 
 tools: # Define compression tools
   <tool name>:
@@ -43,40 +80,94 @@ tools: # Define compression tools
     supported-formats: [<MIME type>] # File formats the tool supports (in MIME format, eg. `image/png`, `text/plain`)
     overwrites: <bool> # If `true` the tool overwrites files that its given (some tools create a copy of the file instead)
     can-batch-compress: <bool> # If `true`, the tool supports compressing multiple files at once
+    timeout: <duration> # Stops the tool if it runs longer than this (eg. `30s`, `10m`, `1h`). 0 or undefined = no timeout
+    timeout-grace: <duration> # On timeout or interrupt, asks the tool and its children to terminate and kills them if they're still running after this. 0 or undefined = kill immediately
+    limits: # Overrides the global limits for this tool, same fields as `limits` above
+    retries: <int> # Runs the tool again up to this many times if it fails. Timeouts and exceeded memory limits are not retried. 0 or undefined = no retries
+    retry-backoff: <duration> # Delay before the first retry, doubled after every retry. 0 or undefined = 1s
+    retry-exit-codes: [<int>] # Only retry failures with these exit codes (or matching retry-patterns). Undefined with retry-patterns = retry every failure
+    retry-patterns: [<regex>] # Only retry failures whose stderr matches any of these (or exiting with retry-exit-codes)
     arguments:
       <preset name> = <string> # Arguments when running the tool with a specific preset, separated by spaces
 
 */
 
 type CompressionTool struct {
-	Command          string     `yaml:"command"`
-	SupportedFormats []string   `yaml:"supported-formats"`
-	Platform         []string   `yaml:"platform"`
-	OutputMode       OutputMode `yaml:"output-mode"`
+	Command          string        `yaml:"command"`
+	SupportedFormats []string      `yaml:"supported-formats"`
+	Platform         []string      `yaml:"platform"`
+	OutputMode       OutputMode    `yaml:"output-mode"`
+	Timeout          time.Duration `yaml:"timeout"`
+	TimeoutGrace     time.Duration `yaml:"timeout-grace"`
+	Limits           Limits        `yaml:"limits,omitempty"` // Overrides the global limits
+
+	Retries        int           `yaml:"retries,omitempty"`
+	RetryBackoff   time.Duration `yaml:"retry-backoff,omitempty"`    // Delay before the first retry, doubled after every retry. 0 = `DefaultRetryBackoff`
+	RetryExitCodes []int         `yaml:"retry-exit-codes,omitempty"` // Failures with other exit codes are not retried, unless matched by `RetryPatterns`
+	RetryPatterns  []string      `yaml:"retry-patterns,omitempty"`   // Regular expressions matched against the end of stderr
+
+	retryPatterns []*regexp.Regexp // Compiled `RetryPatterns`, see `CompileRetryPatterns()`
 }
 
+const DefaultRetryBackoff = time.Second
+
 type ToolConfig struct {
 	CompressionTool `yaml:",inline"`
 	Description     string              `yaml:"description"`
 	Arguments       map[string][]string `yaml:"arguments"`
 }
 
+type DecoderConfig struct {
+	Description      string   `yaml:"description"`
+	Command          string   `yaml:"command"`
+	Arguments        []string `yaml:"arguments"`
+	SupportedFormats []string `yaml:"supported-formats"`
+}
+
+// Name of Go's built-in PNG, JPEG and GIF decoders, reserved from `Config.Decoders`
+const BuiltinDecoder = "go"
+
+type Chain struct {
+	Description string   `yaml:"description"`
+	Tools       []string `yaml:"tools"`
+}
+
+type ChainStage struct {
+	Tool   string
+	Preset string // Preset to take the tool's arguments from. Empty to use the running preset's arguments
+}
+
 type Preset struct {
 	Description string   `yaml:"description"`
 	Shorthands  []string `yaml:"shorthands"`
 	IsHidden    bool     `yaml:"is-hidden"`
+	Lossless    bool     `yaml:"lossless"`
+	MinQuality  float64  `yaml:"min-quality"`
 
-	DefaultTools map[string][]string `yaml:"default-tools"`
+	Metadata  MetadataPolicy `yaml:"metadata,omitempty"`
+	Selection Selection      `yaml:"selection,omitempty"`
+	MinSaving MinSaving      `yaml:"min-saving,omitempty"`
+
+	DefaultTools map[string][]string      `yaml:"default-tools"`
+	Timeouts     map[string]time.Duration `yaml:"timeouts"`
 }
 
 type Config struct {
 	DefaultPreset string `yaml:"default-preset"`
+	Jobs          int    `yaml:"jobs"`
+	TempDir       string `yaml:"temp-dir,omitempty"`
+
+	ToolPriority []string `yaml:"tool-priority,omitempty"`
+
+	Limits Limits `yaml:"limits,omitempty"`
 
 	MimeExtensions map[string][]string `yaml:"mime-extensions"`
 
 	Wrappers map[string]map[string]string `yaml:"wrappers"`
 	Presets  map[string]Preset            `yaml:"presets"`
+	Chains   map[string]*Chain            `yaml:"chains"`
 	Tools    map[string]*ToolConfig       `yaml:"tools"`
+	Decoders map[string]*DecoderConfig    `yaml:"decoders,omitempty"`
 
 	isCached bool `yaml:"-"`
 
@@ -275,7 +366,7 @@ func (cfg *Config) QueryToolWrapper(tool *ToolConfig, platform string) string {
 }
 
 // Returns `true` if the tool with the given `toolName` is available to be run at the current platform.
-// Returns `false` otherwise.
+// Chains are available if all of their tools are. Returns `false` otherwise.
 func (cfg *Config) IsToolAvailable(toolName string) bool {
 	_, ok := cfg.toolAvailability[toolName]
 	return ok
@@ -317,6 +408,93 @@ func (cfg *Config) GetToolConfigFromNames(toolNames []string) (toolCfgMap map[st
 	return result
 }
 
+// Returns the timeout of the tool with the given `toolName` while running `presetName`. The preset's timeouts
+// take priority over the tool's. Returns 0 if the tool has no timeout.
+func (cfg *Config) GetToolTimeout(presetName, toolName string) time.Duration {
+	if timeout, ok := cfg.Presets[presetName].Timeouts[toolName]; ok {
+		return timeout
+	}
+
+	tool, ok := cfg.Tools[toolName]
+	if !ok {
+		return 0
+	}
+
+	return tool.Timeout
+}
+
+// Returns the limits of the tool with the given `toolName`, its own limits overriding the global limits.
+func (cfg *Config) GetToolLimits(toolName string) Limits {
+	tool, ok := cfg.Tools[toolName]
+	if !ok {
+		return cfg.Limits
+	}
+
+	return cfg.Limits.Override(tool.Limits)
+}
+
+// Returns `true` if `name` refers to a chain instead of a tool. Returns `false` otherwise.
+func (cfg *Config) IsChain(name string) bool {
+	_, ok := cfg.Chains[name]
+	return ok
+}
+
+// Returns the file formats that every tool in the chain with the given `chainName` supports. Undefined tools
+// are ignored.
+func (cfg *Config) GetChainSupportedFormats(chainName string) (fileFormatsMime []string) {
+	chain, ok := cfg.Chains[chainName]
+	if !ok {
+		return []string{}
+	}
+
+	var supported []string
+	isFirst := true
+
+	for _, stage := range chain.Stages() {
+		tool, ok := cfg.Tools[stage.Tool]
+		if !ok {
+			continue
+		}
+
+		if isFirst {
+			supported = slices.Clone(tool.SupportedFormats)
+			isFirst = false
+			continue
+		}
+
+		supported = slices.DeleteFunc(supported, func(mime string) bool {
+			return !slices.Contains(tool.SupportedFormats, mime)
+		})
+	}
+
+	if supported == nil {
+		return []string{}
+	}
+
+	return supported
+}
+
+// Parses the chain's tool list into stages. A tool written as `tool@preset` is split into the tool's name and
+// the preset it takes its arguments from.
+func (ch *Chain) Stages() (stages []ChainStage) {
+	stages = make([]ChainStage, 0, len(ch.Tools))
+	for _, tool := range ch.Tools {
+		name, preset, _ := strings.Cut(tool, IncludePrefix)
+		stages = append(stages, ChainStage{Tool: name, Preset: preset})
+	}
+
+	return stages
+}
+
+// Returns the preset the stage's tool takes its arguments from while running `runningPreset`.
+func (cs ChainStage) ArgumentPreset(runningPreset string) string {
+	if cs.Preset != "" {
+		return cs.Preset
+	}
+
+	return runningPreset
+}
+
 // Checks the config for any errors and inconsistencies. Returns a slice of errors in the config.
 func (cfg *Config) Validate() []error {
 	if !cfg.isCached {
@@ -329,6 +507,13 @@ func (cfg *Config) Validate() []error {
 		undefinedDefaultPreset = "default-preset is not defined"
 		unknownDefaultPreset   = "default-preset is an undefined preset: %s"
 
+		negativeJobs = "jobs cannot be negative: %d"
+
+		invalidLimits = "limits: %v"
+
+		toolPriorityUnknownTool = "tool-priority: included an undefined tool or chain: %s"
+		toolPriorityDuplicate   = "tool-priority: %q is included more than once"
+
 		mimeExtUnknownFormat   = "mime-extensions: %q is an unknown file format"
 		mimeExtEmptyExtensions = "mime-extensions: %q has no defined file extensions"
 
@@ -342,6 +527,24 @@ func (cfg *Config) Validate() []error {
 		presetUnknownDefaultTool     = "preset: %q included an undefined tool on default-tools at %q: %s"
 		presetDefaultToolWithNoArgs  = "preset: %q included tool %q on default-tools with undefined arguments for this preset"
 		presetDefaultToolUnsupported = "preset: %q included tool %q on default-tools for %s, which does not support this file format"
+		presetDefaultChainWithNoArgs = "preset: %q included chain %q on default-tools, but its tool %q has undefined arguments for this preset"
+		presetTimeoutUnknownTool     = "preset: %q has timeout defined for an undefined tool: %s"
+		presetNegativeTimeout        = "preset: %q has negative timeout defined for %q: %v"
+		presetMinQualityOutOfRange   = "preset: %q has min-quality outside of 0 to 1: %v"
+		presetEmptyMetadataList      = "preset: %q has an empty metadata whitelist"
+		presetUnknownMetadataName    = "preset: %q has an unknown chunk or segment name in metadata: %s"
+		presetInvalidSelection       = "preset: %q has an invalid selection: %v"
+
+		chainUndefinedTools  = "chain: %q has no tools defined"
+		chainConflictingName = "chain: %q has the same name as a tool"
+		chainUnknownTool     = "chain: %q included an undefined tool: %s"
+		chainUnknownPreset   = "chain: %q included tool %q with undefined arguments for preset: %s"
+		chainNoCommonFormat  = "chain: %q has no file format supported by all of its tools"
+
+		decoderReservedName     = "decoder: %q is reserved for Go's built-in decoders"
+		decoderUndefinedCommand = "decoder: %q has no command defined"
+		decoderUndefinedFormat  = "decoder: %q has no supported-formats defined"
+		decoderUnknownFormat    = "decoder: %q has unknown file format defined: %s"
 
 		toolUndefinedCommand    = "tool: %q has no command defined"
 		toolUndefinedPlatform   = "tool: %q has no platforms defined"
@@ -352,6 +555,12 @@ func (cfg *Config) Validate() []error {
 		toolUnknownOutputMode   = "tool: %q has unknown output-mode defined "
 		toolUndefinedPresets    = "tool: %q has no arguments defined"
 		toolUnknownPreset       = "tool: %q has unknown preset defined in arguments: %s"
+		toolNegativeTimeout     = "tool: %q has negative timeout defined: %v"
+		toolNegativeGrace       = "tool: %q has negative timeout-grace defined: %v"
+		toolInvalidLimits       = "tool: %q has invalid limits: %v"
+		toolNegativeRetries     = "tool: %q has negative retries defined: %d"
+		toolNegativeBackoff     = "tool: %q has negative retry-backoff defined: %v"
+		toolInvalidRetryPattern = "tool: %q has invalid retry-patterns defined: %v"
 	)
 
 	var configErrors []error
@@ -369,6 +578,27 @@ func (cfg *Config) Validate() []error {
 		}
 	}
 
+	// jobs
+	if cfg.Jobs < 0 {
+		addErrorString(fmt.Sprintf(negativeJobs, cfg.Jobs))
+	}
+
+	// limits
+	if err := cfg.Limits.Validate(); err != nil {
+		addErrorString(fmt.Sprintf(invalidLimits, err))
+	}
+
+	// tool-priority
+	for i, name := range cfg.ToolPriority {
+		if _, isTool := cfg.Tools[name]; !isTool && !cfg.IsChain(name) {
+			addErrorString(fmt.Sprintf(toolPriorityUnknownTool, name))
+		}
+
+		if slices.Index(cfg.ToolPriority, name) != i {
+			addErrorString(fmt.Sprintf(toolPriorityDuplicate, name))
+		}
+	}
+
 	// mime-extensions
 	for format, extensions := range cfg.MimeExtensions {
 		if mimetype.Lookup(format) == nil {
@@ -422,6 +652,25 @@ func (cfg *Config) Validate() []error {
 			}
 
 			for _, toolName := range defaultTools {
+				if chain, ok := cfg.Chains[toolName]; ok {
+					for _, stage := range chain.Stages() {
+						tool, ok := cfg.Tools[stage.Tool]
+						if !ok || stage.Preset != "" {
+							continue // Checked on chains
+						}
+
+						if _, ok := tool.Arguments[presetName]; !ok {
+							addErrorString(fmt.Sprintf(presetDefaultChainWithNoArgs, presetName, toolName, stage.Tool))
+						}
+					}
+
+					if isFormatKnown && !slices.Contains(cfg.GetChainSupportedFormats(toolName), format) {
+						addErrorString(fmt.Sprintf(presetDefaultToolUnsupported, presetName, toolName, format))
+					}
+
+					continue
+				}
+
 				tool, ok := cfg.Tools[toolName]
 				if !ok {
 					addErrorString(fmt.Sprintf(presetUnknownDefaultTool, presetName, format, toolName))
@@ -440,12 +689,97 @@ func (cfg *Config) Validate() []error {
 		}
 	}
 
+	for presetName, presetData := range cfg.Presets {
+		if presetData.MinQuality < 0 || presetData.MinQuality > 1 {
+			addErrorString(fmt.Sprintf(presetMinQualityOutOfRange, presetName, presetData.MinQuality))
+		}
+
+		if presetData.Metadata.Mode == MetadataWhitelist && len(presetData.Metadata.Whitelist) == 0 {
+			addErrorString(fmt.Sprintf(presetEmptyMetadataList, presetName))
+		}
+
+		for _, name := range presetData.Metadata.Whitelist {
+			if !IsValidMetadataName(name) {
+				addErrorString(fmt.Sprintf(presetUnknownMetadataName, presetName, name))
+			}
+		}
+
+		if err := presetData.Selection.Validate(); err != nil {
+			addErrorString(fmt.Sprintf(presetInvalidSelection, presetName, err))
+		}
+
+		for toolName, timeout := range presetData.Timeouts {
+			if _, ok := cfg.Tools[toolName]; !ok {
+				addErrorString(fmt.Sprintf(presetTimeoutUnknownTool, presetName, toolName))
+			}
+
+			if timeout < 0 {
+				addErrorString(fmt.Sprintf(presetNegativeTimeout, presetName, toolName, timeout))
+			}
+		}
+	}
+
 	for shorthand, presets := range shorthandList {
 		if len(presets) > 1 {
 			addErrorString(fmt.Sprintf(presetShorthandConflict, shorthand, strings.Join(presets, ", ")))
 		}
 	}
 
+	// chains
+	for name, chain := range cfg.Chains {
+		if _, ok := cfg.Tools[name]; ok {
+			addErrorString(fmt.Sprintf(chainConflictingName, name))
+		}
+
+		if len(chain.Tools) == 0 {
+			addErrorString(fmt.Sprintf(chainUndefinedTools, name))
+			continue
+		}
+
+		isAllDefined := true
+		for _, stage := range chain.Stages() {
+			tool, ok := cfg.Tools[stage.Tool]
+			if !ok {
+				addErrorString(fmt.Sprintf(chainUnknownTool, name, stage.Tool))
+				isAllDefined = false
+				continue
+			}
+
+			if stage.Preset == "" {
+				continue // Depends on the running preset, checked on presets
+			}
+
+			if _, ok := tool.Arguments[stage.Preset]; !ok {
+				addErrorString(fmt.Sprintf(chainUnknownPreset, name, stage.Tool, stage.Preset))
+			}
+		}
+
+		if isAllDefined && len(cfg.GetChainSupportedFormats(name)) == 0 {
+			addErrorString(fmt.Sprintf(chainNoCommonFormat, name))
+		}
+	}
+
+	// decoders
+	for name, decoder := range cfg.Decoders {
+		if name == BuiltinDecoder {
+			addErrorString(fmt.Sprintf(decoderReservedName, name))
+		}
+
+		if decoder.Command == "" {
+			addErrorString(fmt.Sprintf(decoderUndefinedCommand, name))
+		}
+
+		if len(decoder.SupportedFormats) == 0 {
+			addErrorString(fmt.Sprintf(decoderUndefinedFormat, name))
+		}
+
+		for _, fileFormat := range decoder.SupportedFormats {
+			if mimetype.Lookup(fileFormat) == nil {
+				addErrorString(fmt.Sprintf(decoderUnknownFormat, name, fileFormat))
+			}
+		}
+	}
+
 	// tools
 	for name, tool := range cfg.Tools {
 		if tool.Command == "" {
@@ -472,6 +806,32 @@ func (cfg *Config) Validate() []error {
 			}
 		}
 
+		if tool.Timeout < 0 {
+			addErrorString(fmt.Sprintf(toolNegativeTimeout, name, tool.Timeout))
+		}
+
+		if tool.TimeoutGrace < 0 {
+			addErrorString(fmt.Sprintf(toolNegativeGrace, name, tool.TimeoutGrace))
+		}
+
+		if err := tool.Limits.Validate(); err != nil {
+			addErrorString(fmt.Sprintf(toolInvalidLimits, name, err))
+		}
+
+		if tool.Retries < 0 {
+			addErrorString(fmt.Sprintf(toolNegativeRetries, name, tool.Retries))
+		}
+
+		if tool.RetryBackoff < 0 {
+			addErrorString(fmt.Sprintf(toolNegativeBackoff, name, tool.RetryBackoff))
+		}
+
+		for _, pattern := range tool.RetryPatterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				addErrorString(fmt.Sprintf(toolInvalidRetryPattern, name, err))
+			}
+		}
+
 		if len(tool.Arguments) == 0 {
 			addErrorString(fmt.Sprintf(toolUndefinedPresets, name))
 		} else {
@@ -505,6 +865,10 @@ func (cfg *Config) Cache() {
 	cfg.cacheSupportedFileFormats()
 	cfg.cacheSupportedFileExtensions()
 	cfg.cacheAvailability()
+
+	for _, tool := range cfg.Tools {
+		tool.CompileRetryPatterns()
+	}
 }
 
 func (cfg *Config) cacheSupportedFileFormats() {
@@ -568,6 +932,20 @@ func (cfg *Config) cacheAvailability() {
 		}
 	}
 
+	for chainName, chain := range cfg.Chains {
+		isAvailable := true
+		for _, stage := range chain.Stages() {
+			if _, ok := availability[stage.Tool]; !ok {
+				isAvailable = false
+				break
+			}
+		}
+
+		if isAvailable {
+			availability[chainName] = struct{}{}
+		}
+	}
+
 	cfg.toolAvailability = availability
 }
 
@@ -582,6 +960,49 @@ func (ct *CompressionTool) CanBatchCompress() bool {
 	return ct.OutputMode == BatchOverwrite
 }
 
+// Compiles `RetryPatterns` once for `IsRetryableFailure()`. Done by `Cache()` for the tools of a config, tools that
+// are built otherwise must call this themselves. Invalid patterns are left out, these are reported by `Validate()`.
+func (ct *CompressionTool) CompileRetryPatterns() {
+	ct.retryPatterns = make([]*regexp.Regexp, 0, len(ct.RetryPatterns))
+	for _, pattern := range ct.RetryPatterns {
+		expression, err := regexp.Compile(pattern)
+		if err == nil {
+			ct.retryPatterns = append(ct.retryPatterns, expression)
+		}
+	}
+}
+
+// Returns `true` if a failure exiting with `exitCode` and printing `stderr` may be retried. Every failure may be
+// retried if neither exit codes nor patterns are defined. Patterns must be compiled by `CompileRetryPatterns()`
+// first. Returns `false` otherwise.
+func (ct *CompressionTool) IsRetryableFailure(exitCode int, stderr []byte) bool {
+	if len(ct.RetryExitCodes) == 0 && len(ct.RetryPatterns) == 0 {
+		return true
+	}
+
+	if slices.Contains(ct.RetryExitCodes, exitCode) {
+		return true
+	}
+
+	for _, expression := range ct.retryPatterns {
+		if expression.Match(stderr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the delay before retrying after the failed `attempt` (starting from 1), doubling on every attempt.
+func (ct *CompressionTool) RetryDelay(attempt int) time.Duration {
+	backoff := ct.RetryBackoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return backoff << min(attempt-1, 16)
+}
+
 func (o *OutputMode) UnmarshalYAML(value *yaml.Node) error {
 	var mode string
 	if err := value.Decode(&mode); err != nil {
@@ -7,6 +7,7 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ArrayNone/compacty/internal/config"
 
@@ -41,6 +42,13 @@ var validTool = map[string]*config.ToolConfig{
 	},
 }
 
+var validChain = map[string]*config.Chain{
+	"cat-twice": {
+		Description: "desc",
+		Tools:       []string{"cat", "cat@minimal"},
+	},
+}
+
 var validWrapper = map[string]map[string]string{
 	"linux": {
 		"windows": "wine",
@@ -61,6 +69,7 @@ var validConfig = config.Config{
 	DefaultPreset: "default",
 
 	Presets:        validPreset,
+	Chains:         validChain,
 	Tools:          validTool,
 	Wrappers:       validWrapper,
 	MimeExtensions: validMimeExtensions,
@@ -447,6 +456,617 @@ func TestConfig_GetToolConfigFromNames(t *testing.T) {
 	})
 }
 
+func TestConfig_Chains(t *testing.T) {
+	validConfig.Cache()
+	t.Run("stages", func(t *testing.T) {
+		stages := validChain["cat-twice"].Stages()
+		expected := []config.ChainStage{{Tool: "cat"}, {Tool: "cat", Preset: "minimal"}}
+
+		if !slices.Equal(stages, expected) {
+			t.Errorf("expected %v, got: %v", expected, stages)
+		}
+	})
+
+	t.Run("argument preset", func(t *testing.T) {
+		stage := config.ChainStage{Tool: "cat"}
+		if preset := stage.ArgumentPreset("default"); preset != "default" {
+			t.Errorf("stage without preset should use the running preset \"default\", got: %q", preset)
+		}
+
+		stage = config.ChainStage{Tool: "cat", Preset: "minimal"}
+		if preset := stage.ArgumentPreset("default"); preset != "minimal" {
+			t.Errorf("stage with preset should use \"minimal\", got: %q", preset)
+		}
+	})
+
+	t.Run("supported formats", func(t *testing.T) {
+		cfg := &config.Config{
+			Tools: map[string]*config.ToolConfig{
+				"a": {CompressionTool: config.CompressionTool{SupportedFormats: []string{"image/png", "image/jpeg"}}},
+				"b": {CompressionTool: config.CompressionTool{SupportedFormats: []string{"image/jpeg", "image/gif"}}},
+			},
+			Chains: map[string]*config.Chain{
+				"a-b": {Tools: []string{"a", "b"}},
+			},
+		}
+
+		formats := cfg.GetChainSupportedFormats("a-b")
+		expected := []string{"image/jpeg"}
+		if !slices.Equal(formats, expected) {
+			t.Errorf("expected %v, got: %v", expected, formats)
+		}
+
+		if !cfg.IsChain("a-b") || cfg.IsChain("a") {
+			t.Error("IsChain does not tell chains and tools apart")
+		}
+	})
+}
+
+func TestConfig_GetToolTimeout(t *testing.T) {
+	cfg := &config.Config{
+		Presets: map[string]config.Preset{
+			"fast": {Timeouts: map[string]time.Duration{"cat": time.Second}},
+			"slow": {},
+		},
+		Tools: map[string]*config.ToolConfig{
+			"cat": {CompressionTool: config.CompressionTool{Timeout: time.Minute}},
+			"tac": {},
+		},
+	}
+
+	testCases := []struct {
+		preset, tool string
+		expected     time.Duration
+	}{
+		{"fast", "cat", time.Second},
+		{"slow", "cat", time.Minute},
+		{"fast", "tac", 0},
+		{"fast", "obliterator", 0},
+	}
+
+	for _, testCase := range testCases {
+		timeout := cfg.GetToolTimeout(testCase.preset, testCase.tool)
+		if timeout != testCase.expected {
+			t.Errorf("expected %v for %s on %s, got: %v", testCase.expected, testCase.tool, testCase.preset, timeout)
+		}
+	}
+}
+
+func TestConfig_GetToolLimits(t *testing.T) {
+	globalNice, toolNice := 10, 0
+
+	cfg := &config.Config{
+		Limits: config.Limits{Nice: &globalNice, MemoryLimit: 1 << 30},
+		Tools: map[string]*config.ToolConfig{
+			"cat": {CompressionTool: config.CompressionTool{Limits: config.Limits{Nice: &toolNice, CPUAffinity: config.CPUList{0, 1}}}},
+			"tac": {},
+		},
+	}
+
+	testCases := []struct {
+		tool     string
+		expected config.Limits
+	}{
+		{"cat", config.Limits{Nice: &toolNice, MemoryLimit: 1 << 30, CPUAffinity: config.CPUList{0, 1}}},
+		{"tac", config.Limits{Nice: &globalNice, MemoryLimit: 1 << 30}},
+		{"obliterator", config.Limits{Nice: &globalNice, MemoryLimit: 1 << 30}},
+	}
+
+	for _, testCase := range testCases {
+		limits := cfg.GetToolLimits(testCase.tool)
+		if *limits.Nice != *testCase.expected.Nice || limits.MemoryLimit != testCase.expected.MemoryLimit ||
+			!slices.Equal(limits.CPUAffinity, testCase.expected.CPUAffinity) || limits.IOPriority != testCase.expected.IOPriority {
+			t.Errorf("expected %+v for %s, got: %+v", testCase.expected, testCase.tool, limits)
+		}
+	}
+}
+
+func TestConfig_IsRetryableFailure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		tool     config.CompressionTool
+		exitCode int
+		stderr   string
+		expected bool
+	}{
+		{"any failure", config.CompressionTool{Retries: 1}, 1, "", true},
+		{"listed exit code", config.CompressionTool{RetryExitCodes: []int{3, 4}}, 4, "", true},
+		{"unlisted exit code", config.CompressionTool{RetryExitCodes: []int{3, 4}}, 1, "", false},
+		{"matching pattern", config.CompressionTool{RetryPatterns: []string{"wineserver.*failed"}}, 1, "err: wineserver startup failed", true},
+		{"no matching pattern", config.CompressionTool{RetryPatterns: []string{"wineserver"}}, 1, "invalid file", false},
+		{"pattern or exit code", config.CompressionTool{RetryExitCodes: []int{2}, RetryPatterns: []string{"busy"}}, 2, "invalid file", true},
+	}
+
+	for _, testCase := range testCases {
+		testCase.tool.CompileRetryPatterns()
+		isRetryable := testCase.tool.IsRetryableFailure(testCase.exitCode, []byte(testCase.stderr))
+		if isRetryable != testCase.expected {
+			t.Errorf("%s: expected %v, got: %v", testCase.name, testCase.expected, isRetryable)
+		}
+	}
+}
+
+func TestConfig_RetryDelay(t *testing.T) {
+	testCases := []struct {
+		backoff  time.Duration
+		attempt  int
+		expected time.Duration
+	}{
+		{0, 1, config.DefaultRetryBackoff},
+		{0, 2, 2 * config.DefaultRetryBackoff},
+		{100 * time.Millisecond, 1, 100 * time.Millisecond},
+		{100 * time.Millisecond, 3, 400 * time.Millisecond},
+	}
+
+	for _, testCase := range testCases {
+		tool := config.CompressionTool{RetryBackoff: testCase.backoff}
+		delay := tool.RetryDelay(testCase.attempt)
+		if delay != testCase.expected {
+			t.Errorf("expected %v for attempt %d with a backoff of %v, got: %v", testCase.expected, testCase.attempt, testCase.backoff, delay)
+		}
+	}
+}
+
+func TestConfig_ParseIOPriority(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.IOPriority
+		wantError bool
+	}{
+		{"idle", config.IOPriority{Class: config.IOPriorityIdle}, false},
+		{"best-effort", config.IOPriority{Class: config.IOPriorityBestEffort, Level: 4}, false},
+		{"best-effort:7", config.IOPriority{Class: config.IOPriorityBestEffort, Level: 7}, false},
+		{"realtime:0", config.IOPriority{Class: config.IOPriorityRealtime, Level: 0}, false},
+		{"idle:3", config.IOPriority{}, true},
+		{"best-effort:8", config.IOPriority{}, true},
+		{"best-effort:high", config.IOPriority{}, true},
+		{"urgent", config.IOPriority{}, true},
+		{"", config.IOPriority{}, true},
+	}
+
+	for _, testCase := range testCases {
+		priority, err := config.ParseIOPriority(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if priority != testCase.expected {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, priority)
+		}
+	}
+}
+
+func TestConfig_ParseByteSize(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.ByteSize
+		wantError bool
+	}{
+		{"4096", 4096, false},
+		{"512MiB", 512 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{"2GB", 2000000000, false},
+		{"1.5KB", 1500, false},
+		{"-1", 0, true},
+		{"2TB", 0, true},
+		{"", 0, true},
+	}
+
+	for _, testCase := range testCases {
+		size, err := config.ParseByteSize(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if size != testCase.expected {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, size)
+		}
+	}
+}
+
+func TestConfig_ParseCPUList(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.CPUList
+		wantError bool
+	}{
+		{"0", config.CPUList{0}, false},
+		{"0-3", config.CPUList{0, 1, 2, 3}, false},
+		{"0-1, 6", config.CPUList{0, 1, 6}, false},
+		{"3-1", nil, true},
+		{"0,0", nil, true},
+		{"0-2,1", nil, true},
+		{"-1", nil, true},
+		{"a", nil, true},
+		{"", nil, true},
+	}
+
+	for _, testCase := range testCases {
+		cpus, err := config.ParseCPUList(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if !testCase.wantError && !slices.Equal(cpus, testCase.expected) {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, cpus)
+		}
+	}
+}
+
+func TestConfig_LimitsYAML(t *testing.T) {
+	nice := 19
+
+	testCases := []struct {
+		data     string
+		expected config.Limits
+	}{
+		{"nice: 19", config.Limits{Nice: &nice}},
+		{"io-priority: best-effort:7", config.Limits{IOPriority: config.IOPriority{Class: config.IOPriorityBestEffort, Level: 7}}},
+		{"memory-limit: 2GiB", config.Limits{MemoryLimit: 2 << 30}},
+		{"cpu-affinity: 0-2", config.Limits{CPUAffinity: config.CPUList{0, 1, 2}}},
+		{"cpu-affinity: [0, 1, 2]", config.Limits{CPUAffinity: config.CPUList{0, 1, 2}}},
+		{"{}", config.Limits{}},
+	}
+
+	isEqual := func(a, b config.Limits) bool {
+		isNiceEqual := (a.Nice == nil && b.Nice == nil) || (a.Nice != nil && b.Nice != nil && *a.Nice == *b.Nice)
+		return isNiceEqual && a.IOPriority == b.IOPriority && a.MemoryLimit == b.MemoryLimit &&
+			slices.Equal(a.CPUAffinity, b.CPUAffinity)
+	}
+
+	for _, testCase := range testCases {
+		var limits config.Limits
+		err := yaml.Unmarshal([]byte(testCase.data), &limits)
+		if err != nil {
+			t.Errorf("error occurred while decoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		if !isEqual(limits, testCase.expected) {
+			t.Errorf("expected %+v for %q, got: %+v", testCase.expected, testCase.data, limits)
+		}
+
+		data, err := yaml.Marshal(limits)
+		if err != nil {
+			t.Errorf("error occurred while encoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		var reencoded config.Limits
+		err = yaml.Unmarshal(data, &reencoded)
+		if err != nil || !isEqual(reencoded, testCase.expected) {
+			t.Errorf("limits of %q are not kept when reencoded, got: %+v", testCase.data, reencoded)
+		}
+	}
+
+	t.Run("invalid limits", func(t *testing.T) {
+		for _, data := range []string{"io-priority: urgent", "memory-limit: a lot", "cpu-affinity: 3-1"} {
+			var limits config.Limits
+			err := yaml.Unmarshal([]byte(data), &limits)
+			if err == nil {
+				t.Errorf("expected an error for %q", data)
+			}
+		}
+	})
+}
+
+func TestConfig_ParseMetadataPolicy(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.MetadataPolicy
+		wantError bool
+	}{
+		{"strip-all", config.MetadataPolicy{Mode: config.MetadataStripAll}, false},
+		{"keep-colour", config.MetadataPolicy{Mode: config.MetadataKeepColor}, false},
+		{"Keep-All", config.MetadataPolicy{Mode: config.MetadataKeepAll}, false},
+		{"unchanged", config.MetadataPolicy{Mode: config.MetadataUnchanged}, false},
+		{"iCCP,APP1,COM", config.MetadataPolicy{Mode: config.MetadataWhitelist, Whitelist: []string{"iCCP", "APP1", "COM"}}, false},
+		{"keep-some", config.MetadataPolicy{}, true},
+		{"iCCP,,APP1", config.MetadataPolicy{}, true},
+	}
+
+	for _, testCase := range testCases {
+		policy, err := config.ParseMetadataPolicy(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(policy, testCase.expected) {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, policy)
+		}
+	}
+}
+
+func TestConfig_MetadataPolicyYAML(t *testing.T) {
+	testCases := []struct {
+		data     string
+		expected config.MetadataPolicy
+	}{
+		{"metadata: keep-color", config.MetadataPolicy{Mode: config.MetadataKeepColor}},
+		{"metadata: [iCCP, eXIf]", config.MetadataPolicy{Mode: config.MetadataWhitelist, Whitelist: []string{"iCCP", "eXIf"}}},
+		{"description: no policy", config.MetadataPolicy{Mode: config.MetadataUnchanged}},
+	}
+
+	for _, testCase := range testCases {
+		var preset config.Preset
+		err := yaml.Unmarshal([]byte(testCase.data), &preset)
+		if err != nil {
+			t.Errorf("error occurred while decoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(preset.Metadata, testCase.expected) {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.data, preset.Metadata)
+		}
+
+		data, err := yaml.Marshal(preset)
+		if err != nil {
+			t.Errorf("error occurred while encoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		var reencoded config.Preset
+		err = yaml.Unmarshal(data, &reencoded)
+		if err != nil || !reflect.DeepEqual(reencoded.Metadata, testCase.expected) {
+			t.Errorf("policy of %q is not kept when reencoded, got: %v", testCase.data, reencoded.Metadata)
+		}
+	}
+
+	t.Run("unknown policy", func(t *testing.T) {
+		var preset config.Preset
+		err := yaml.Unmarshal([]byte("metadata: keep-some"), &preset)
+		if err == nil {
+			t.Error("expected an error for an unknown policy")
+		}
+	})
+}
+
+func TestConfig_ParseSelection(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.Selection
+		wantError bool
+	}{
+		{"size", config.Selection{Strategy: config.SelectBySize}, false},
+		{"decode-time", config.Selection{Strategy: config.SelectByDecodeTime}, false},
+		{
+			"weighted:size=1, decode=0.2",
+			config.Selection{Strategy: config.SelectByWeightedScore, Weights: map[string]float64{"size": 1, "decode": 0.2}},
+			false,
+		},
+		{
+			"expression:size * (1 - 0.005 * (decode <= 0.33))",
+			config.Selection{Strategy: config.SelectByExpression, Expression: "size * (1 - 0.005 * (decode <= 0.33))"},
+			false,
+		},
+		{"size:1", config.Selection{}, true},
+		{"fastest", config.Selection{}, true},
+		{"weighted:size", config.Selection{}, true},
+		{"weighted:size=small", config.Selection{}, true},
+		{"weighted:speed=1", config.Selection{}, true},
+		{"expression:size +", config.Selection{}, true},
+		{"expression:speed", config.Selection{}, true},
+		{"expression:round(size)", config.Selection{}, true},
+	}
+
+	for _, testCase := range testCases {
+		selection, err := config.ParseSelection(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if testCase.wantError {
+			continue
+		}
+
+		if !reflect.DeepEqual(selection, testCase.expected) {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, selection)
+		}
+
+		reparsed, err := config.ParseSelection(selection.String())
+		if err != nil || !reflect.DeepEqual(reparsed, testCase.expected) {
+			t.Errorf("selection of %q is not kept when formatted as %q, got: %v", testCase.value, selection.String(), reparsed)
+		}
+	}
+}
+
+func TestConfig_SelectionUses(t *testing.T) {
+	testCases := []struct {
+		value    string
+		variable string
+		expected bool
+	}{
+		{"size", "size", true},
+		{"size", "decode", false},
+		{"decode-time", "decode", true},
+		{"weighted:size=1,decode=0.2", "decode", true},
+		{"weighted:size=1,decode=0", "decode", false},
+		{"expression:size * (quality < 0.98)", "quality", true},
+		{"expression:size * (quality < 0.98)", "decode_ms", false},
+	}
+
+	for _, testCase := range testCases {
+		selection, err := config.ParseSelection(testCase.value)
+		if err != nil {
+			t.Errorf("error occurred while parsing %q: %v", testCase.value, err)
+			continue
+		}
+
+		if selection.Uses(testCase.variable) != testCase.expected {
+			t.Errorf("expected %q to use %s: %v", testCase.value, testCase.variable, testCase.expected)
+		}
+	}
+}
+
+func TestConfig_SelectionParsesExpressionOnce(t *testing.T) {
+	selection, err := config.ParseSelection("expression:size + 0.1 * decode")
+	if err != nil {
+		t.Fatal("error occurred while parsing:", err)
+	}
+
+	parsed := selection.ParsedExpression()
+	if parsed == nil || selection.ParsedExpression() != parsed {
+		t.Errorf("expected the expression to be parsed once, got: %p and %p", parsed, selection.ParsedExpression())
+	}
+
+	if !selection.Uses("decode") || selection.Uses("quality") {
+		t.Errorf("expected %q to use decode only", selection.Expression)
+	}
+}
+
+func TestConfig_SelectionYAML(t *testing.T) {
+	testCases := []struct {
+		data     string
+		expected config.Selection
+	}{
+		{"selection: decode-time", config.Selection{Strategy: config.SelectByDecodeTime}},
+		{
+			"selection: {strategy: weighted, weights: {size: 1, time: 0.01}}",
+			config.Selection{Strategy: config.SelectByWeightedScore, Weights: map[string]float64{"size": 1, "time": 0.01}},
+		},
+		{
+			"selection: {strategy: expression, expression: size + quality_loss}",
+			config.Selection{Strategy: config.SelectByExpression, Expression: "size + quality_loss"},
+		},
+		{"description: no selection", config.Selection{}},
+	}
+
+	for _, testCase := range testCases {
+		var preset config.Preset
+		err := yaml.Unmarshal([]byte(testCase.data), &preset)
+		if err != nil {
+			t.Errorf("error occurred while decoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(preset.Selection, testCase.expected) {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.data, preset.Selection)
+		}
+
+		data, err := yaml.Marshal(preset)
+		if err != nil {
+			t.Errorf("error occurred while encoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		var reencoded config.Preset
+		err = yaml.Unmarshal(data, &reencoded)
+		if err != nil || !reflect.DeepEqual(reencoded.Selection, testCase.expected) {
+			t.Errorf("selection of %q is not kept when reencoded, got: %v", testCase.data, reencoded.Selection)
+		}
+	}
+}
+
+func TestConfig_ParseMinSaving(t *testing.T) {
+	testCases := []struct {
+		value     string
+		expected  config.MinSaving
+		wantError bool
+	}{
+		{"4096", config.MinSaving{Bytes: 4096}, false},
+		{"4KB", config.MinSaving{Bytes: 4000}, false},
+		{"4KiB", config.MinSaving{Bytes: 4096}, false},
+		{"1.5MiB", config.MinSaving{Bytes: 1572864}, false},
+		{"0.5%", config.MinSaving{Percent: 0.5}, false},
+		{"4KiB, 0.5%", config.MinSaving{Bytes: 4096, Percent: 0.5}, false},
+		{"0.5%,4KiB", config.MinSaving{Bytes: 4096, Percent: 0.5}, false},
+		{"4GB", config.MinSaving{}, true},
+		{"-1", config.MinSaving{}, true},
+		{"101%", config.MinSaving{}, true},
+		{"1%,2%", config.MinSaving{}, true},
+		{"1KB,2KB", config.MinSaving{}, true},
+		{"", config.MinSaving{}, true},
+	}
+
+	for _, testCase := range testCases {
+		minSaving, err := config.ParseMinSaving(testCase.value)
+		if (err != nil) != testCase.wantError {
+			t.Errorf("unexpected error state for %q: %v", testCase.value, err)
+			continue
+		}
+
+		if minSaving != testCase.expected {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.value, minSaving)
+		}
+	}
+}
+
+func TestConfig_MinSavingIsMet(t *testing.T) {
+	testCases := []struct {
+		minSaving    config.MinSaving
+		originalSize int64
+		finalSize    int64
+		expected     bool
+	}{
+		{config.MinSaving{}, 1000, 999, true},
+		{config.MinSaving{}, 1000, 1000, false},
+		{config.MinSaving{Bytes: 100}, 1000, 900, true},
+		{config.MinSaving{Bytes: 100}, 1000, 901, false},
+		{config.MinSaving{Percent: 10}, 1000, 900, true},
+		{config.MinSaving{Percent: 10}, 1000, 901, false},
+		{config.MinSaving{Bytes: 50, Percent: 10}, 1000, 940, false},
+		{config.MinSaving{Bytes: 200, Percent: 10}, 1000, 850, false},
+		{config.MinSaving{Bytes: 50, Percent: 10}, 1000, 850, true},
+	}
+
+	for _, testCase := range testCases {
+		isMet := testCase.minSaving.IsMet(testCase.originalSize, testCase.finalSize)
+		if isMet != testCase.expected {
+			t.Errorf("expected %v for %v from %d to %d, got: %v", testCase.expected, testCase.minSaving, testCase.originalSize, testCase.finalSize, isMet)
+		}
+	}
+}
+
+func TestConfig_MinSavingYAML(t *testing.T) {
+	testCases := []struct {
+		data     string
+		expected config.MinSaving
+	}{
+		{"min-saving: 512", config.MinSaving{Bytes: 512}},
+		{"min-saving: 1%", config.MinSaving{Percent: 1}},
+		{"min-saving: 4KiB,1%", config.MinSaving{Bytes: 4096, Percent: 1}},
+		{"description: no minimum", config.MinSaving{}},
+	}
+
+	for _, testCase := range testCases {
+		var preset config.Preset
+		err := yaml.Unmarshal([]byte(testCase.data), &preset)
+		if err != nil {
+			t.Errorf("error occurred while decoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		if preset.MinSaving != testCase.expected {
+			t.Errorf("expected %v for %q, got: %v", testCase.expected, testCase.data, preset.MinSaving)
+		}
+
+		data, err := yaml.Marshal(preset)
+		if err != nil {
+			t.Errorf("error occurred while encoding %q: %v", testCase.data, err)
+			continue
+		}
+
+		var reencoded config.Preset
+		err = yaml.Unmarshal(data, &reencoded)
+		if err != nil || reencoded.MinSaving != testCase.expected {
+			t.Errorf("minimum of %q is not kept when reencoded, got: %v", testCase.data, reencoded.MinSaving)
+		}
+	}
+
+	t.Run("invalid minimum", func(t *testing.T) {
+		var preset config.Preset
+		err := yaml.Unmarshal([]byte("min-saving: a lot"), &preset)
+		if err == nil {
+			t.Error("expected an error for an invalid minimum")
+		}
+	})
+}
+
 func TestConfig_DefaultConfig(t *testing.T) {
 	t.Run("decode default config", func(t *testing.T) {
 		defaultStr := config.GetDefaultConfigStr()
@@ -497,6 +1117,19 @@ func TestConfig_Validate(t *testing.T) {
 			wantError: "default-preset is an undefined preset: nope",
 		},
 
+		{
+			name: "negative jobs",
+			config: config.Config{
+				DefaultPreset: "default",
+				Jobs:          -1,
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "jobs cannot be negative: -1",
+		},
+
 		{
 			name: "unknown file format in mime-extensions",
 			config: config.Config{
@@ -791,6 +1424,455 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			wantError: "tool: \"false\" has unknown file format defined: invalid/mime",
 		},
+		{
+			name: "negative timeout on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							Timeout:          -time.Second,
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has negative timeout defined: -1s",
+		},
+		{
+			name: "negative timeout-grace on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							TimeoutGrace:     -time.Second,
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has negative timeout-grace defined: -1s",
+		},
+		{
+			name: "invalid limits on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							Limits:           config.Limits{CPUAffinity: config.CPUList{1, 1}},
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has invalid limits: CPU 1 is listed more than once",
+		},
+		{
+			name: "negative retries on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							Retries:          -1,
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has negative retries defined: -1",
+		},
+		{
+			name: "negative retry-backoff on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							RetryBackoff:     -time.Second,
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has negative retry-backoff defined: -1s",
+		},
+		{
+			name: "invalid retry pattern on tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"false": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "false",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"text/plain"},
+							RetryPatterns:    []string{"wine("},
+						},
+					},
+				},
+				Wrappers: validWrapper,
+			},
+			wantError: "tool: \"false\" has invalid retry-patterns defined: error parsing regexp",
+		},
+		{
+			name: "niceness out of range in limits",
+			config: config.Config{
+				DefaultPreset: "default",
+				Limits:        config.Limits{Nice: func() *int { nice := 20; return &nice }()},
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "limits: nice must be from -20 to 19: 20",
+		},
+		{
+			name: "timeout for an undefined tool in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", Timeouts: map[string]time.Duration{"obliterator": time.Minute}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has timeout defined for an undefined tool: obliterator",
+		},
+		{
+			name: "negative timeout in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", Timeouts: map[string]time.Duration{"cat": -time.Minute}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has negative timeout defined for \"cat\": -1m0s",
+		},
+		{
+			name: "min-quality out of range in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", MinQuality: 1.5},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has min-quality outside of 0 to 1: 1.5",
+		},
+		{
+			name: "empty metadata whitelist in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", Metadata: config.MetadataPolicy{Mode: config.MetadataWhitelist}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has an empty metadata whitelist",
+		},
+		{
+			name: "unknown metadata name in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {
+						Description: "",
+						Metadata:    config.MetadataPolicy{Mode: config.MetadataWhitelist, Whitelist: []string{"iCCP", "APP16"}},
+					},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has an unknown chunk or segment name in metadata: APP16",
+		},
+		{
+			name: "unknown selection strategy in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", Selection: config.Selection{Strategy: "fastest"}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has an invalid selection: unknown selection strategy \"fastest\"",
+		},
+		{
+			name: "unknown weight variable in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {
+						Description: "",
+						Selection: config.Selection{
+							Strategy: config.SelectByWeightedScore,
+							Weights:  map[string]float64{"size": 1, "speed": 0.5},
+						},
+					},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has an invalid selection: unknown variable \"speed\" in weights, expected one of: size, bytes, decode, decode_ms, time, quality, quality_loss",
+		},
+		{
+			name: "invalid selection expression in preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {
+						Description: "",
+						Selection:   config.Selection{Strategy: config.SelectByExpression, Expression: "size * (1 +"},
+					},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "preset: \"default\" has an invalid selection: invalid expression \"size * (1 +\": unexpected \"end of expression\" at position 12",
+		},
+		{
+			name: "unknown tool in tool-priority",
+			config: config.Config{
+				DefaultPreset: "default",
+				ToolPriority:  []string{"cat", "dog"},
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "tool-priority: included an undefined tool or chain: dog",
+		},
+		{
+			name: "duplicate tool in tool-priority",
+			config: config.Config{
+				DefaultPreset: "default",
+				ToolPriority:  []string{"cat", "cat"},
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+			},
+			wantError: "tool-priority: \"cat\" is included more than once",
+		},
+
+		{
+			name: "decoder with a reserved name",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Decoders: map[string]*config.DecoderConfig{
+					"go": {Command: "go", SupportedFormats: []string{"image/png"}},
+				},
+			},
+			wantError: "decoder: \"go\" is reserved for Go's built-in decoders",
+		},
+		{
+			name: "decoder with no command",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Decoders: map[string]*config.DecoderConfig{
+					"dwebp": {SupportedFormats: []string{"image/webp"}},
+				},
+			},
+			wantError: "decoder: \"dwebp\" has no command defined",
+		},
+		{
+			name: "decoder with no formats",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Decoders: map[string]*config.DecoderConfig{
+					"dwebp": {Command: "dwebp"},
+				},
+			},
+			wantError: "decoder: \"dwebp\" has no supported-formats defined",
+		},
+		{
+			name: "decoder with an unknown format",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Decoders: map[string]*config.DecoderConfig{
+					"dwebp": {Command: "dwebp", SupportedFormats: []string{"image/webpp"}},
+				},
+			},
+			wantError: "decoder: \"dwebp\" has unknown file format defined: image/webpp",
+		},
+
+		{
+			name: "chain with no tools",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains: map[string]*config.Chain{
+					"empty": {Tools: []string{}},
+				},
+			},
+			wantError: "chain: \"empty\" has no tools defined",
+		},
+		{
+			name: "chain with the same name as a tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains: map[string]*config.Chain{
+					"cat": {Tools: []string{"cat", "cat"}},
+				},
+			},
+			wantError: "chain: \"cat\" has the same name as a tool",
+		},
+		{
+			name: "chain with an undefined tool",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains: map[string]*config.Chain{
+					"cat-obliterator": {Tools: []string{"cat", "obliterator"}},
+				},
+			},
+			wantError: "chain: \"cat-obliterator\" included an undefined tool: obliterator",
+		},
+		{
+			name: "chain with a tool using an undefined preset",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets:  validPreset,
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains: map[string]*config.Chain{
+					"cat-fast": {Tools: []string{"cat", "cat@fast"}},
+				},
+			},
+			wantError: "chain: \"cat-fast\" included tool \"cat\" with undefined arguments for preset: fast",
+		},
+		{
+			name: "chain with no common file format",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: validPreset,
+				Tools: map[string]*config.ToolConfig{
+					"cat": validTool["cat"],
+					"tac": {
+						Arguments: map[string][]string{"default": {}},
+						CompressionTool: config.CompressionTool{
+							Command:          "tac",
+							Platform:         []string{"linux"},
+							SupportedFormats: []string{"application/json"},
+						},
+					},
+				},
+				Wrappers: validWrapper,
+				Chains: map[string]*config.Chain{
+					"cat-tac": {Tools: []string{"cat", "tac"}},
+				},
+			},
+			wantError: "chain: \"cat-tac\" has no file format supported by all of its tools",
+		},
+		{
+			name: "chain on default-tools with a tool that has undefined arguments",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": validPreset["default"],
+					"unknown": {Description: "", DefaultTools: map[string][]string{
+						"text/plain": {"cat-twice"},
+					}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains:   validChain,
+			},
+			wantError: "preset: \"unknown\" included chain \"cat-twice\" on default-tools, but its tool \"cat\" has undefined arguments for this preset",
+		},
+		{
+			name: "chain on default-tools with unsupported file format",
+			config: config.Config{
+				DefaultPreset: "default",
+
+				Presets: map[string]config.Preset{
+					"default": {Description: "", DefaultTools: map[string][]string{
+						"image/png": {"cat-twice"},
+					}},
+				},
+				Tools:    validTool,
+				Wrappers: validWrapper,
+				Chains:   validChain,
+			},
+			wantError: "preset: \"default\" included tool \"cat-twice\" on default-tools for image/png, which does not support this file format",
+		},
 
 		// full include testing is in
 		// TestConfig_ResolveIncludesFromPresetSuccess and
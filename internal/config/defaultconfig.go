@@ -2,6 +2,14 @@ package config
 
 func GetDefaultConfigStr() string {
 	return `default-preset: default-args
+jobs: 0 # Maximum amount of tool processes running at once across all tools and files. 0 = amount of logical CPUs
+# temp-dir: /dev/shm # Directory to create temp files in, each run uses its own directory inside it. Undefined = the system's temp directory
+# tool-priority: [oxipng, pngquant] # Breaks ties between results with the same score, first listed wins. Unlisted tools come after, alphabetically
+# limits: # Resource limits applied to every tool process, tools can override them with their own limits. Linux only
+#   nice: 10 # Niceness, from -20 (highest priority) to 19 (lowest)
+#   io-priority: best-effort:7 # IO scheduling class (idle, best-effort or realtime) and level, from 0 (highest) to 7 (lowest)
+#   memory-limit: 2GiB # Address space limit, tools failing to allocate under it are reported as exceeding it
+#   cpu-affinity: 0-3 # CPUs tools may run on
 
 mime-extensions:
   # For file formats that have multiple valid extensions (JPEG for example), you'll need to define them here so compacty can recognise them
@@ -46,6 +54,7 @@ presets:
   lossless-loweffort:
     description: Lossless compression with fast, low effort compression settings.
     shorthands: [lossless-low, ll-low, lossless-fast, ll-fast]
+    lossless: true
     default-tools:
       image/vnd.mozilla.apng: [oxipng, pingo]
       image/png: [oxipng, ect, pingo]
@@ -55,6 +64,10 @@ presets:
   lossless-higheffort:
     description: Lossless compression with slow, high effort compression settings.
     shorthands: [lossless-high, ll-high, lossless-slow, ll-slow]
+    lossless: true
+    # metadata: keep-color # Strips metadata from results except colour profiles. Also: strip-all, keep-all, or a list of chunks/segments to keep like [iCCP, eXIf, APP1]
+    # selection: decode-time # How the best result is picked, lowest score wins. Also: size (default), or a mapping like {strategy: weighted, weights: {size: 1, decode: 0.2}}
+    # min-saving: 1% # Keeps the original unless the best result saves at least this much. Also: bytes like 4KiB, or both like 4KiB,1%
     default-tools:
       image/vnd.mozilla.apng: [oxipng, pingo]
       image/png: [oxipng, ect, pingo, pngout]
@@ -64,15 +77,19 @@ presets:
   lossless-maxbrute:
     description: Lossless compression with maximum (including bruteforce-y) effort compression settings. Extremely slow!
     shorthands: []
+    lossless: true
     default-tools:
       image/vnd.mozilla.apng: [oxipng, pingo]
       image/png: [oxipng, ect, pngout, pingo]
       image/jpeg: [jpegoptim, jpegtran, ect, pingo]
       image/gif: [gifsicle]
+    # timeouts: # Stops a tool if it runs longer than this while using this preset, overriding the tool's timeout
+    #   pngout: 30m
 
   image-keepalpha:
     description: Lossless image compression with high effort compression settings and fully transparent pixels (a = 0) retained.
     shorthands: [image-alpha, img-alpha]
+    lossless: true
     default-tools:
       image/vnd.mozilla.apng: []
       image/png: [pingo, zopflipng]
@@ -84,8 +101,8 @@ presets:
     shorthands: [lossy-low, ly-low]
     default-tools:
       image/vnd.mozilla.apng: []
-      image/png: [pngquant]
-      image/jpeg: [jpegoptim, imagemagick]
+      image/png: [pngquant, pngquant-oxipng]
+      image/jpeg: [jpegoptim, imagemagick, jpegoptim-ect]
       image/gif: [gifsicle]
 
   lossy-subparquality:
@@ -94,8 +111,8 @@ presets:
     shorthands: [lossy-subpar, ly-subpar]
     default-tools:
       image/vnd.mozilla.apng: []
-      image/png: [pngquant]
-      image/jpeg: [jpegoptim, imagemagick]
+      image/png: [pngquant, pngquant-oxipng]
+      image/jpeg: [jpegoptim, imagemagick, jpegoptim-ect]
       image/gif: [gifsicle]
 
   lossy-midquality:
@@ -104,8 +121,8 @@ presets:
     shorthands: [lossy-mid, ly-mid]
     default-tools:
       image/vnd.mozilla.apng: []
-      image/png: [pngquant]
-      image/jpeg: [jpegoptim, imagemagick]
+      image/png: [pngquant, pngquant-oxipng]
+      image/jpeg: [jpegoptim, imagemagick, jpegoptim-ect]
       image/gif: [gifsicle]
 
   lossy-finequality:
@@ -114,18 +131,19 @@ presets:
     shorthands: [lossy-fine, ly-fine]
     default-tools:
       image/vnd.mozilla.apng: []
-      image/png: [pngquant]
-      image/jpeg: [jpegoptim, imagemagick]
+      image/png: [pngquant, pngquant-oxipng]
+      image/jpeg: [jpegoptim, imagemagick, jpegoptim-ect]
       image/gif: [gifsicle]
 
   lossy-highquality:
     # Images are typically compressed to at least 80 score in the SSIMULACRA2 metric
     description: Lossy compression that typically results in mildly degraded output.
     shorthands: [lossy-high, ly-high]
+    # min-quality: 0.97 # Disqualifies results with MS-SSIM below this, measured with compacty's built-in metric
     default-tools:
       image/vnd.mozilla.apng: [pingo]
-      image/png: [pingo, pngquant]
-      image/jpeg: [jpegoptim, imagemagick, pingo]
+      image/png: [pingo, pngquant, pngquant-oxipng]
+      image/jpeg: [jpegoptim, imagemagick, pingo, jpegoptim-ect]
       image/gif: [gifsicle]
 
   lossy-almostperfect:
@@ -135,9 +153,38 @@ presets:
     default-tools:
       image/vnd.mozilla.apng: [pingo]
       image/png: [pingo]
-      image/jpeg: [jpegoptim, imagemagick, pingo]
+      image/jpeg: [jpegoptim, imagemagick, pingo, jpegoptim-ect]
       image/gif: [gifsicle]
 
+chains:
+  # Chains run tools one after another, with each tool compressing the previous tool's output
+  # The final output competes against the results of single tools. Add a chain to a preset's default-tools to run it
+  # Use tool@preset to run a tool with the arguments of another preset, otherwise the running preset's arguments are used
+
+  pngquant-oxipng:
+    description: Lossy PNG compression with pngquant, then recompressed losslessly with oxipng.
+    tools: [pngquant, oxipng@lossless-higheffort]
+
+  jpegoptim-ect:
+    description: Lossy JPEG compression with jpegoptim, then recompressed losslessly with ect.
+    tools: [jpegoptim, ect@lossless-higheffort]
+
+# decoders:
+  # Decode time (--decode-time) is measured with Go's built-in decoders (named "go") and these decoders
+  # Each decoder runs once per measurement with the decoded file's path appended to its arguments, process startup included
+
+  # djpeg:
+  #   description: libjpeg-turbo's JPEG decoder. https://libjpeg-turbo.org/
+  #   command: djpeg
+  #   arguments: [-outfile, /dev/null]
+  #   supported-formats: [image/jpeg]
+
+  # dwebp:
+  #   description: libwebp's WebP decoder, only decodes without an output file. https://developers.google.com/speed/webp
+  #   command: dwebp
+  #   arguments: []
+  #   supported-formats: [image/webp]
+
 tools:
   # Define third-party compression tools here
 
@@ -187,6 +234,9 @@ tools:
     platform: [windows]
     supported-formats: [image/png, image/vnd.mozilla.apng, image/jpeg]
     output-mode: batch-overwrite
+    # retries: 2 # Runs through wine outside of Windows, which may fail to start intermittently
+    # retry-backoff: 2s # Delay before the first retry, doubled after every retry
+    # retry-patterns: ["wineserver", "could not load kernel32"] # Only retry failures printing these. retry-exit-codes works the same way
     arguments:
       default-args: []
       lossless-loweffort: ["-lossless", "-s1"]
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Resource limits applied to tool processes when they are launched. Only applied on Linux.
+type Limits struct {
+	Nice        *int       `yaml:"nice,omitempty"` // -20 (highest priority) to 19 (lowest). Nil = inherited
+	IOPriority  IOPriority `yaml:"io-priority,omitempty"`
+	MemoryLimit ByteSize   `yaml:"memory-limit,omitempty"` // Address space limit. 0 = no limit
+	CPUAffinity CPUList    `yaml:"cpu-affinity,omitempty"` // CPUs the tool may run on. Empty = any
+}
+
+// Returns the limits with every limit set in `other` replacing its own.
+func (l Limits) Override(other Limits) Limits {
+	if other.Nice != nil {
+		l.Nice = other.Nice
+	}
+
+	if !other.IOPriority.IsZero() {
+		l.IOPriority = other.IOPriority
+	}
+
+	if other.MemoryLimit > 0 {
+		l.MemoryLimit = other.MemoryLimit
+	}
+
+	if len(other.CPUAffinity) > 0 {
+		l.CPUAffinity = other.CPUAffinity
+	}
+
+	return l
+}
+
+// Returns an error describing the first invalid limit.
+func (l Limits) Validate() error {
+	if l.Nice != nil && (*l.Nice < -20 || *l.Nice > 19) {
+		return fmt.Errorf("nice must be from -20 to 19: %d", *l.Nice)
+	}
+
+	if l.MemoryLimit < 0 {
+		return fmt.Errorf("memory-limit cannot be negative: %d", l.MemoryLimit)
+	}
+
+	return l.CPUAffinity.Validate()
+}
+
+// Zero limits are omitted when encoding.
+func (l Limits) IsZero() bool {
+	return l.Nice == nil && l.IOPriority.IsZero() && l.MemoryLimit == 0 && len(l.CPUAffinity) == 0
+}
+
+type IOPriorityClass string
+
+const (
+	IOPriorityRealtime   IOPriorityClass = "realtime"
+	IOPriorityBestEffort IOPriorityClass = "best-effort"
+	IOPriorityIdle       IOPriorityClass = "idle"
+)
+
+// IO scheduling class and level (0 = highest, 7 = lowest) of a tool process. Idle has no levels.
+type IOPriority struct {
+	Class IOPriorityClass
+	Level int
+}
+
+// Parses an IO priority given as `idle`, `best-effort[:<level>]` or `realtime[:<level>]`, as used by
+// `--io-priority`. The level defaults to 4.
+func ParseIOPriority(value string) (priority IOPriority, err error) {
+	class, level, hasLevel := strings.Cut(value, ":")
+	priority = IOPriority{Class: IOPriorityClass(class), Level: 4}
+
+	switch priority.Class {
+	case IOPriorityIdle:
+		if hasLevel {
+			return IOPriority{}, fmt.Errorf("%s takes no level", class)
+		}
+
+		priority.Level = 0
+		return priority, nil
+	case IOPriorityBestEffort, IOPriorityRealtime:
+		if !hasLevel {
+			return priority, nil
+		}
+
+		priority.Level, err = strconv.Atoi(strings.TrimSpace(level))
+		if err != nil || priority.Level < 0 || priority.Level > 7 {
+			return IOPriority{}, fmt.Errorf("level of %s must be from 0 to 7: %q", class, level)
+		}
+
+		return priority, nil
+	}
+
+	return IOPriority{}, fmt.Errorf("unknown IO priority class %q, expected one of: idle, best-effort, realtime", class)
+}
+
+// Returns the priority as passed to `--io-priority`.
+func (p IOPriority) String() string {
+	if p.Class == IOPriorityIdle {
+		return string(p.Class)
+	}
+
+	return string(p.Class) + ":" + strconv.Itoa(p.Level)
+}
+
+func (p *IOPriority) UnmarshalYAML(value *yaml.Node) error {
+	var str string
+	if err := value.Decode(&str); err != nil {
+		return err
+	}
+
+	parsed, err := ParseIOPriority(str)
+	if err != nil {
+		return err
+	}
+
+	*p = parsed
+	return nil
+}
+
+func (p IOPriority) MarshalYAML() (any, error) {
+	return p.String(), nil
+}
+
+// Unset priorities are omitted when encoding.
+func (p IOPriority) IsZero() bool {
+	return p.Class == ""
+}
+
+// Amount of bytes, given with an optional unit (eg. `512MiB`, `2GB`).
+type ByteSize int64
+
+// Units of `byteUnits` along with gigabytes, longest suffixes first
+var byteSizeUnits = append([]byteUnit{{"GiB", 1 << 30}, {"GB", 1000 * 1000 * 1000}}, byteUnits...)
+
+// Parses an amount of bytes with an optional unit, as used by `--memory-limit`.
+func ParseByteSize(value string) (ByteSize, error) {
+	bytes, err := parseBytes(strings.TrimSpace(value), byteSizeUnits)
+	return ByteSize(bytes), err
+}
+
+// Returns the size in the largest binary unit that represents it exactly (eg. `300MiB`).
+func (bs ByteSize) String() string {
+	for _, unit := range []byteUnit{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if bs >= ByteSize(unit.bytes) && int64(bs)%unit.bytes == 0 {
+			return strconv.FormatInt(int64(bs)/unit.bytes, 10) + unit.suffix
+		}
+	}
+
+	return strconv.FormatInt(int64(bs), 10) + "B"
+}
+
+func (bs *ByteSize) UnmarshalYAML(value *yaml.Node) error {
+	var str string
+	if err := value.Decode(&str); err != nil {
+		return err
+	}
+
+	parsed, err := ParseByteSize(str)
+	if err != nil {
+		return err
+	}
+
+	*bs = parsed
+	return nil
+}
+
+func (bs ByteSize) MarshalYAML() (any, error) {
+	return bs.String(), nil
+}
+
+// Indexes of logical CPUs.
+type CPUList []int
+
+// Parses a list of CPUs given as indexes and ranges separated by commas (eg. `0-3,6`), as used by `--cpu-affinity`.
+func ParseCPUList(value string) (cpus CPUList, err error) {
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		first, last, isRange := strings.Cut(part, "-")
+		start, errStart := strconv.Atoi(strings.TrimSpace(first))
+		end, errEnd := start, error(nil)
+		if isRange {
+			end, errEnd = strconv.Atoi(strings.TrimSpace(last))
+		}
+
+		if errStart != nil || errEnd != nil || start < 0 || end < start {
+			return nil, fmt.Errorf("CPUs must be indexes or ranges separated by commas (eg. 0-3,6): %q", part)
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, cpus.Validate()
+}
+
+// Returns an error if a CPU is negative or listed more than once.
+func (cl CPUList) Validate() error {
+	for i, cpu := range cl {
+		if cpu < 0 {
+			return fmt.Errorf("CPU index cannot be negative: %d", cpu)
+		}
+
+		if slices.Index(cl, cpu) != i {
+			return fmt.Errorf("CPU %d is listed more than once", cpu)
+		}
+	}
+
+	return nil
+}
+
+// Accepts a list in the form of `--cpu-affinity`, such as `cpu-affinity: 0-3,6`, along with a sequence of indexes.
+func (cl *CPUList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.ScalarNode {
+		var cpus []int
+		if err := value.Decode(&cpus); err != nil {
+			return err
+		}
+
+		*cl = cpus
+		return nil
+	}
+
+	parsed, err := ParseCPUList(value.Value)
+	if err != nil {
+		return err
+	}
+
+	*cl = parsed
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type MetadataMode int
+
+// Policy on which metadata results must keep. Either a mode name, or a list of PNG chunk types (`iCCP`, `eXIf`,
+// `tEXt`...) and JPEG segments (`APP0` to `APP15`, `COM`) to keep.
+type MetadataPolicy struct {
+	Mode      MetadataMode
+	Whitelist []string // Only for `MetadataWhitelist`
+}
+
+const (
+	MetadataUnchanged MetadataMode = iota // Not enforced, results keep whatever the tools leave
+	MetadataStripAll                      // Strip all metadata
+	MetadataKeepColor                     // Keep metadata that changes how colours are rendered (ICC profiles, PNG colour chunks)
+	MetadataKeepAll                       // Keep all metadata of the original
+	MetadataWhitelist                     // Keep only the listed chunks and segments of the original
+)
+
+var metadataNamePattern = regexp.MustCompile(`^([A-Za-z]{4}|APP([0-9]|1[0-5])|COM)$`)
+
+// Returns `true` if `name` is a PNG chunk type or a JPEG segment name usable in a metadata whitelist. Returns
+// `false` otherwise.
+func IsValidMetadataName(name string) bool {
+	return metadataNamePattern.MatchString(name)
+}
+
+// Parses a policy given as a mode name or a comma separated whitelist, as used by `--metadata`.
+func ParseMetadataPolicy(value string) (policy MetadataPolicy, err error) {
+	mode, ok := metadataModeFromName(value)
+	if ok {
+		return MetadataPolicy{Mode: mode}, nil
+	}
+
+	whitelist := strings.Split(value, ",")
+	for _, name := range whitelist {
+		if !IsValidMetadataName(name) {
+			return MetadataPolicy{}, fmt.Errorf("unknown metadata policy or chunk/segment name %q", name)
+		}
+	}
+
+	return MetadataPolicy{Mode: MetadataWhitelist, Whitelist: whitelist}, nil
+}
+
+// Returns the policy as written in the config file.
+func (mp MetadataPolicy) String() string {
+	switch mp.Mode {
+	case MetadataStripAll:
+		return "strip-all"
+	case MetadataKeepColor:
+		return "keep-color"
+	case MetadataKeepAll:
+		return "keep-all"
+	case MetadataWhitelist:
+		return "[" + strings.Join(mp.Whitelist, ", ") + "]"
+	}
+
+	return "unchanged"
+}
+
+// Returns `true` if the policy is enforced. Returns `false` otherwise.
+func (mp MetadataPolicy) IsEnforced() bool {
+	return mp.Mode != MetadataUnchanged
+}
+
+func metadataModeFromName(name string) (mode MetadataMode, ok bool) {
+	switch strings.ToLower(name) {
+	case "strip-all":
+		return MetadataStripAll, true
+	case "keep-color", "keep-colour":
+		return MetadataKeepColor, true
+	case "keep-all":
+		return MetadataKeepAll, true
+	case "unchanged":
+		return MetadataUnchanged, true
+	}
+
+	return MetadataUnchanged, false
+}
+
+func (mp *MetadataPolicy) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.SequenceNode {
+		var whitelist []string
+		if err := value.Decode(&whitelist); err != nil {
+			return err
+		}
+
+		*mp = MetadataPolicy{Mode: MetadataWhitelist, Whitelist: whitelist}
+		return nil
+	}
+
+	var name string
+	if err := value.Decode(&name); err != nil {
+		return err
+	}
+
+	mode, ok := metadataModeFromName(name)
+	if !ok {
+		return fmt.Errorf("unknown metadata policy %q", name)
+	}
+
+	*mp = MetadataPolicy{Mode: mode}
+	return nil
+}
+
+func (mp MetadataPolicy) MarshalYAML() (any, error) {
+	if mp.Mode == MetadataWhitelist {
+		return mp.Whitelist, nil
+	}
+
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Value: mp.String(),
+		Tag:   "!!str",
+	}, nil
+}
+
+// Zero policies are omitted when encoding.
+func (mp MetadataPolicy) IsZero() bool {
+	return mp.Mode == MetadataUnchanged
+}
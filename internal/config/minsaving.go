@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Minimum amount a result must save over the original to replace it, in bytes and/or as a percentage of the
+// original's size. Both must be met if both are set.
+type MinSaving struct {
+	Bytes   int64
+	Percent float64
+}
+
+type byteUnit struct {
+	suffix string
+	bytes  int64
+}
+
+var byteUnits = []byteUnit{
+	// Longest suffixes first, so that `KiB` is not taken as `B`
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"B", 1},
+}
+
+// Parses a minimum saving given as bytes (`4096`, `4KB`, `4KiB`), a percentage (`0.5%`) or both separated by a
+// comma (`4KiB,0.5%`), as used by `--min-saving`.
+func ParseMinSaving(value string) (ms MinSaving, err error) {
+	isBytesSet, isPercentSet := false, false
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		if number, ok := strings.CutSuffix(part, "%"); ok {
+			if isPercentSet {
+				return MinSaving{}, fmt.Errorf("percentage is given more than once: %q", value)
+			}
+
+			ms.Percent, err = strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || ms.Percent < 0 || ms.Percent > 100 {
+				return MinSaving{}, fmt.Errorf("percentage must be a number from 0 to 100: %q", part)
+			}
+
+			isPercentSet = true
+			continue
+		}
+
+		if isBytesSet {
+			return MinSaving{}, fmt.Errorf("bytes are given more than once: %q", value)
+		}
+
+		ms.Bytes, err = parseBytes(part, byteUnits)
+		if err != nil {
+			return MinSaving{}, err
+		}
+
+		isBytesSet = true
+	}
+
+	return ms, nil
+}
+
+func parseBytes(value string, units []byteUnit) (bytes int64, err error) {
+	number, multiplier := value, int64(1)
+	for _, unit := range units {
+		if trimmed, ok := strings.CutSuffix(value, unit.suffix); ok {
+			number, multiplier = strings.TrimSpace(trimmed), unit.bytes
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(number, 64)
+	if err != nil || parsed < 0 {
+		suffixes := make([]string, len(units))
+		for i, unit := range units {
+			suffixes[i] = unit.suffix
+		}
+
+		slices.Sort(suffixes)
+		return 0, fmt.Errorf("bytes must be a positive number with an optional unit (%s): %q", strings.Join(suffixes, ", "), value)
+	}
+
+	return int64(parsed * float64(multiplier)), nil
+}
+
+// Returns `true` if going from `originalSize` to `finalSize` saves at least the minimum. Returns `false` otherwise.
+func (ms MinSaving) IsMet(originalSize, finalSize int64) bool {
+	saving := originalSize - finalSize
+	if saving <= 0 {
+		return false
+	}
+
+	if saving < ms.Bytes {
+		return false
+	}
+
+	return ms.Percent == 0 || float64(saving)*100 >= ms.Percent*float64(originalSize)
+}
+
+// Returns the minimum as passed to `--min-saving`.
+func (ms MinSaving) String() string {
+	parts := make([]string, 0, 2)
+	if ms.Bytes > 0 {
+		parts = append(parts, strconv.FormatInt(ms.Bytes, 10)+"B")
+	}
+
+	if ms.Percent > 0 {
+		parts = append(parts, strconv.FormatFloat(ms.Percent, 'f', -1, 64)+"%")
+	}
+
+	if len(parts) == 0 {
+		return "0B"
+	}
+
+	return strings.Join(parts, ",")
+}
+
+func (ms *MinSaving) UnmarshalYAML(value *yaml.Node) error {
+	var str string
+	if err := value.Decode(&str); err != nil {
+		return err
+	}
+
+	parsed, err := ParseMinSaving(str)
+	if err != nil {
+		return err
+	}
+
+	*ms = parsed
+	return nil
+}
+
+func (ms MinSaving) MarshalYAML() (any, error) {
+	return ms.String(), nil
+}
+
+// Zero minimums are omitted when encoding.
+func (ms MinSaving) IsZero() bool {
+	return ms.Bytes == 0 && ms.Percent == 0
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ArrayNone/compacty/internal/expression"
+	"go.yaml.in/yaml/v3"
+)
+
+type SelectionStrategy string
+
+// How the winning result of a file is picked. Every strategy gives each result (and the original) a score, the
+// lowest score wins. Ties are won by the original, then by the tool that comes first in `tool-priority`.
+type Selection struct {
+	Strategy   SelectionStrategy  `yaml:"strategy"`
+	Weights    map[string]float64 `yaml:"weights,omitempty"`    // Only for `SelectByWeightedScore`, variable -> weight
+	Expression string             `yaml:"expression,omitempty"` // Only for `SelectByExpression`
+}
+
+const (
+	SelectBySize          SelectionStrategy = "size"        // Smallest result. Default
+	SelectByDecodeTime    SelectionStrategy = "decode-time" // Fastest result to decode, the smallest of the ones not significantly slower
+	SelectByWeightedScore SelectionStrategy = "weighted"    // Lowest sum of variables multiplied by their weights
+	SelectByExpression    SelectionStrategy = "expression"  // Lowest result of an expression over the variables
+)
+
+// Expressions parsed by `Validate()`, source -> `*expression.Expression`
+var parsedExpressions sync.Map
+
+// Variables results are scored with, relative to the original where it makes sense
+var SelectionVariables = []string{
+	"size",         // Final size divided by the original's size
+	"bytes",        // Final size in bytes
+	"decode",       // Decode time divided by the original's decode time
+	"decode_ms",    // Decode time in milliseconds
+	"time",         // Time taken by the tool in seconds
+	"quality",      // Perceptual quality (MS-SSIM), 1 = no visible difference
+	"quality_loss", // 1 - quality
+}
+
+// Parses a selection given as `size`, `decode-time`, `weighted:<variable>=<weight>,...` or `expression:<expression>`,
+// as used by `--select`.
+func ParseSelection(value string) (selection Selection, err error) {
+	name, argument, hasArgument := strings.Cut(value, ":")
+	selection.Strategy = SelectionStrategy(name)
+
+	switch selection.Strategy {
+	case SelectBySize, SelectByDecodeTime:
+		if hasArgument {
+			return Selection{}, fmt.Errorf("%s takes no arguments", name)
+		}
+	case SelectByWeightedScore:
+		selection.Weights = make(map[string]float64)
+		for _, pair := range strings.Split(argument, ",") {
+			variable, weight, ok := strings.Cut(pair, "=")
+			if !ok {
+				return Selection{}, fmt.Errorf("weight %q is not in the form of <variable>=<weight>", pair)
+			}
+
+			selection.Weights[strings.TrimSpace(variable)], err = strconv.ParseFloat(strings.TrimSpace(weight), 64)
+			if err != nil {
+				return Selection{}, fmt.Errorf("weight of %s is not a number: %q", variable, weight)
+			}
+		}
+	case SelectByExpression:
+		selection.Expression = argument
+	default:
+		return Selection{}, fmt.Errorf("unknown selection strategy %q", name)
+	}
+
+	return selection, selection.Validate()
+}
+
+// Returns an error if the strategy is unknown or its weights or expression are invalid.
+func (s Selection) Validate() (err error) {
+	switch s.Strategy {
+	case "", SelectBySize, SelectByDecodeTime:
+		return nil
+	case SelectByWeightedScore:
+		if len(s.Weights) == 0 {
+			return fmt.Errorf("weighted selection has no weights")
+		}
+
+		for _, variable := range slices.Sorted(maps.Keys(s.Weights)) {
+			if !slices.Contains(SelectionVariables, variable) {
+				return fmt.Errorf("unknown variable %q in weights, expected one of: %s", variable, strings.Join(SelectionVariables, ", "))
+			}
+		}
+
+		return nil
+	case SelectByExpression:
+		_, err = parseSelectionExpression(s.Expression)
+		if err != nil {
+			return fmt.Errorf("invalid expression %q: %w", s.Expression, err)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown selection strategy %q", s.Strategy)
+}
+
+// Returns the expression of `SelectByExpression`. Must only be called on validated selections.
+func (s Selection) ParsedExpression() *expression.Expression {
+	parsed, _ := parseSelectionExpression(s.Expression)
+	return parsed
+}
+
+// Parses `source` once, later calls return the same expression. Selections are passed around by value, so their
+// parsed expressions are kept in `parsedExpressions` instead.
+func parseSelectionExpression(source string) (parsed *expression.Expression, err error) {
+	if cached, ok := parsedExpressions.Load(source); ok {
+		return cached.(*expression.Expression), nil
+	}
+
+	parsed, err = expression.Parse(source, SelectionVariables)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedExpressions.Store(source, parsed)
+	return parsed, nil
+}
+
+// Returns `true` if the strategy uses `variable`, and results can't be scored without it. Returns `false` otherwise.
+func (s Selection) Uses(variable string) bool {
+	switch s.Strategy {
+	case "", SelectBySize:
+		return variable == "size"
+	case SelectByDecodeTime:
+		return variable == "decode"
+	case SelectByWeightedScore:
+		return s.Weights[variable] != 0
+	case SelectByExpression:
+		parsed := s.ParsedExpression()
+		return parsed != nil && parsed.Uses(variable)
+	}
+
+	return false
+}
+
+// Returns the selection as passed to `--select`.
+func (s Selection) String() string {
+	switch s.Strategy {
+	case SelectByWeightedScore:
+		pairs := make([]string, 0, len(s.Weights))
+		for _, variable := range slices.Sorted(maps.Keys(s.Weights)) {
+			pairs = append(pairs, variable+"="+strconv.FormatFloat(s.Weights[variable], 'f', -1, 64))
+		}
+
+		return string(s.Strategy) + ":" + strings.Join(pairs, ",")
+	case SelectByExpression:
+		return string(s.Strategy) + ":" + s.Expression
+	case "":
+		return string(SelectBySize)
+	}
+
+	return string(s.Strategy)
+}
+
+// Returns `true` if results are picked by size alone. Returns `false` otherwise.
+func (s Selection) IsSize() bool {
+	return s.Strategy == "" || s.Strategy == SelectBySize
+}
+
+// Accepts a strategy name, such as `selection: decode-time`, along with the full mapping.
+func (s *Selection) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&s.Strategy)
+	}
+
+	type plainSelection Selection
+	return value.Decode((*plainSelection)(s))
+}
+
+// Zero selections are omitted when encoding.
+func (s Selection) IsZero() bool {
+	return s.Strategy == "" && len(s.Weights) == 0 && s.Expression == ""
+}
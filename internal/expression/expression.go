@@ -0,0 +1,362 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Arithmetic expression over named variables. Supports numbers, variables, `+ - * / ^`, parentheses, comparisons
+// (`< <= > >= == !=`, evaluating to 1 or 0) and the functions `min`, `max`, `abs`, `sqrt` and `log` (natural).
+type Expression struct {
+	Source string
+
+	evaluate  evaluator
+	variables []string // Variables used by the expression
+}
+
+type evaluator = func(variables map[string]float64) float64
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenIdentifier
+	tokenOperator
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	number   float64
+	position int
+}
+
+type parser struct {
+	tokens  []token
+	current int
+	allowed []string // Variables the expression may use
+	used    []string
+}
+
+var functions = map[string]struct {
+	minArgs, maxArgs int
+	apply            func(args []float64) float64
+}{
+	"min":  {1, -1, func(args []float64) float64 { return slices.Min(args) }},
+	"max":  {1, -1, func(args []float64) float64 { return slices.Max(args) }},
+	"abs":  {1, 1, func(args []float64) float64 { return math.Abs(args[0]) }},
+	"sqrt": {1, 1, func(args []float64) float64 { return math.Sqrt(args[0]) }},
+	"log":  {1, 1, func(args []float64) float64 { return math.Log(args[0]) }},
+}
+
+// Parses `source`, which may only use the variables in `allowed`. Returns an error describing the first problem.
+func Parse(source string, allowed []string) (e *Expression, err error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, allowed: allowed}
+
+	evaluate, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, fmt.Errorf("unexpected %q at position %d", next.text, next.position+1)
+	}
+
+	return &Expression{Source: source, evaluate: evaluate, variables: p.used}, nil
+}
+
+// Evaluates the expression. Variables missing from `variables` are 0.
+func (e *Expression) Evaluate(variables map[string]float64) float64 {
+	return e.evaluate(variables)
+}
+
+// Returns `true` if the expression uses `variable`. Returns `false` otherwise.
+func (e *Expression) Uses(variable string) bool {
+	return slices.Contains(e.variables, variable)
+}
+
+func tokenize(source string) (tokens []token, err error) {
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+
+			// Exponents, such as 1e-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+
+			text := string(runes[start:i])
+			number, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at position %d", text, start+1)
+			}
+
+			tokens = append(tokens, token{kind: tokenNumber, text: text, number: number, position: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+
+			tokens = append(tokens, token{kind: tokenIdentifier, text: string(runes[start:i]), position: start})
+		default:
+			text := string(r)
+			if i+1 < len(runes) && strings.Contains("<>=!", text) && runes[i+1] == '=' {
+				text += "="
+			}
+
+			if !slices.Contains([]string{"+", "-", "*", "/", "^", "(", ")", ",", "<", ">", "<=", ">=", "==", "!="}, text) {
+				return nil, fmt.Errorf("unexpected %q at position %d", text, i+1)
+			}
+
+			tokens = append(tokens, token{kind: tokenOperator, text: text, position: i})
+			i += len([]rune(text))
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, text: "end of expression", position: len(runes)}), nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.current]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.current]
+	if t.kind != tokenEnd {
+		p.current++
+	}
+
+	return t
+}
+
+func (p *parser) isOperator(operators ...string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && slices.Contains(operators, t.text)
+}
+
+func (p *parser) expect(operator string) error {
+	if !p.isOperator(operator) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at position %d, got %q", operator, t.position+1, t.text)
+	}
+
+	p.next()
+	return nil
+}
+
+func (p *parser) parseComparison() (evaluate evaluator, err error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isOperator("<", "<=", ">", ">=", "==", "!=") {
+		return left, nil
+	}
+
+	operator := p.next().text
+	right, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	compare := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+	}[operator]
+
+	return func(variables map[string]float64) float64 {
+		if compare(left(variables), right(variables)) {
+			return 1
+		}
+
+		return 0
+	}, nil
+}
+
+func (p *parser) parseAdditive() (evaluate evaluator, err error) {
+	evaluate, err = p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("+", "-") {
+		operator := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+
+		left := evaluate
+		if operator == "+" {
+			evaluate = func(variables map[string]float64) float64 { return left(variables) + right(variables) }
+		} else {
+			evaluate = func(variables map[string]float64) float64 { return left(variables) - right(variables) }
+		}
+	}
+
+	return evaluate, nil
+}
+
+func (p *parser) parseMultiplicative() (evaluate evaluator, err error) {
+	evaluate, err = p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator("*", "/") {
+		operator := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left := evaluate
+		if operator == "*" {
+			evaluate = func(variables map[string]float64) float64 { return left(variables) * right(variables) }
+		} else {
+			evaluate = func(variables map[string]float64) float64 { return left(variables) / right(variables) }
+		}
+	}
+
+	return evaluate, nil
+}
+
+func (p *parser) parseUnary() (evaluate evaluator, err error) {
+	if p.isOperator("-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(variables map[string]float64) float64 { return -operand(variables) }, nil
+	}
+
+	return p.parsePower()
+}
+
+// Right associative, 2^3^2 = 2^9
+func (p *parser) parsePower() (evaluate evaluator, err error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.isOperator("^") {
+		return base, nil
+	}
+
+	p.next()
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(variables map[string]float64) float64 {
+		return math.Pow(base(variables), exponent(variables))
+	}, nil
+}
+
+func (p *parser) parsePrimary() (evaluate evaluator, err error) {
+	t := p.next()
+
+	switch {
+	case t.kind == tokenNumber:
+		number := t.number
+		return func(map[string]float64) float64 { return number }, nil
+	case t.kind == tokenIdentifier && p.isOperator("("):
+		return p.parseCall(t)
+	case t.kind == tokenIdentifier:
+		if !slices.Contains(p.allowed, t.text) {
+			return nil, fmt.Errorf("unknown variable %q at position %d, expected one of: %s", t.text, t.position+1, strings.Join(p.allowed, ", "))
+		}
+
+		if !slices.Contains(p.used, t.text) {
+			p.used = append(p.used, t.text)
+		}
+
+		name := t.text
+		return func(variables map[string]float64) float64 { return variables[name] }, nil
+	case t.kind == tokenOperator && t.text == "(":
+		evaluate, err = p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+
+		return evaluate, p.expect(")")
+	}
+
+	return nil, fmt.Errorf("unexpected %q at position %d", t.text, t.position+1)
+}
+
+func (p *parser) parseCall(name token) (evaluate evaluator, err error) {
+	function, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at position %d", name.text, name.position+1)
+	}
+
+	p.next() // (
+
+	var args []evaluator
+	for !p.isOperator(")") {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+
+		arg, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+	}
+
+	p.next() // )
+
+	if len(args) < function.minArgs || (function.maxArgs >= 0 && len(args) > function.maxArgs) {
+		return nil, fmt.Errorf("wrong amount of arguments for %s at position %d: %d", name.text, name.position+1, len(args))
+	}
+
+	return func(variables map[string]float64) float64 {
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			values[i] = arg(variables)
+		}
+
+		return function.apply(values)
+	}, nil
+}
@@ -0,0 +1,114 @@
+package expression_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ArrayNone/compacty/internal/expression"
+)
+
+var allowed = []string{"size", "decode", "quality"}
+
+func TestExpression_Evaluate(t *testing.T) {
+	variables := map[string]float64{"size": 0.5, "decode": 2, "quality": 0.98}
+
+	tests := []struct {
+		source string
+		want   float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"24 / 4 / 2", 3},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 * 3 ^ 2", 18},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"--3", 3},
+		{"4 - -3", 7},
+		{"-size * 2", -1},
+		{"size + decode * 2", 4.5},
+		{"(size + decode) * 2", 5},
+		{"1e-3 * 1000", 1},
+		{"size < decode", 1},
+		{"size >= decode", 0},
+		{"1 + 1 == 2", 1},
+		{"size != 0.5", 0},
+		{"min(decode, size, 3)", 0.5},
+		{"max(size, decode)", 2},
+		{"abs(size - decode)", 1.5},
+		{"sqrt(decode * 8)", 4},
+		{"log(1)", 0},
+		{"size + quality * 0", 0.5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			e, err := expression.Parse(test.source, allowed)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if got := e.Evaluate(variables); math.Abs(got-test.want) > 1e-12 {
+				t.Errorf("Evaluate() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExpression_EvaluateMissingVariable(t *testing.T) {
+	e, err := expression.Parse("size + decode", allowed)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if got := e.Evaluate(map[string]float64{"size": 3}); got != 3 {
+		t.Errorf("Evaluate() = %v, want 3", got)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		source  string
+		wantErr string
+	}{
+		{"", `unexpected "end of expression" at position 1`},
+		{"bytes * 2", `unknown variable "bytes" at position 1`},
+		{"size + Size", `unknown variable "Size" at position 8`},
+		{"1 +", `unexpected "end of expression" at position 4`},
+		{"(1 + 2", `expected ")" at position 7`},
+		{"1 + 2)", `unexpected ")" at position 6`},
+		{"1 2", `unexpected "2" at position 3`},
+		{"size % 2", `unexpected "%" at position 6`},
+		{"1.2.3", `invalid number "1.2.3" at position 1`},
+		{"size = 1", `unexpected "=" at position 6`},
+		{"floor(size)", `unknown function "floor" at position 1`},
+		{"abs(size, decode)", "wrong amount of arguments for abs"},
+		{"min()", "wrong amount of arguments for min"},
+		{"max(size decode)", `expected "," at position 10`},
+		{"size < decode < 1", `unexpected "<" at position 15`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := expression.Parse(test.source, allowed)
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Parse() error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpression_Uses(t *testing.T) {
+	e, err := expression.Parse("size * 2 + max(decode, 1)", allowed)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	for variable, want := range map[string]bool{"size": true, "decode": true, "quality": false} {
+		if got := e.Uses(variable); got != want {
+			t.Errorf("Uses(%q) = %v, want %v", variable, got, want)
+		}
+	}
+}
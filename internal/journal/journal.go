@@ -0,0 +1,536 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/cache"
+)
+
+// Records the files overwritten by each run along with a backup of their originals, so that a run can be undone.
+type Journal struct {
+	Dir string
+}
+
+// Files overwritten by a single run. The run is only written to disk once a file is backed up.
+type Run struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"started-at"`
+	Entries   []Entry   `json:"entries"`
+
+	dir   string
+	mutex sync.Mutex
+
+	pendingBackups map[string]int // Internal backups of entries that are not recorded yet, see `Discard()`
+}
+
+type Entry struct {
+	Path string `json:"path"` // Absolute path of the overwritten file
+
+	OriginalHash    string    `json:"original-hash"`
+	OriginalSize    int64     `json:"original-size"`
+	OriginalModTime time.Time `json:"original-mod-time"`
+
+	// Copy of the original, either inside the run's directory or next to the file if a backup suffix is used
+	Backup           string `json:"backup"`
+	IsBackupExternal bool   `json:"is-backup-external,omitempty"` // Next to the file, removed once restored
+
+	ResultHash string    `json:"result-hash"`
+	Tool       string    `json:"tool"`
+	Time       time.Time `json:"time"`
+}
+
+const (
+	runFile      = "run.json"
+	originalsDir = "originals"
+)
+
+// Directories without a run file may belong to a run that is backing up its first file, these are only removed once
+// they were not modified for this long
+const unrecordedRunAge = 24 * time.Hour
+
+const (
+	rwxr_xr_x = 0755
+	rw_r__r__ = 0644
+)
+
+var (
+	ErrNoRuns       = errors.New("no runs are recorded")
+	ErrUnknownRun   = errors.New("run does not exist")
+	ErrModified     = errors.New("file was modified after it was overwritten")
+	ErrBackupLost   = errors.New("backup of the original is missing or modified")
+	ErrBackupExists = errors.New("backup file already exists")
+)
+
+// Returns the default journal directory located at `os.UserCacheDir()`.
+func DefaultDir() (dir string, err error) {
+	userCache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userCache, "compacty", "journal"), nil
+}
+
+// Opens the journal at `dir`, creating it if it does not exist. Can return an error.
+func Open(dir string) (j *Journal, err error) {
+	err = os.MkdirAll(dir, rwxr_xr_x)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{Dir: dir}, nil
+}
+
+// Starts a new run. Nothing is written until a file is backed up.
+func (j *Journal) NewRun() *Run {
+	now := time.Now()
+	id := fmt.Sprintf("%s-%d", now.Format("20060102-150405"), os.Getpid())
+
+	return &Run{
+		ID:        id,
+		StartedAt: now,
+		Entries:   []Entry{},
+
+		dir: filepath.Join(j.Dir, id),
+	}
+}
+
+// Returns the recorded runs, oldest first.
+func (j *Journal) Runs() (runs []*Run, err error) {
+	dirEntries, err := os.ReadDir(j.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() {
+			continue
+		}
+
+		run, err := j.loadRun(dirEntry.Name())
+		if err != nil {
+			continue // Being written by another run or not a run
+		}
+
+		runs = append(runs, run)
+	}
+
+	slices.SortFunc(runs, func(a, b *Run) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+
+	return runs, nil
+}
+
+// Returns the run with `id`, or the latest run if `id` is empty. Returns `ErrNoRuns` or `ErrUnknownRun` if there is
+// no such run.
+func (j *Journal) Run(id string) (run *Run, err error) {
+	if id != "" {
+		run, err = j.loadRun(id)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrUnknownRun
+		}
+
+		return run, err
+	}
+
+	runs, err := j.Runs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(runs) == 0 {
+		return nil, ErrNoRuns
+	}
+
+	return runs[len(runs)-1], nil
+}
+
+// Removes the runs started more than `maxAge` ago and every run but the newest `maxRuns` (unlimited if 0), along with
+// the originals they back up. Backups next to the files are left to the user. Directories that hold no run, such as
+// those of interrupted runs, are removed after `unrecordedRunAge`. Returns the amount of removed runs and the bytes
+// freed, both counting as much as was removed before an error.
+func (j *Journal) Prune(maxAge time.Duration, maxRuns int) (removedRuns int, freedBytes int64, err error) {
+	dirEntries, err := os.ReadDir(j.Dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	runs, err := j.Runs()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	isRecorded := make(map[string]bool, len(runs))
+	for i, run := range runs {
+		isRecorded[filepath.Base(run.dir)] = true
+
+		isExcess := maxRuns > 0 && len(runs)-i > maxRuns
+		if !isExcess && !run.StartedAt.Before(cutoff) {
+			continue
+		}
+
+		size, err := removeDir(run.dir)
+		freedBytes += size
+		if err != nil {
+			return removedRuns, freedBytes, err
+		}
+
+		removedRuns++
+	}
+
+	unrecordedCutoff := time.Now().Add(-unrecordedRunAge)
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.IsDir() || isRecorded[dirEntry.Name()] {
+			continue
+		}
+
+		dir := filepath.Join(j.Dir, dirEntry.Name())
+		modTime, err := lastModified(dir)
+		if err != nil {
+			return removedRuns, freedBytes, err
+		}
+
+		if modTime.After(unrecordedCutoff) {
+			continue
+		}
+
+		size, err := removeDir(dir)
+		freedBytes += size
+		if err != nil {
+			return removedRuns, freedBytes, err
+		}
+	}
+
+	return removedRuns, freedBytes, nil
+}
+
+// Returns the latest modification time of `dir` and everything inside it.
+func lastModified(dir string) (modTime time.Time, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+
+		return nil
+	})
+
+	return modTime, err
+}
+
+// Removes `dir` with everything inside it. Returns the size of the removed files.
+func removeDir(dir string) (size int64, err error) {
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err == nil {
+			size += info.Size()
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return size, os.RemoveAll(dir)
+}
+
+func (j *Journal) loadRun(id string) (run *Run, err error) {
+	// IDs come from the user, keep them inside the journal
+	if !filepath.IsLocal(id) || strings.ContainsAny(id, `/\`) {
+		return nil, fs.ErrNotExist
+	}
+
+	dir := filepath.Join(j.Dir, id)
+	data, err := os.ReadFile(filepath.Join(dir, runFile))
+	if err != nil {
+		return nil, err
+	}
+
+	run = &Run{dir: dir}
+	err = json.Unmarshal(data, run)
+	if err != nil {
+		return nil, err
+	}
+
+	return run, nil
+}
+
+// Copies the file at `path` before it's overwritten. If `backupSuffix` is not empty, the copy is placed next to the
+// file with the suffix appended to its name, otherwise it's stored inside the run. Returns the entry to pass to
+// `Record()` once the file is overwritten.
+func (r *Run) Backup(path, backupSuffix string) (entry Entry, err error) {
+	absolutePath, err := filepath.Abs(path)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	info, err := os.Stat(absolutePath)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	hash, err := cache.HashFile(absolutePath)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	entry = Entry{
+		Path: absolutePath,
+
+		OriginalHash:    hash,
+		OriginalSize:    info.Size(),
+		OriginalModTime: info.ModTime(),
+	}
+
+	if backupSuffix != "" {
+		entry.Backup = absolutePath + backupSuffix
+		entry.IsBackupExternal = true
+
+		// Never replace a file the user may rely on
+		if _, err := os.Lstat(entry.Backup); err == nil {
+			return Entry{}, fmt.Errorf("%w: %s", ErrBackupExists, entry.Backup)
+		}
+	} else {
+		backup := filepath.Join(r.dir, originalsDir, hash)
+		entry.Backup = backup
+		r.addPendingBackup(backup)
+
+		if _, err := os.Stat(backup); err == nil {
+			return entry, nil // Same content is already backed up
+		}
+
+		defer func() {
+			if err != nil {
+				r.mutex.Lock()
+				r.removePendingBackup(backup)
+				r.mutex.Unlock()
+			}
+		}()
+	}
+
+	err = os.MkdirAll(filepath.Dir(entry.Backup), rwxr_xr_x)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	err = copyFile(absolutePath, entry.Backup, info.Mode().Perm())
+	if err != nil {
+		_ = os.Remove(entry.Backup)
+		return Entry{}, err
+	}
+
+	return entry, nil
+}
+
+// Records that the file of `entry` is overwritten with the result of `tool`, and saves the run. Safe to call
+// concurrently.
+func (r *Run) Record(entry Entry, tool string) (err error) {
+	entry.Tool = tool
+	entry.Time = time.Now()
+
+	entry.ResultHash, err = cache.HashFile(entry.Path)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !entry.IsBackupExternal {
+		r.removePendingBackup(entry.Backup)
+	}
+
+	r.Entries = append(r.Entries, entry)
+	return r.save()
+}
+
+// Removes the backup of `entry` if its file ends up not being overwritten. Backups inside the run are shared by files
+// with the same content, these are kept while other entries use them. Safe to call concurrently.
+func (r *Run) Discard(entry Entry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !entry.IsBackupExternal {
+		r.removePendingBackup(entry.Backup)
+
+		isUsed := r.pendingBackups[entry.Backup] > 0 || slices.ContainsFunc(r.Entries, func(recorded Entry) bool {
+			return recorded.Backup == entry.Backup
+		})
+
+		if isUsed {
+			return nil
+		}
+	}
+
+	return os.Remove(entry.Backup)
+}
+
+func (r *Run) addPendingBackup(path string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.pendingBackups == nil {
+		r.pendingBackups = make(map[string]int)
+	}
+
+	r.pendingBackups[path]++
+}
+
+// Must be called with `mutex` locked.
+func (r *Run) removePendingBackup(path string) {
+	if r.pendingBackups[path] > 0 {
+		r.pendingBackups[path]--
+	}
+}
+
+// Restores the originals of every file in the run, newest first. Files modified after the run are refused with
+// `ErrModified`. Restored entries are removed from the run, and the run is removed once every entry is restored.
+// Returns the amount of restored files and an error for each file that is not restored.
+func (r *Run) Undo() (restored int, errs []error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	remaining := make([]Entry, 0)
+	for i := len(r.Entries) - 1; i >= 0; i-- {
+		entry := r.Entries[i]
+
+		err := restoreEntry(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Path, err))
+			remaining = append(remaining, entry)
+			continue
+		}
+
+		restored++
+	}
+
+	slices.Reverse(remaining)
+	r.Entries = remaining
+
+	if len(remaining) == 0 {
+		err := os.RemoveAll(r.dir)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		return restored, errs
+	}
+
+	err := r.save()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return restored, errs
+}
+
+func restoreEntry(entry Entry) (err error) {
+	currentHash, err := cache.HashFile(entry.Path)
+	if err != nil {
+		return err
+	}
+
+	if currentHash != entry.ResultHash {
+		return ErrModified
+	}
+
+	backupHash, err := cache.HashFile(entry.Backup)
+	if err != nil || backupHash != entry.OriginalHash {
+		return ErrBackupLost
+	}
+
+	// Written in place, so the file keeps its mode, owner and extended attributes
+	err = copyFile(entry.Backup, entry.Path, rw_r__r__)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chtimes(entry.Path, time.Time{}, entry.OriginalModTime)
+	if err != nil {
+		return err
+	}
+
+	if entry.IsBackupExternal {
+		return os.Remove(entry.Backup)
+	}
+
+	return nil
+}
+
+func (r *Run) save() (err error) {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(r.dir, rwxr_xr_x)
+	if err != nil {
+		return err
+	}
+
+	// Written to a temporary file first, so that a crash never leaves a partially written run
+	file, err := os.CreateTemp(r.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(r.dir, runFile))
+}
+
+// Copies `pathSrc` to `pathDest`. `pathDest` is created with `perm` if it does not exist, existing files are
+// truncated and keep their mode.
+func copyFile(pathSrc, pathDest string, perm fs.FileMode) (err error) {
+	source, err := os.Open(pathSrc)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := os.OpenFile(pathDest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destination, source)
+	if closeErr := destination.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,451 @@
+package journal_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/journal"
+)
+
+const (
+	originalData = "original contents"
+	resultData   = "result"
+)
+
+// Returns a journal and a file holding `originalData`, both in a temporary directory.
+func setup(t *testing.T) (j *journal.Journal, path string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	j, err := journal.Open(filepath.Join(dir, "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path = filepath.Join(dir, "image.png")
+	writeFile(t, path, originalData)
+
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	return j, path
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+// Backs up the file at `path`, overwrites it with `resultData` and records it.
+func overwrite(t *testing.T, run *journal.Run, path, backupSuffix string) journal.Entry {
+	t.Helper()
+
+	entry, err := run.Backup(path, backupSuffix)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+
+	writeFile(t, path, resultData)
+	if err := run.Record(entry, "tool"); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	return entry
+}
+
+func TestRun_Undo(t *testing.T) {
+	tests := []struct {
+		name         string
+		backupSuffix string
+	}{
+		{name: "internal backup"},
+		{name: "external backup", backupSuffix: ".bak"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, path := setup(t)
+			originalInfo, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			entry := overwrite(t, j.NewRun(), path, test.backupSuffix)
+			if entry.IsBackupExternal != (test.backupSuffix != "") {
+				t.Errorf("IsBackupExternal = %v, want %v", entry.IsBackupExternal, test.backupSuffix != "")
+			}
+
+			if test.backupSuffix != "" && entry.Backup != path+test.backupSuffix {
+				t.Errorf("Backup = %q, want %q", entry.Backup, path+test.backupSuffix)
+			}
+
+			// Loaded back from disk, as `--undo` does
+			run, err := j.Run("")
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if len(run.Entries) != 1 || run.Entries[0].Path != path || run.Entries[0].Tool != "tool" {
+				t.Fatalf("Run().Entries = %+v, want the recorded entry", run.Entries)
+			}
+
+			restored, errs := run.Undo()
+			if restored != 1 || len(errs) > 0 {
+				t.Fatalf("Undo() = %d, %v, want 1, no errors", restored, errs)
+			}
+
+			if got := readFile(t, path); got != originalData {
+				t.Errorf("restored contents = %q, want %q", got, originalData)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil || !info.ModTime().Equal(originalInfo.ModTime()) {
+				t.Errorf("restored modification time = %v, want %v", info.ModTime(), originalInfo.ModTime())
+			}
+
+			if _, err := os.Stat(entry.Backup); !errors.Is(err, os.ErrNotExist) && test.backupSuffix != "" {
+				t.Errorf("external backup is kept after restoring: %v", err)
+			}
+
+			// Fully undone runs are removed
+			if _, err := j.Run(run.ID); !errors.Is(err, journal.ErrUnknownRun) {
+				t.Errorf("Run(%q) error = %v, want %v", run.ID, err, journal.ErrUnknownRun)
+			}
+		})
+	}
+}
+
+func TestRun_UndoRefused(t *testing.T) {
+	tests := []struct {
+		name         string
+		backupSuffix string
+		tamper       func(t *testing.T, path string, entry journal.Entry)
+		wantErr      error
+	}{
+		{
+			name:    "file modified after the run",
+			tamper:  func(t *testing.T, path string, _ journal.Entry) { writeFile(t, path, "edited by the user") },
+			wantErr: journal.ErrModified,
+		},
+		{
+			name: "internal backup removed",
+			tamper: func(t *testing.T, _ string, entry journal.Entry) {
+				if err := os.Remove(entry.Backup); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: journal.ErrBackupLost,
+		},
+		{
+			name:         "external backup modified",
+			backupSuffix: ".bak",
+			tamper:       func(t *testing.T, _ string, entry journal.Entry) { writeFile(t, entry.Backup, "something else") },
+			wantErr:      journal.ErrBackupLost,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, path := setup(t)
+
+			run := j.NewRun()
+			entry := overwrite(t, run, path, test.backupSuffix)
+			test.tamper(t, path, entry)
+
+			restored, errs := run.Undo()
+			if restored != 0 || len(errs) != 1 || !errors.Is(errs[0], test.wantErr) {
+				t.Fatalf("Undo() = %d, %v, want 0, %v", restored, errs, test.wantErr)
+			}
+
+			if got := readFile(t, path); got == originalData {
+				t.Errorf("file is restored despite %v", test.wantErr)
+			}
+
+			// Refused entries stay in the run, so they can be retried
+			loaded, err := j.Run(run.ID)
+			if err != nil || len(loaded.Entries) != 1 {
+				t.Errorf("Run(%q) = %+v, %v, want the refused entry kept", run.ID, loaded, err)
+			}
+		})
+	}
+}
+
+func TestRun_BackupExists(t *testing.T) {
+	j, path := setup(t)
+	writeFile(t, path+".bak", "kept by the user")
+
+	_, err := j.NewRun().Backup(path, ".bak")
+	if !errors.Is(err, journal.ErrBackupExists) {
+		t.Fatalf("Backup() error = %v, want %v", err, journal.ErrBackupExists)
+	}
+
+	if got := readFile(t, path+".bak"); got != "kept by the user" {
+		t.Errorf("existing backup is overwritten with %q", got)
+	}
+}
+
+func TestRun_UndoNewestFirst(t *testing.T) {
+	j, path := setup(t)
+
+	// Overwritten twice in the same run, the first backup holds the original
+	run := j.NewRun()
+	overwrite(t, run, path, "")
+
+	entry, err := run.Backup(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, path, "second result")
+	if err := run.Record(entry, "other"); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, errs := run.Undo()
+	if restored != 2 || len(errs) > 0 {
+		t.Fatalf("Undo() = %d, %v, want 2, no errors", restored, errs)
+	}
+
+	if got := readFile(t, path); got != originalData {
+		t.Errorf("restored contents = %q, want %q", got, originalData)
+	}
+}
+
+func TestJournal_Run(t *testing.T) {
+	j, path := setup(t)
+
+	if _, err := j.Run(""); !errors.Is(err, journal.ErrNoRuns) {
+		t.Errorf("Run() of an empty journal error = %v, want %v", err, journal.ErrNoRuns)
+	}
+
+	run := j.NewRun()
+	overwrite(t, run, path, "")
+
+	// A valid run outside of the journal, which IDs must not reach
+	outside := filepath.Dir(j.Dir)
+	runData, err := os.ReadFile(filepath.Join(j.Dir, run.ID, "run.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(outside, "run.json"), string(runData))
+	if err := os.MkdirAll(filepath.Join(outside, "escaped"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(outside, "escaped", "run.json"), string(runData))
+
+	tests := []struct {
+		id      string
+		wantErr error
+	}{
+		{id: run.ID},
+		{id: "20000101-000000-1", wantErr: journal.ErrUnknownRun},
+		{id: "..", wantErr: journal.ErrUnknownRun},
+		{id: "../escaped", wantErr: journal.ErrUnknownRun},
+		{id: run.ID + "/../../escaped", wantErr: journal.ErrUnknownRun},
+		{id: `..\escaped`, wantErr: journal.ErrUnknownRun},
+		{id: filepath.Join(outside, "escaped"), wantErr: journal.ErrUnknownRun},
+	}
+
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			loaded, err := j.Run(test.id)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("Run(%q) error = %v, want %v", test.id, err, test.wantErr)
+			}
+
+			if test.wantErr == nil && loaded.ID != run.ID {
+				t.Errorf("Run(%q).ID = %q, want %q", test.id, loaded.ID, run.ID)
+			}
+		})
+	}
+}
+
+// Writes a run with `id` that started `age` ago and backs up `backupData`, as recorded by an earlier process.
+func writeRun(t *testing.T, j *journal.Journal, id string, age time.Duration, backupData string) {
+	t.Helper()
+
+	dir := filepath.Join(j.Dir, id)
+	if err := os.MkdirAll(filepath.Join(dir, "originals"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "originals", "hash"), backupData)
+	writeFile(t, filepath.Join(dir, "run.json"), `{"id": "`+id+`", "started-at": "`+time.Now().Add(-age).Format(time.RFC3339Nano)+`"}`)
+}
+
+func dirSize(t *testing.T, dir string) (size int64) {
+	t.Helper()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err == nil {
+			size += info.Size()
+		}
+
+		return err
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return size
+}
+
+func TestJournal_Prune(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAge      time.Duration
+		maxRuns     int
+		wantRemoved []string
+	}{
+		{name: "nothing to prune", maxAge: 30 * 24 * time.Hour, wantRemoved: []string{"unrecorded-old"}},
+		{name: "by age", maxAge: 36 * time.Hour, wantRemoved: []string{"old", "unrecorded-old"}},
+		{name: "by count", maxAge: 30 * 24 * time.Hour, maxRuns: 1, wantRemoved: []string{"old", "recent", "unrecorded-old"}},
+		{name: "by both", maxAge: time.Minute, maxRuns: 2, wantRemoved: []string{"old", "recent", "unrecorded-old"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			j, path := setup(t)
+
+			writeRun(t, j, "old", 48*time.Hour, "old")
+			writeRun(t, j, "recent", time.Hour, "re")
+
+			// The run of this process, which is kept as the newest
+			run := j.NewRun()
+			overwrite(t, run, path, "")
+
+			// Interrupted before recording anything, or still backing up its first file
+			for _, dir := range []string{"unrecorded-old", "unrecorded-new"} {
+				if err := os.MkdirAll(filepath.Join(j.Dir, dir, "originals"), 0755); err != nil {
+					t.Fatal(err)
+				}
+
+				writeFile(t, filepath.Join(j.Dir, dir, "originals", "hash"), "unrecorded")
+			}
+
+			old := time.Now().Add(-48 * time.Hour)
+			for _, path := range []string{"unrecorded-old", "unrecorded-old/originals", "unrecorded-old/originals/hash"} {
+				if err := os.Chtimes(filepath.Join(j.Dir, path), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var wantFreed int64
+			for _, dir := range test.wantRemoved {
+				wantFreed += dirSize(t, filepath.Join(j.Dir, dir))
+			}
+
+			wantRuns := len(test.wantRemoved) - 1 // Unrecorded directories are not runs
+			removed, freed, err := j.Prune(test.maxAge, test.maxRuns)
+			if err != nil || removed != wantRuns || freed != wantFreed {
+				t.Errorf("Prune() = %d, %d, %v, want %d, %d, no error", removed, freed, err, wantRuns, wantFreed)
+			}
+
+			for _, dir := range []string{"old", "recent", run.ID, "unrecorded-old", "unrecorded-new"} {
+				_, err := os.Stat(filepath.Join(j.Dir, dir))
+				if isRemoved := errors.Is(err, os.ErrNotExist); isRemoved != slices.Contains(test.wantRemoved, dir) {
+					t.Errorf("%s is removed = %v, want %v", dir, isRemoved, !isRemoved)
+				}
+			}
+
+			if _, err := j.Run(run.ID); err != nil {
+				t.Errorf("Run() of the newest run error = %v", err)
+			}
+		})
+	}
+}
+
+func TestRun_Discard(t *testing.T) {
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	t.Run("unused backups", func(t *testing.T) {
+		for _, backupSuffix := range []string{"", ".orig"} {
+			j, path := setup(t)
+			run := j.NewRun()
+
+			entry, err := run.Backup(path, backupSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := run.Discard(entry); err != nil || exists(entry.Backup) {
+				t.Errorf("Discard() error = %v, backup %s is kept = %v, want removed", err, entry.Backup, exists(entry.Backup))
+			}
+		}
+	})
+
+	t.Run("backup shared with a recorded file", func(t *testing.T) {
+		j, path := setup(t)
+		other := filepath.Join(filepath.Dir(path), "copy.png")
+		writeFile(t, other, originalData)
+
+		run := j.NewRun()
+		entry, err := run.Backup(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorded := overwrite(t, run, other, "")
+		if err := run.Discard(entry); err != nil || !exists(recorded.Backup) {
+			t.Fatalf("Discard() error = %v, removed the backup of a recorded file", err)
+		}
+
+		if restored, errs := run.Undo(); restored != 1 || len(errs) > 0 {
+			t.Errorf("Undo() = %d, %v, want 1, no errors", restored, errs)
+		}
+	})
+
+	t.Run("backup shared with a pending file", func(t *testing.T) {
+		j, path := setup(t)
+		run := j.NewRun()
+
+		first, err := run.Backup(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		second, err := run.Backup(path, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := run.Discard(first); err != nil || !exists(second.Backup) {
+			t.Fatalf("Discard() error = %v, removed a backup that is still pending", err)
+		}
+
+		if err := run.Discard(second); err != nil || exists(second.Backup) {
+			t.Errorf("Discard() of the last user error = %v, backup is kept = %v, want removed", err, exists(second.Backup))
+		}
+	})
+}
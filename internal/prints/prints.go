@@ -2,22 +2,23 @@ package prints
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/fatih/color"
 )
 
 var IsQuiet = false
+var Output io.Writer = os.Stdout    // Where non-warning messages are written
+var ErrOutput io.Writer = os.Stderr // Where warnings are written
 var warnBegin = color.YellowString("Warning: ")
 
 func Warnln(items ...any) {
-	fmt.Fprint(os.Stderr, warnBegin)
-	fmt.Fprintln(os.Stderr, items...)
+	fmt.Fprint(ErrOutput, warnBegin+fmt.Sprintln(items...))
 }
 
 func Warnf(format string, parameters ...any) {
-	fmt.Fprint(os.Stderr, warnBegin)
-	fmt.Fprintf(os.Stderr, format, parameters...)
+	fmt.Fprint(ErrOutput, warnBegin+fmt.Sprintf(format, parameters...))
 }
 
 func Print(items ...any) {
@@ -25,7 +26,7 @@ func Print(items ...any) {
 		return
 	}
 
-	fmt.Print(items...)
+	fmt.Fprint(Output, items...)
 }
 
 func Println(items ...any) {
@@ -33,7 +34,7 @@ func Println(items ...any) {
 		return
 	}
 
-	fmt.Println(items...)
+	fmt.Fprintln(Output, items...)
 }
 
 func Printf(format string, parameters ...any) {
@@ -41,5 +42,5 @@ func Printf(format string, parameters ...any) {
 		return
 	}
 
-	fmt.Printf(format, parameters...)
+	fmt.Fprintf(Output, format, parameters...)
 }
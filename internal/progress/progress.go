@@ -0,0 +1,300 @@
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/textutils"
+	"github.com/fatih/color"
+)
+
+const defaultWidth = 80
+const maxRunningLines = 8 // Running tools shown at once, the rest are counted in a single line
+const redrawInterval = time.Millisecond * 200
+
+// Live view of a run drawn at the bottom of a terminal: files done, bytes saved, an ETA and the running tools.
+// Messages must be written through `Writer()` while it is shown, so that they are printed above the view.
+type Display struct {
+	mutex    sync.Mutex
+	terminal *os.File
+
+	totalFiles int
+	totalBytes int64
+	doneFiles  int
+	doneBytes  int64 // Original sizes of the done files
+	savedBytes int64
+
+	running   []runningTool
+	startedAt time.Time
+
+	drawnLines int
+	writers    []*lineWriter
+	isStopped  bool
+
+	stopTicker chan struct{}
+	tickerDone chan struct{}
+}
+
+type runningTool struct {
+	toolName  string
+	filePaths []string
+	startedAt time.Time
+}
+
+// Starts drawing the view on `terminal`, for a run of `totalFiles` files weighing `totalBytes`.
+func NewDisplay(terminal *os.File, totalFiles int, totalBytes int64) *Display {
+	d := &Display{
+		terminal:   terminal,
+		totalFiles: totalFiles,
+		totalBytes: totalBytes,
+		startedAt:  time.Now(),
+		stopTicker: make(chan struct{}),
+		tickerDone: make(chan struct{}),
+	}
+
+	go d.tick()
+	return d
+}
+
+// Redraws periodically, so that durations keep going while nothing finishes.
+func (d *Display) tick() {
+	defer close(d.tickerDone)
+
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopTicker:
+			return
+		case <-ticker.C:
+			d.mutex.Lock()
+			d.redraw()
+			d.mutex.Unlock()
+		}
+	}
+}
+
+// Removes the view and writes what is left of incomplete lines. Messages are written as is afterwards. Can be
+// called more than once.
+func (d *Display) Stop() {
+	d.mutex.Lock()
+	if d.isStopped {
+		d.mutex.Unlock()
+		return
+	}
+
+	d.isStopped = true
+	d.mutex.Unlock()
+
+	close(d.stopTicker)
+	<-d.tickerDone
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.clear()
+	for _, writer := range d.writers {
+		_, _ = writer.target.Write(writer.pending)
+		writer.pending = nil
+	}
+}
+
+func (d *Display) ToolStarted(toolName string, filePaths []string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.running = append(d.running, runningTool{toolName: toolName, filePaths: filePaths, startedAt: time.Now()})
+	d.redraw()
+}
+
+func (d *Display) ToolFinished(toolName string, filePaths []string, _ error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	i := slices.IndexFunc(d.running, func(tool runningTool) bool {
+		return tool.toolName == toolName && slices.Equal(tool.filePaths, filePaths)
+	})
+
+	if i >= 0 {
+		d.running = slices.Delete(d.running, i, i+1)
+	}
+
+	d.redraw()
+}
+
+func (d *Display) FileDone(_ string, originalSize, bestSize int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.doneFiles++
+	d.doneBytes += originalSize
+	d.savedBytes += originalSize - bestSize
+	d.redraw()
+}
+
+// Returns a writer to `target` that prints whole lines above the view. `target` must be the terminal the view is
+// drawn on, or one sharing its screen.
+func (d *Display) Writer(target io.Writer) io.Writer {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	writer := &lineWriter{display: d, target: target}
+	d.writers = append(d.writers, writer)
+	return writer
+}
+
+type lineWriter struct {
+	display *Display
+	target  io.Writer
+	pending []byte // Incomplete line, written along with the rest of it
+}
+
+func (lw *lineWriter) Write(p []byte) (n int, err error) {
+	d := lw.display
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isStopped {
+		return lw.target.Write(p)
+	}
+
+	lw.pending = append(lw.pending, p...)
+	end := bytes.LastIndexByte(lw.pending, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	d.clear()
+	_, err = lw.target.Write(lw.pending[:end+1])
+	lw.pending = slices.Clone(lw.pending[end+1:])
+	d.redraw()
+
+	return len(p), err
+}
+
+// Erases the lines drawn last. Must be called with the mutex held.
+func (d *Display) clear() {
+	if d.drawnLines == 0 {
+		return
+	}
+
+	fmt.Fprintf(d.terminal, "\x1b[%dA\x1b[J", d.drawnLines)
+	d.drawnLines = 0
+}
+
+// Must be called with the mutex held.
+func (d *Display) redraw() {
+	if d.isStopped {
+		return
+	}
+
+	lines := d.lines()
+	width := terminalWidth(d.terminal)
+
+	var builder strings.Builder
+	if d.drawnLines > 0 {
+		fmt.Fprintf(&builder, "\x1b[%dA\x1b[J", d.drawnLines)
+	}
+
+	for i, line := range lines {
+		line = truncate(line, width-1)
+		if i == 0 {
+			line = strings.Replace(line, "Progress:", color.BlueString("Progress:"), 1)
+		}
+
+		builder.WriteString(line)
+		builder.WriteByte('\n')
+	}
+
+	// Written at once to avoid flickering
+	_, _ = io.WriteString(d.terminal, builder.String())
+	d.drawnLines = len(lines)
+}
+
+func (d *Display) lines() []string {
+	now := time.Now()
+	elapsed := now.Sub(d.startedAt)
+
+	header := fmt.Sprintf("Progress: %d/%d %s", d.doneFiles, d.totalFiles, textutils.PluralNoun(d.totalFiles, "files", "file"))
+	if d.totalFiles > 0 {
+		header += fmt.Sprintf(" (%d%%)", d.doneFiles*100/d.totalFiles)
+	}
+
+	header += fmt.Sprintf(", saved %s, elapsed %s, ETA %s", formatBytes(d.savedBytes), formatDuration(elapsed), d.eta(elapsed))
+
+	lines := []string{header}
+	for i, tool := range d.running {
+		if i == maxRunningLines {
+			lines = append(lines, fmt.Sprintf("  ... and %d more", len(d.running)-maxRunningLines))
+			break
+		}
+
+		files := strings.Join(tool.filePaths, " ")
+		if len(tool.filePaths) > 1 {
+			files = fmt.Sprintf("%d files", len(tool.filePaths))
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s: %s (%s)", tool.toolName, files, formatDuration(now.Sub(tool.startedAt))))
+	}
+
+	return lines
+}
+
+// Estimates the time left from the bytes done so far, falling back to the files done if their sizes are unknown.
+func (d *Display) eta(elapsed time.Duration) string {
+	done, total := float64(d.doneBytes), float64(d.totalBytes)
+	if d.totalBytes <= 0 {
+		done, total = float64(d.doneFiles), float64(d.totalFiles)
+	}
+
+	if done <= 0 {
+		return "-"
+	}
+
+	if done >= total {
+		return formatDuration(0)
+	}
+
+	return formatDuration(time.Duration(float64(elapsed) * (total - done) / done))
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// Returns `bytes` in the largest binary unit under it, such as `1.5 MiB`.
+func formatBytes(bytes int64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+
+	size, unit := float64(bytes), "B"
+	for _, next := range units {
+		if size > -1024 && size < 1024 {
+			break
+		}
+
+		size, unit = size/1024, next
+	}
+
+	if unit == "B" {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	return fmt.Sprintf("%.1f %s", size, unit)
+}
+
+// Cuts `line` to `width` characters, so that it takes a single row of the terminal.
+func truncate(line string, width int) string {
+	runes := []rune(line)
+	if width <= 0 || len(runes) <= width {
+		return line
+	}
+
+	return string(runes[:width])
+}
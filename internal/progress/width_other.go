@@ -0,0 +1,10 @@
+//go:build !unix
+
+package progress
+
+import "os"
+
+// Returns `defaultWidth`, terminals are not queried on this platform.
+func terminalWidth(_ *os.File) int {
+	return defaultWidth
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package progress
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Returns the width of the terminal at `file` in columns, or `defaultWidth` if it cannot be queried.
+func terminalWidth(file *os.File) int {
+	size, err := unix.IoctlGetWinsize(int(file.Fd()), unix.TIOCGWINSZ)
+	if err != nil || size.Col == 0 {
+		return defaultWidth
+	}
+
+	return int(size.Col)
+}
@@ -50,13 +50,37 @@ func (cr *CompressReport) WriteProcess(process *compressor.CompressionProcess) (
 	}
 
 	if process.AreDecodeTimeComputed {
-		header = append(
-			header,
-			fmt.Sprintf("Decode Time (ms avg within %v, w/ Go's native libraries)", process.MinDecodeTime),
-			"Decode Trials",
-		)
+		for _, decoderName := range process.DecoderNames {
+			header = append(
+				header,
+				fmt.Sprintf("Decode Time [%s] (ms avg within %v)", decoderName, process.DecodeBench.MinTime),
+				fmt.Sprintf("Decode Trials [%s]", decoderName),
+				fmt.Sprintf("Decode Median [%s] (ms)", decoderName),
+				fmt.Sprintf("Decode P95 [%s] (ms)", decoderName),
+				fmt.Sprintf("Decode StdDev [%s] (ms)", decoderName),
+				fmt.Sprintf("Decode Significant [%s]", decoderName),
+			)
+		}
+	}
+
+	if process.VerifyPixels {
+		header = append(header, "Pixels")
+	}
+
+	if process.ComputeQuality {
+		header = append(header, "Quality (MS-SSIM)")
+	}
+
+	if process.Metadata.IsEnforced() {
+		header = append(header, fmt.Sprintf("Metadata (%s)", process.Metadata.String()))
+	}
+
+	if !process.Selection.IsSize() {
+		header = append(header, "Selection", "Score", "Best")
 	}
 
+	header = append(header, "CPU User (s)", "CPU System (s)", "Peak Memory (MB)", "Attempts")
+
 	err = cr.writer.Write(header)
 	if err != nil {
 		return err
@@ -64,6 +88,10 @@ func (cr *CompressReport) WriteProcess(process *compressor.CompressionProcess) (
 
 	sortedToolNames := maputils.SortedKeys(process.Results)
 	for i, fileInfo := range process.OriginalFileInfo {
+		if !process.IsFileComplete(i) {
+			continue // Interrupted, its results are incomplete
+		}
+
 		originalLine := []string{
 			fileInfo.FileName,
 			"original",
@@ -75,13 +103,38 @@ func (cr *CompressReport) WriteProcess(process *compressor.CompressionProcess) (
 		}
 
 		if process.AreDecodeTimeComputed {
-			originalLine = append(
-				originalLine,
-				fileInfo.Decode.MSAverageToString(),
-				strconv.Itoa(fileInfo.Decode.Trials),
-			)
+			for decoderIdx := range process.DecoderNames {
+				decode := compressor.DecodeAt(fileInfo.Decodes, decoderIdx)
+				originalLine = append(
+					originalLine,
+					decode.MSAverageToString(),
+					strconv.Itoa(decode.Trials),
+					decode.MSString(decode.Median),
+					decode.MSString(decode.P95),
+					decode.MSString(decode.StdDev),
+					"-",
+				)
+			}
 		}
 
+		if process.VerifyPixels {
+			originalLine = append(originalLine, "-")
+		}
+
+		if process.ComputeQuality {
+			originalLine = append(originalLine, "1.000000")
+		}
+
+		if process.Metadata.IsEnforced() {
+			originalLine = append(originalLine, "-")
+		}
+
+		if !process.Selection.IsSize() {
+			originalLine = append(originalLine, fileInfo.Selection.String(), fileInfo.Score.String(), bestString(fileInfo.BestTool == ""))
+		}
+
+		originalLine = append(originalLine, "-", "-", "-", "-")
+
 		err = cr.writer.Write(originalLine)
 		if err != nil {
 			return err
@@ -92,9 +145,35 @@ func (cr *CompressReport) WriteProcess(process *compressor.CompressionProcess) (
 			resultLine := buildResultLine(fileInfo.FileName, toolName, result)
 
 			if process.AreDecodeTimeComputed {
-				resultLine = expandResultLineWithDecodeTime(resultLine, result)
+				for decoderIdx := range process.DecoderNames {
+					resultLine = expandResultLineWithDecodeTime(
+						resultLine,
+						result,
+						compressor.DecodeAt(result.Decodes, decoderIdx),
+						compressor.DecodeAt(fileInfo.Decodes, decoderIdx),
+					)
+				}
+			}
+
+			if process.VerifyPixels {
+				resultLine = append(resultLine, pixelCheckString(result))
+			}
+
+			if process.ComputeQuality {
+				resultLine = append(resultLine, qualityString(result))
+			}
+
+			if process.Metadata.IsEnforced() {
+				resultLine = append(resultLine, result.Metadata.String())
 			}
 
+			if !process.Selection.IsSize() {
+				resultLine = append(resultLine, fileInfo.Selection.String(), result.Score.String(), bestString(toolName == fileInfo.BestTool))
+			}
+
+			resultLine = append(resultLine, resourceFields(result.Resources)...)
+			resultLine = append(resultLine, attemptsString(result.Attempts))
+
 			err = cr.writer.Write(resultLine)
 			if err != nil {
 				return err
@@ -124,19 +203,48 @@ func commandWithArgsString(cmdArgs []string, toolArgCount int) string {
 	return strings.Join(cmdArgs[0:toolArgCount+1], " ")
 }
 
-func buildResultLine(fileName, toolName string, result *compressor.CompressionResult) (fields []string) {
+func resultCommandString(result *compressor.CompressionResult) string {
+	if result.IsCached {
+		return "(cached)"
+	}
+
+	if len(result.Stages) > 0 {
+		stageCommands := make([]string, 0, len(result.Stages))
+		for _, stage := range result.Stages {
+			stageCommands = append(stageCommands, resultCommandString(stage))
+		}
+
+		return strings.Join(stageCommands, " -> ")
+	}
+
+	if result.Command == nil {
+		return "-"
+	}
+
 	argCount := len(result.Arguments)
 	if result.IsWrapped {
 		// the wrapper is included as an "argument" on Command.Args, so this factors that in
 		argCount += 1
 	}
 
-	commandWithArgs := commandWithArgsString(result.Command.Args, argCount)
+	return commandWithArgsString(result.Command.Args, argCount)
+}
+
+func buildResultLine(fileName, toolName string, result *compressor.CompressionResult) (fields []string) {
+	commandWithArgs := resultCommandString(result)
 
 	if result.CreateFileError != nil {
 		return []string{fileName, toolName, commandWithArgs, "CANNOT CREATE OUTPUT", "-", "-", "-", "-"}
 	}
 
+	if result.IsTimedOut() {
+		return []string{fileName, toolName, commandWithArgs, "TIMED OUT", "-", "-", "-", "-"}
+	}
+
+	if result.IsOverMemoryLimit() {
+		return []string{fileName, toolName, commandWithArgs, "EXCEEDED MEMORY LIMIT", "-", "-", "-", "-"}
+	}
+
 	if result.CommandError != nil {
 		return []string{fileName, toolName, commandWithArgs, "COMMAND FAILED", "-", "-", "-", "-"}
 	}
@@ -168,24 +276,97 @@ func buildResultLine(fileName, toolName string, result *compressor.CompressionRe
 	}
 }
 
-func expandResultLineWithDecodeTime(fields []string, result *compressor.CompressionResult) []string {
+func expandResultLineWithDecodeTime(
+	fields []string,
+	result *compressor.CompressionResult,
+	decode, originalDecode compressor.DecodeTimeBench,
+) []string {
+
 	if result.CommandError != nil || result.CreateFileError != nil {
 		fields = append(
 			fields,
 			"-",
 			"-",
+			"-",
+			"-",
+			"-",
+			"-",
 		)
 	} else {
+		significance := "NO"
+		if decode.Trials == 0 {
+			significance = "-"
+		} else if decode.IsSignificantlyDifferent(originalDecode) {
+			significance = "YES"
+		}
+
 		fields = append(
 			fields,
-			result.Decode.MSAverageToString(),
-			strconv.Itoa(result.Decode.Trials),
+			decode.MSAverageToString(),
+			strconv.Itoa(decode.Trials),
+			decode.MSString(decode.Median),
+			decode.MSString(decode.P95),
+			decode.MSString(decode.StdDev),
+			significance,
 		)
 	}
 
 	return fields
 }
 
+func pixelCheckString(result *compressor.CompressionResult) string {
+	switch result.Pixels {
+	case compressor.PixelsMatch:
+		return "MATCH"
+	case compressor.PixelsDiffer:
+		if result.PixelsError != nil {
+			return "DIFFER: " + result.PixelsError.Error()
+		}
+
+		return "DIFFER"
+	case compressor.PixelsUnsupported:
+		return "UNSUPPORTED"
+	}
+
+	return "-"
+}
+
+func qualityString(result *compressor.CompressionResult) string {
+	if result.Quality.IsBelowMinimum && result.Quality.IsComputed {
+		return result.Quality.String() + " (BELOW MINIMUM)"
+	}
+
+	return result.Quality.String()
+}
+
+func resourceFields(usage compressor.ResourceUsage) []string {
+	if !usage.IsMeasured {
+		return []string{"-", "-", "-"}
+	}
+
+	return []string{
+		strconv.FormatFloat(usage.UserTime.Seconds(), 'f', 6, 64),
+		strconv.FormatFloat(usage.SystemTime.Seconds(), 'f', 6, 64),
+		usage.PeakMemoryString(),
+	}
+}
+
+func attemptsString(attempts int) string {
+	if attempts == 0 {
+		return "-"
+	}
+
+	return strconv.Itoa(attempts)
+}
+
+func bestString(isBest bool) string {
+	if isBest {
+		return "YES"
+	}
+
+	return "-"
+}
+
 func toMegaByte(sizeInByte int64) float64 {
 	const bytePerMegabyte = 1000000
 	return float64(sizeInByte) / bytePerMegabyte
@@ -0,0 +1,425 @@
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/compressor"
+	"github.com/ArrayNone/compacty/internal/maputils"
+)
+
+// Version of the JSON records written by `--output-format`. Bumped when a field is removed, renamed or changes
+// meaning, adding fields does not bump it.
+const SchemaVersion = 1
+
+var errWriterClosed = errors.New("JSON writer is closed")
+
+type OutputFormat string
+
+const (
+	FormatText      OutputFormat = "text"  // Coloured text for people. Default
+	FormatJSON      OutputFormat = "json"  // A single JSON document written once everything is done
+	FormatJSONLines OutputFormat = "jsonl" // One JSON record per line, each file written as soon as it is done
+)
+
+// Parses an output format given as `text`, `json` or `jsonl`, as used by `--output-format`.
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	switch format := OutputFormat(value); format {
+	case FormatText, FormatJSON, FormatJSONLines:
+		return format, nil
+	}
+
+	return "", fmt.Errorf("unknown output format %q, expected one of: text, json, jsonl", value)
+}
+
+// Returns `true` if the format is meant for programs. Returns `false` otherwise.
+func (f OutputFormat) IsMachineReadable() bool {
+	return f == FormatJSON || f == FormatJSONLines
+}
+
+// Fields every record starts with. `Type` is one of `file`, `summary`, `run`, `list` or `list-args`.
+type RecordHeader struct {
+	SchemaVersion int    `json:"schema_version"`
+	Type          string `json:"type"`
+}
+
+func newHeader(recordType string) RecordHeader {
+	return RecordHeader{SchemaVersion: SchemaVersion, Type: recordType}
+}
+
+// Outcome of a compressed file.
+type FileRecord struct {
+	RecordHeader
+
+	Path            string         `json:"path"`
+	Format          string         `json:"format"` // MIME type
+	OriginalSize    int64          `json:"original_size"`
+	OriginalDecodes []DecodeRecord `json:"original_decodes,omitempty"`
+
+	Selection      string   `json:"selection"`
+	OriginalScore  *float64 `json:"original_score,omitempty"`
+	Winner         *string  `json:"winner"`           // Tool of the picked result. Null if no result beats the original
+	BelowMinSaving bool     `json:"below_min_saving"` // The winner saves less than the minimum, the original is kept
+	FinalSize      int64    `json:"final_size"`       // Size of the kept file, the original's if it is kept
+	WrittenPath    *string  `json:"written_path"`     // Where the kept file is written. Null if nothing is written
+
+	Results []ResultRecord `json:"results"` // Sorted by tool name
+}
+
+// Result of a tool or chain for a file.
+type ResultRecord struct {
+	Tool    string `json:"tool"`
+	Command string `json:"command"` // As run, stages are separated by ` -> `. `(cached)` for cached results
+	Cached  bool   `json:"cached"`
+
+	// One of `ok`, `failed`, `timed-out`, `memory-limit`, `cannot-create-output`, `cannot-read-size` or
+	// `decode-failed`. Results that are not `ok` are never picked
+	Status string  `json:"status"`
+	Error  *string `json:"error"`
+
+	FinalSize   *int64          `json:"final_size"` // Null if the size is unknown
+	TimeSeconds float64         `json:"time_seconds"`
+	Resources   *ResourceRecord `json:"resources,omitempty"` // Omitted if not measured
+	Attempts    int             `json:"attempts"`            // 0 if the tool did not run
+
+	Decodes  []DecodeRecord  `json:"decodes,omitempty"`
+	Pixels   string          `json:"pixels,omitempty"` // `match`, `differ` or `unsupported` if pixels are verified
+	Quality  *float64        `json:"quality,omitempty"`
+	Metadata *MetadataRecord `json:"metadata,omitempty"`
+
+	Disqualified bool     `json:"disqualified"`
+	Score        *float64 `json:"score,omitempty"`
+	WrittenPath  *string  `json:"written_path"`
+
+	Stages []ResultRecord `json:"stages,omitempty"` // Results of each executed tool of a chain
+}
+
+type ResourceRecord struct {
+	CPUUserSeconds   float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds float64 `json:"cpu_system_seconds"`
+	PeakMemoryBytes  *int64  `json:"peak_memory_bytes"` // Null if unavailable on this platform
+}
+
+// Decode time of a file measured by a decoder, in milliseconds.
+type DecodeRecord struct {
+	Decoder     string  `json:"decoder"`
+	Trials      int     `json:"trials"`
+	AverageMs   float64 `json:"average_ms"`
+	MedianMs    float64 `json:"median_ms"`
+	P95Ms       float64 `json:"p95_ms"`
+	StdDevMs    float64 `json:"stddev_ms"`
+	Significant *bool   `json:"significant,omitempty"` // Differs significantly from the original's. Results only
+	Error       *string `json:"error,omitempty"`
+}
+
+type MetadataRecord struct {
+	Removed []string `json:"removed"`
+	Missing []string `json:"missing"`
+	Error   *string  `json:"error,omitempty"`
+}
+
+// End of a run. Written last as a `summary` line with `jsonl`, or as the `run` document holding every file with
+// `json`.
+type RunRecord struct {
+	RecordHeader
+
+	Files     []FileRecord `json:"files,omitempty"`
+	FileCount int          `json:"file_count"`
+	OK        bool         `json:"ok"`
+	Error     *string      `json:"error"`
+}
+
+// Writes the records of a run to `out` in a machine-readable format.
+type JSONWriter struct {
+	out    io.Writer
+	format OutputFormat
+
+	files     []FileRecord
+	fileCount int
+	isClosed  bool
+
+	mutex sync.Mutex // Closed from another goroutine when the run is aborted
+}
+
+func NewJSONWriter(out io.Writer, format OutputFormat) *JSONWriter {
+	return &JSONWriter{out: out, format: format}
+}
+
+// Writes the outcome of the file at `fileIdx`, or keeps it until `Close()` with `FormatJSON`. `mime` is the format
+// of the file, `chains` the chains it is compressed with.
+func (jw *JSONWriter) WriteFile(
+	process *compressor.CompressionProcess,
+	fileIdx int,
+	mime string,
+	chains map[string]compressor.ExecutedChain,
+) error {
+
+	record := NewFileRecord(process, fileIdx, mime, chains)
+
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+
+	if jw.isClosed {
+		return errWriterClosed
+	}
+
+	jw.fileCount++
+
+	if jw.format == FormatJSONLines {
+		return WriteRecord(jw.out, jw.format, record)
+	}
+
+	jw.files = append(jw.files, record)
+	return nil
+}
+
+// Writes the end of the run, which failed if `runErr` is not nil. Only the first call writes anything.
+func (jw *JSONWriter) Close(runErr error) error {
+	jw.mutex.Lock()
+	defer jw.mutex.Unlock()
+
+	if jw.isClosed {
+		return nil
+	}
+
+	jw.isClosed = true
+
+	record := RunRecord{
+		RecordHeader: newHeader("summary"),
+		FileCount:    jw.fileCount,
+		OK:           runErr == nil,
+		Error:        errorPointer(runErr),
+	}
+
+	if jw.format == FormatJSON {
+		record.RecordHeader = newHeader("run")
+		record.Files = jw.files
+		if record.Files == nil {
+			record.Files = []FileRecord{}
+		}
+	}
+
+	return WriteRecord(jw.out, jw.format, record)
+}
+
+// Writes `record` indented with `FormatJSON`, or on a single line otherwise.
+func WriteRecord(out io.Writer, format OutputFormat, record any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	if format == FormatJSON {
+		encoder.SetIndent("", "  ")
+	}
+
+	return encoder.Encode(record)
+}
+
+func NewFileRecord(
+	process *compressor.CompressionProcess,
+	fileIdx int,
+	mime string,
+	chains map[string]compressor.ExecutedChain,
+) FileRecord {
+
+	fileInfo := process.OriginalFileInfo[fileIdx]
+
+	record := FileRecord{
+		RecordHeader: newHeader("file"),
+		Path:         fileInfo.Path,
+		Format:       mime,
+		OriginalSize: fileInfo.Size,
+		Selection:    fileInfo.Selection.String(),
+		FinalSize:    fileInfo.Size,
+		WrittenPath:  stringPointer(fileInfo.WrittenPath),
+		Results:      []ResultRecord{},
+	}
+
+	if process.AreDecodeTimeComputed {
+		for decoderIdx := range process.DecoderNames {
+			decode := compressor.DecodeAt(fileInfo.Decodes, decoderIdx)
+			record.OriginalDecodes = append(record.OriginalDecodes, newDecodeRecord(decode, nil))
+		}
+	}
+
+	if fileInfo.Score.IsScored {
+		record.OriginalScore = &fileInfo.Score.Score
+	}
+
+	if fileInfo.BestTool != "" {
+		record.Winner = &fileInfo.BestTool
+
+		bestResult := process.Results[fileInfo.BestTool][fileIdx]
+		record.BelowMinSaving = !process.MinSaving.IsZero() && !process.MinSaving.IsMet(fileInfo.Size, bestResult.FinalSize)
+		if !record.BelowMinSaving {
+			record.FinalSize = bestResult.FinalSize
+		}
+	}
+
+	for _, toolName := range maputils.SortedKeys(process.Results) {
+		result := process.Results[toolName][fileIdx]
+		if result == nil {
+			continue
+		}
+
+		resultRecord := newResultRecord(process, fileInfo, toolName, result)
+		for i, stage := range result.Stages {
+			stageName := fmt.Sprintf("%s (%d)", toolName, i+1)
+			if chainStages := chains[toolName].Stages; i < len(chainStages) {
+				stageName = toolName + " (" + chainStages[i].Name + ")"
+			}
+
+			resultRecord.Stages = append(resultRecord.Stages, newResultRecord(process, fileInfo, stageName, stage))
+		}
+
+		record.Results = append(record.Results, resultRecord)
+	}
+
+	return record
+}
+
+func newResultRecord(
+	process *compressor.CompressionProcess,
+	fileInfo *compressor.FileInfo,
+	toolName string,
+	result *compressor.CompressionResult,
+) ResultRecord {
+
+	status, err := resultStatus(result)
+	record := ResultRecord{
+		Tool:         toolName,
+		Command:      resultCommandString(result),
+		Cached:       result.IsCached,
+		Status:       status,
+		Error:        errorPointer(err),
+		TimeSeconds:  result.TimeTaken.Seconds(),
+		Attempts:     result.Attempts,
+		Disqualified: result.IsDisqualified(),
+		WrittenPath:  stringPointer(result.WrittenPath),
+	}
+
+	if status == "ok" || status == "decode-failed" {
+		record.FinalSize = &result.FinalSize
+	}
+
+	if result.Resources.IsMeasured {
+		record.Resources = &ResourceRecord{
+			CPUUserSeconds:   result.Resources.UserTime.Seconds(),
+			CPUSystemSeconds: result.Resources.SystemTime.Seconds(),
+		}
+
+		if result.Resources.PeakMemory > 0 {
+			record.Resources.PeakMemoryBytes = &result.Resources.PeakMemory
+		}
+	}
+
+	// Stages of chains are not measured
+	if process.AreDecodeTimeComputed && len(result.Decodes) > 0 && result.CommandError == nil && result.CreateFileError == nil {
+		for decoderIdx := range process.DecoderNames {
+			decode := compressor.DecodeAt(result.Decodes, decoderIdx)
+
+			var significant *bool
+			if decode.Trials > 0 {
+				isSignificant := decode.IsSignificantlyDifferent(compressor.DecodeAt(fileInfo.Decodes, decoderIdx))
+				significant = &isSignificant
+			}
+
+			record.Decodes = append(record.Decodes, newDecodeRecord(decode, significant))
+		}
+	}
+
+	switch result.Pixels {
+	case compressor.PixelsMatch:
+		record.Pixels = "match"
+	case compressor.PixelsDiffer:
+		record.Pixels = "differ"
+	case compressor.PixelsUnsupported:
+		record.Pixels = "unsupported"
+	}
+
+	if result.Quality.IsComputed {
+		record.Quality = &result.Quality.Score
+	}
+
+	if result.Metadata.IsChecked {
+		record.Metadata = &MetadataRecord{
+			Removed: nonNilStrings(result.Metadata.Removed),
+			Missing: nonNilStrings(result.Metadata.Missing),
+			Error:   errorPointer(result.Metadata.Err),
+		}
+	}
+
+	if result.Score.IsScored {
+		record.Score = &result.Score.Score
+	}
+
+	return record
+}
+
+// Returns the status of `result` along with the error behind it.
+func resultStatus(result *compressor.CompressionResult) (status string, err error) {
+	switch {
+	case result.CreateFileError != nil:
+		return "cannot-create-output", result.CreateFileError
+	case result.IsTimedOut():
+		return "timed-out", result.CommandError
+	case result.IsOverMemoryLimit():
+		return "memory-limit", result.CommandError
+	case result.CommandError != nil:
+		return "failed", result.CommandError
+	case result.ReadFinalSizeError != nil:
+		return "cannot-read-size", result.ReadFinalSizeError
+	}
+
+	for _, decode := range result.Decodes {
+		if decode.Err != nil {
+			return "decode-failed", fmt.Errorf("%s: %w", decode.Decoder, decode.Err)
+		}
+	}
+
+	return "ok", nil
+}
+
+func newDecodeRecord(decode compressor.DecodeTimeBench, significant *bool) DecodeRecord {
+	return DecodeRecord{
+		Decoder:     decode.Decoder,
+		Trials:      decode.Trials,
+		AverageMs:   milliseconds(decode.Average),
+		MedianMs:    milliseconds(decode.Median),
+		P95Ms:       milliseconds(decode.P95),
+		StdDevMs:    milliseconds(decode.StdDev),
+		Significant: significant,
+		Error:       errorPointer(decode.Err),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / float64(time.Millisecond)
+}
+
+func errorPointer(err error) *string {
+	if err == nil {
+		return nil
+	}
+
+	message := err.Error()
+	return &message
+}
+
+func stringPointer(str string) *string {
+	if str == "" {
+		return nil
+	}
+
+	return &str
+}
+
+func nonNilStrings(strs []string) []string {
+	if strs == nil {
+		return []string{}
+	}
+
+	return strs
+}
@@ -0,0 +1,326 @@
+package report_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ArrayNone/compacty/internal/compressor"
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/report"
+)
+
+// Returns a process holding a single PNG, compressed by an `oxipng` result that won, a `pngcrush -> oxipng` chain
+// and a `zopflipng` result that failed.
+func newProcess() (process *compressor.CompressionProcess, chains map[string]compressor.ExecutedChain) {
+	decode := func(average time.Duration) []compressor.DecodeTimeBench {
+		return []compressor.DecodeTimeBench{{
+			Decoder: config.BuiltinDecoder,
+			Average: average,
+			Median:  average,
+			P95:     average + time.Millisecond,
+			StdDev:  time.Millisecond / 2,
+			Trials:  20,
+		}}
+	}
+
+	fileInfo := &compressor.FileInfo{
+		Path:        "images/photo.png",
+		Size:        1000,
+		Decodes:     decode(4 * time.Millisecond),
+		Selection:   config.Selection{Strategy: config.SelectBySize},
+		Score:       compressor.SelectionScore{Score: 1, IsScored: true},
+		BestTool:    "oxipng",
+		WrittenPath: "out/photo.png",
+	}
+
+	oxipng := &compressor.CompressionResult{
+		Command:   exec.Command("oxipng", "-o", "max", "images/photo.png"),
+		Arguments: []string{"-o", "max"},
+		TimeTaken: 1500 * time.Millisecond,
+		Resources: compressor.ResourceUsage{
+			UserTime:   time.Second,
+			SystemTime: 250 * time.Millisecond,
+			PeakMemory: 1 << 20,
+			IsMeasured: true,
+		},
+		Attempts:     1,
+		OriginalSize: 1000,
+		FinalSize:    800,
+		Decodes:      decode(2 * time.Millisecond),
+		Pixels:       compressor.PixelsMatch,
+		Quality:      compressor.QualityScore{Score: 1, IsComputed: true},
+		Metadata:     compressor.MetadataCheck{IsChecked: true, Removed: []string{"tEXt"}},
+		Score:        compressor.SelectionScore{Score: 0.8, IsScored: true},
+		WrittenPath:  "out/photo.png",
+	}
+
+	chain := &compressor.CompressionResult{
+		TimeTaken:    2 * time.Second,
+		Attempts:     2,
+		OriginalSize: 1000,
+		FinalSize:    900,
+		Decodes:      decode(4 * time.Millisecond),
+		Stages: []*compressor.CompressionResult{
+			{Command: exec.Command("pngcrush", "in.png", "out.png"), TimeTaken: time.Second, Attempts: 2, FinalSize: 950},
+			{Command: exec.Command("oxipng", "out.png"), TimeTaken: time.Second, Attempts: 1, FinalSize: 900},
+		},
+		Score: compressor.SelectionScore{Score: 0.9, IsScored: true},
+	}
+
+	failed := &compressor.CompressionResult{
+		Command:      exec.Command("zopflipng", "images/photo.png", "out.png"),
+		TimeTaken:    time.Second / 2,
+		Attempts:     1,
+		OriginalSize: 1000,
+		CommandError: errors.New("exit status 1"),
+	}
+
+	process = &compressor.CompressionProcess{
+		OriginalFileInfo: []*compressor.FileInfo{fileInfo},
+		Results: map[string][]*compressor.CompressionResult{
+			"oxipng":         {oxipng},
+			"crush-then-oxi": {chain},
+			"zopflipng":      {failed},
+		},
+		AreDecodeTimeComputed: true,
+		DecoderNames:          []string{config.BuiltinDecoder},
+	}
+
+	chains = map[string]compressor.ExecutedChain{
+		"crush-then-oxi": {Stages: []compressor.ChainStage{{Name: "pngcrush"}, {Name: "oxipng"}}},
+	}
+
+	return process, chains
+}
+
+const wantFileRecord = `{
+  "schema_version": 1,
+  "type": "file",
+  "path": "images/photo.png",
+  "format": "image/png",
+  "original_size": 1000,
+  "original_decodes": [
+    {
+      "decoder": "go",
+      "trials": 20,
+      "average_ms": 4,
+      "median_ms": 4,
+      "p95_ms": 5,
+      "stddev_ms": 0.5
+    }
+  ],
+  "selection": "size",
+  "original_score": 1,
+  "winner": "oxipng",
+  "below_min_saving": false,
+  "final_size": 800,
+  "written_path": "out/photo.png",
+  "results": [
+    {
+      "tool": "crush-then-oxi",
+      "command": "pngcrush -> oxipng",
+      "cached": false,
+      "status": "ok",
+      "error": null,
+      "final_size": 900,
+      "time_seconds": 2,
+      "attempts": 2,
+      "decodes": [
+        {
+          "decoder": "go",
+          "trials": 20,
+          "average_ms": 4,
+          "median_ms": 4,
+          "p95_ms": 5,
+          "stddev_ms": 0.5,
+          "significant": false
+        }
+      ],
+      "disqualified": false,
+      "score": 0.9,
+      "written_path": null,
+      "stages": [
+        {
+          "tool": "crush-then-oxi (pngcrush)",
+          "command": "pngcrush",
+          "cached": false,
+          "status": "ok",
+          "error": null,
+          "final_size": 950,
+          "time_seconds": 1,
+          "attempts": 2,
+          "disqualified": false,
+          "written_path": null
+        },
+        {
+          "tool": "crush-then-oxi (oxipng)",
+          "command": "oxipng",
+          "cached": false,
+          "status": "ok",
+          "error": null,
+          "final_size": 900,
+          "time_seconds": 1,
+          "attempts": 1,
+          "disqualified": false,
+          "written_path": null
+        }
+      ]
+    },
+    {
+      "tool": "oxipng",
+      "command": "oxipng -o max",
+      "cached": false,
+      "status": "ok",
+      "error": null,
+      "final_size": 800,
+      "time_seconds": 1.5,
+      "resources": {
+        "cpu_user_seconds": 1,
+        "cpu_system_seconds": 0.25,
+        "peak_memory_bytes": 1048576
+      },
+      "attempts": 1,
+      "decodes": [
+        {
+          "decoder": "go",
+          "trials": 20,
+          "average_ms": 2,
+          "median_ms": 2,
+          "p95_ms": 3,
+          "stddev_ms": 0.5,
+          "significant": true
+        }
+      ],
+      "pixels": "match",
+      "quality": 1,
+      "metadata": {
+        "removed": [
+          "tEXt"
+        ],
+        "missing": []
+      },
+      "disqualified": false,
+      "score": 0.8,
+      "written_path": "out/photo.png"
+    },
+    {
+      "tool": "zopflipng",
+      "command": "zopflipng",
+      "cached": false,
+      "status": "failed",
+      "error": "exit status 1",
+      "final_size": null,
+      "time_seconds": 0.5,
+      "attempts": 1,
+      "disqualified": false,
+      "written_path": null
+    }
+  ]
+}
+`
+
+func TestFileRecord(t *testing.T) {
+	process, chains := newProcess()
+
+	var out bytes.Buffer
+	err := report.WriteRecord(&out, report.FormatJSON, report.NewFileRecord(process, 0, "image/png", chains))
+	if err != nil {
+		t.Fatalf("WriteRecord() error = %v", err)
+	}
+
+	if out.String() != wantFileRecord {
+		t.Errorf("WriteRecord() wrote:\n%s\nwant:\n%s", out.String(), wantFileRecord)
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    report.OutputFormat
+		runErr    error
+		wantLines []string // `type` of each line with `jsonl`
+	}{
+		{name: "json lines", format: report.FormatJSONLines, wantLines: []string{"file", "file", "summary"}},
+		{name: "json lines of a failed run", format: report.FormatJSONLines, runErr: errors.New("interrupted"), wantLines: []string{"file", "file", "summary"}},
+		{name: "json", format: report.FormatJSON},
+		{name: "json of a failed run", format: report.FormatJSON, runErr: errors.New("interrupted")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			process, chains := newProcess()
+
+			var out bytes.Buffer
+			writer := report.NewJSONWriter(&out, test.format)
+			for range 2 {
+				if err := writer.WriteFile(process, 0, "image/png", chains); err != nil {
+					t.Fatalf("WriteFile() error = %v", err)
+				}
+			}
+
+			if err := writer.Close(test.runErr); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			// Closing again writes nothing
+			written := out.Len()
+			if err := writer.Close(nil); err != nil || out.Len() != written {
+				t.Errorf("second Close() = %v and wrote %d bytes, want nothing written", err, out.Len()-written)
+			}
+
+			if err := writer.WriteFile(process, 0, "image/png", chains); err == nil {
+				t.Errorf("WriteFile() after Close() error = nil, want an error")
+			}
+
+			var run map[string]any
+			if test.format == report.FormatJSONLines {
+				scanner := bufio.NewScanner(&out)
+				scanner.Buffer(nil, 1<<20)
+
+				var lineTypes []string
+				for scanner.Scan() {
+					var record map[string]any
+					if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+						t.Fatalf("line %q is not a JSON object: %v", scanner.Text(), err)
+					}
+
+					lineTypes = append(lineTypes, record["type"].(string))
+					run = record
+				}
+
+				if strings.Join(lineTypes, ",") != strings.Join(test.wantLines, ",") {
+					t.Errorf("line types = %v, want %v", lineTypes, test.wantLines)
+				}
+			} else {
+				decoder := json.NewDecoder(&out)
+				if err := decoder.Decode(&run); err != nil {
+					t.Fatalf("output is not a JSON document: %v", err)
+				}
+
+				if decoder.More() {
+					t.Errorf("output holds more than a single document")
+				}
+
+				if files, _ := run["files"].([]any); run["type"] != "run" || len(files) != 2 {
+					t.Errorf("run record = %v, want type run with 2 files", run)
+				}
+			}
+
+			wantError := any(nil)
+			if test.runErr != nil {
+				wantError = test.runErr.Error()
+			}
+
+			if run["schema_version"] != float64(report.SchemaVersion) || run["file_count"] != float64(2) ||
+				run["ok"] != (test.runErr == nil) || run["error"] != wantError {
+				t.Errorf("last record = %v, want %d files, ok = %v and error %v", run, 2, test.runErr == nil, wantError)
+			}
+		})
+	}
+}
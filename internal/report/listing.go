@@ -0,0 +1,166 @@
+package report
+
+import (
+	"errors"
+	"runtime"
+	"slices"
+
+	"github.com/ArrayNone/compacty/internal/config"
+	"github.com/ArrayNone/compacty/internal/maputils"
+)
+
+// Tools, chains and presets of a config, as printed by `--list`. Hidden presets are left out.
+type ListRecord struct {
+	RecordHeader
+
+	ConfigPath    string         `json:"config_path"`
+	DefaultPreset string         `json:"default_preset"`
+	Tools         []ToolRecord   `json:"tools"`
+	Chains        []ChainRecord  `json:"chains"`
+	Presets       []PresetRecord `json:"presets"`
+}
+
+type ToolRecord struct {
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	SupportedFormats []string `json:"supported_formats"`
+	Wrapper          *string  `json:"wrapper"` // Program the tool is run with on this platform, such as wine. Null if none
+	Available        bool     `json:"available"`
+}
+
+type ChainRecord struct {
+	Name             string   `json:"name"`
+	Description      string   `json:"description"`
+	Tools            []string `json:"tools"` // In the order they run
+	SupportedFormats []string `json:"supported_formats"`
+	Available        bool     `json:"available"`
+}
+
+type PresetRecord struct {
+	Name         string              `json:"name"`
+	Shorthands   []string            `json:"shorthands"`
+	Description  string              `json:"description"`
+	Default      bool                `json:"default"`
+	Lossless     bool                `json:"lossless"`
+	DefaultTools map[string][]string `json:"default_tools"` // MIME type -> tools and chains
+}
+
+// Arguments of every tool for each preset, as printed by `--list-args` and `--list-args-raw`.
+type ListArgsRecord struct {
+	RecordHeader
+
+	ConfigPath string           `json:"config_path"`
+	Raw        bool             `json:"raw"` // Includes are kept as is and hidden presets are listed
+	Tools      []ToolArgsRecord `json:"tools"`
+}
+
+type ToolArgsRecord struct {
+	Name      string              `json:"name"`
+	Available bool                `json:"available"`
+	Arguments map[string][]string `json:"arguments"`        // Preset -> arguments
+	Errors    map[string]string   `json:"errors,omitempty"` // Preset -> why its includes cannot be resolved
+}
+
+func NewListRecord(cfg *config.Config, configPath string) ListRecord {
+	record := ListRecord{
+		RecordHeader:  newHeader("list"),
+		ConfigPath:    configPath,
+		DefaultPreset: cfg.DefaultPreset,
+		Tools:         []ToolRecord{},
+		Chains:        []ChainRecord{},
+		Presets:       []PresetRecord{},
+	}
+
+	for _, toolName := range maputils.SortedKeys(cfg.Tools) {
+		tool := cfg.Tools[toolName]
+		record.Tools = append(record.Tools, ToolRecord{
+			Name:             toolName,
+			Description:      tool.Description,
+			SupportedFormats: nonNilStrings(tool.SupportedFormats),
+			Wrapper:          stringPointer(cfg.QueryToolWrapper(tool, runtime.GOOS)),
+			Available:        cfg.IsToolAvailable(toolName),
+		})
+	}
+
+	for _, chainName := range maputils.SortedKeys(cfg.Chains) {
+		chain := cfg.Chains[chainName]
+		record.Chains = append(record.Chains, ChainRecord{
+			Name:             chainName,
+			Description:      chain.Description,
+			Tools:            nonNilStrings(chain.Tools),
+			SupportedFormats: nonNilStrings(cfg.GetChainSupportedFormats(chainName)),
+			Available:        cfg.IsToolAvailable(chainName),
+		})
+	}
+
+	for _, presetName := range maputils.SortedKeys(cfg.Presets) {
+		preset := cfg.Presets[presetName]
+		if preset.IsHidden {
+			continue
+		}
+
+		defaultTools := make(map[string][]string, len(preset.DefaultTools))
+		for format, toolNames := range preset.DefaultTools {
+			if len(toolNames) > 0 {
+				defaultTools[format] = slices.Clone(toolNames)
+			}
+		}
+
+		record.Presets = append(record.Presets, PresetRecord{
+			Name:         presetName,
+			Shorthands:   nonNilStrings(preset.Shorthands),
+			Description:  preset.Description,
+			Default:      cfg.DefaultPreset == presetName,
+			Lossless:     preset.Lossless,
+			DefaultTools: defaultTools,
+		})
+	}
+
+	return record
+}
+
+// Resolves the includes of every preset's arguments unless `raw` is set.
+func NewListArgsRecord(cfg *config.Config, configPath string, raw bool) ListArgsRecord {
+	record := ListArgsRecord{
+		RecordHeader: newHeader("list-args"),
+		ConfigPath:   configPath,
+		Raw:          raw,
+		Tools:        []ToolArgsRecord{},
+	}
+
+	for _, toolName := range maputils.SortedKeys(cfg.Tools) {
+		tool := cfg.Tools[toolName]
+		toolRecord := ToolArgsRecord{
+			Name:      toolName,
+			Available: cfg.IsToolAvailable(toolName),
+			Arguments: make(map[string][]string),
+		}
+
+		for _, presetName := range maputils.SortedKeys(tool.Arguments) {
+			if cfg.Presets[presetName].IsHidden && !raw {
+				continue
+			}
+
+			args := tool.Arguments[presetName]
+			if !raw {
+				var errs []error
+				args, errs = tool.ResolveIncludesForPreset(presetName, toolName)
+
+				if len(errs) > 0 {
+					if toolRecord.Errors == nil {
+						toolRecord.Errors = make(map[string]string)
+					}
+
+					toolRecord.Errors[presetName] = errors.Join(errs...).Error()
+					continue
+				}
+			}
+
+			toolRecord.Arguments[presetName] = nonNilStrings(args)
+		}
+
+		record.Tools = append(record.Tools, toolRecord)
+	}
+
+	return record
+}